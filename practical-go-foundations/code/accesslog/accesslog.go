@@ -0,0 +1,286 @@
+// Package accesslog parses web server access logs in the Common Log Format
+// (CLF), e.g. sha1/http.log.gz (the NASA Kennedy Space Center log from
+// August 1995):
+//
+//	in24.inetnebr.com - - [01/Aug/1995:00:00:01 -0400] "GET /shuttle/missions/sts-68/news/sts-68-mcc-05.txt HTTP/1.0" 200 1839
+//
+// and the Combined Log Format which adds quoted referer and user agent fields.
+//
+// Real logs have requests with spaces and quotes in them ("GET / /   HTTP/1.0",
+// "GET / " HTTP/1.0"), and HTTP/0.9 requests without a protocol. The request
+// is what's between the first quote after the timestamp and the last quote
+// before the status, so these are parsed as well.
+//
+// Reader streams records, it doesn't load the log to memory. Malformed lines
+// are skipped and collected (see Reader.Malformed), a few bad lines shouldn't
+// stop the processing of a log.
+package accesslog
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"day1/decompress"
+)
+
+// TimeLayout is the layout of the timestamp, inside [ ]
+const TimeLayout = "02/Jan/2006:15:04:05 -0700"
+
+// Record is a request in the log
+type Record struct {
+	Host     string // remote host name or IP
+	Ident    string // RFC 1413 identity, "" for "-"
+	User     string // authenticated user, "" for "-"
+	Time     time.Time
+	Request  string // request line as in the log, e.g. "GET / HTTP/1.0"
+	Method   string
+	Path     string
+	Protocol string // "" for HTTP/0.9 requests
+	Status   int
+	Bytes    int64 // response size, -1 for "-" (unknown, e.g. 304 or 404)
+
+	// Combined Log Format only, "" for "-"
+	Referer   string
+	UserAgent string
+}
+
+// ParseError is a malformed line
+type ParseError struct {
+	File string // "" if unknown
+	Line int
+	Text string // the line
+	Err  error
+}
+
+func (e *ParseError) Error() string {
+	if e.File != "" {
+		return fmt.Sprintf("%s:%d: %s", e.File, e.Line, e.Err)
+	}
+	return fmt.Sprintf("%d: %s", e.Line, e.Err)
+}
+
+func (e *ParseError) Unwrap() error {
+	return e.Err
+}
+
+// DefaultMaxMalformed is the number of malformed lines a Reader keeps
+const DefaultMaxMalformed = 1000
+
+// maxLine is the longest line we read, longer lines are a final error
+const maxLine = 1 << 20
+
+// Reader reads records from a log stream
+type Reader struct {
+	File         string // used in errors
+	MaxMalformed int    // malformed lines to keep, default DefaultMaxMalformed, < 0 for none
+
+	scanner   *bufio.Scanner
+	closer    io.Closer
+	line      int
+	bad       int
+	malformed []*ParseError
+}
+
+// NewReader returns a reader for the records in r, file is used in errors
+func NewReader(r io.Reader, file string) *Reader {
+	s := bufio.NewScanner(r)
+	s.Buffer(make([]byte, 0, 64<<10), maxLine)
+	return &Reader{File: file, scanner: s}
+}
+
+// Open opens a log file, it can be compressed (e.g. http.log.gz)
+func Open(path string) (*Reader, error) {
+	rc, err := decompress.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	r := NewReader(rc, path)
+	r.closer = rc
+	return r, nil
+}
+
+// Close closes the file if the reader was created with Open
+func (r *Reader) Close() error {
+	if r.closer == nil {
+		return nil
+	}
+	return r.closer.Close()
+}
+
+// Line returns the line number of the last record read
+func (r *Reader) Line() int {
+	return r.line
+}
+
+// Malformed returns the malformed lines seen so far, up to MaxMalformed
+func (r *Reader) Malformed() []*ParseError {
+	return r.malformed
+}
+
+// BadLines returns the number of malformed lines seen so far, including the
+// ones not kept
+func (r *Reader) BadLines() int {
+	return r.bad
+}
+
+// Read returns the next record, io.EOF at the end. Malformed lines are
+// skipped, blank lines are ignored. Errors are from reading the stream and
+// are final.
+func (r *Reader) Read() (Record, error) {
+	for r.scanner.Scan() {
+		r.line++
+		text := strings.TrimSuffix(r.scanner.Text(), "\r")
+		if strings.TrimSpace(text) == "" {
+			continue
+		}
+
+		rec, err := ParseLine(text)
+		if err == nil {
+			return rec, nil
+		}
+
+		r.bad++
+		max := r.MaxMalformed
+		if max == 0 {
+			max = DefaultMaxMalformed
+		}
+		if len(r.malformed) < max {
+			r.malformed = append(r.malformed, &ParseError{File: r.File, Line: r.line, Text: text, Err: err})
+		}
+	}
+
+	if err := r.scanner.Err(); err != nil {
+		if r.File != "" {
+			return Record{}, fmt.Errorf("%s:%d: %w", r.File, r.line+1, err)
+		}
+		return Record{}, err
+	}
+	return Record{}, io.EOF
+}
+
+var (
+	errHost       = errors.New("missing host")
+	errIdent      = errors.New("missing ident or user")
+	errTime       = errors.New("missing [timestamp]")
+	errRequest    = errors.New("missing \"request\"")
+	errPath       = errors.New("request without a path")
+	errStatusSize = errors.New("missing status or size")
+	errStatus     = errors.New("bad status")
+	errBytes      = errors.New("bad size")
+	errCombined   = errors.New("bad referer or user agent")
+)
+
+// ParseLine parses a CLF or Combined line
+func ParseLine(line string) (Record, error) {
+	var rec Record
+	var ok bool
+
+	if rec.Host, line, ok = strings.Cut(line, " "); !ok || rec.Host == "" {
+		return Record{}, errHost
+	}
+	var ident, user string
+	if ident, line, ok = strings.Cut(line, " "); !ok {
+		return Record{}, errIdent
+	}
+	if user, line, ok = strings.Cut(line, " "); !ok {
+		return Record{}, errIdent
+	}
+	rec.Ident, rec.User = dash(ident), dash(user)
+
+	if !strings.HasPrefix(line, "[") {
+		return Record{}, errTime
+	}
+	ts, line, ok := strings.Cut(line[1:], "] ")
+	if !ok {
+		return Record{}, errTime
+	}
+	t, err := time.Parse(TimeLayout, ts)
+	if err != nil {
+		return Record{}, fmt.Errorf("bad timestamp: %q", ts)
+	}
+	rec.Time = t
+
+	if !strings.HasPrefix(line, `"`) {
+		return Record{}, errRequest
+	}
+	line = line[1:]
+
+	// Combined: ... status bytes "referer" "user agent"
+	if strings.HasSuffix(line, `"`) {
+		i := strings.LastIndex(line[:len(line)-1], ` "`)
+		if i < 0 {
+			return Record{}, errCombined
+		}
+		rec.UserAgent = dash(line[i+2 : len(line)-1])
+		line = line[:i]
+		if !strings.HasSuffix(line, `"`) {
+			return Record{}, errCombined
+		}
+		i = strings.LastIndex(line[:len(line)-1], ` "`)
+		if i < 0 {
+			return Record{}, errCombined
+		}
+		rec.Referer = dash(line[i+2 : len(line)-1])
+		line = line[:i]
+	}
+
+	i := strings.LastIndexByte(line, ' ')
+	if i < 0 {
+		return Record{}, errStatusSize
+	}
+	size := line[i+1:]
+	line = line[:i]
+	if size == "-" {
+		rec.Bytes = -1
+	} else if rec.Bytes, err = strconv.ParseInt(size, 10, 64); err != nil || rec.Bytes < 0 {
+		return Record{}, fmt.Errorf("%w: %q", errBytes, size)
+	}
+
+	i = strings.LastIndexByte(line, ' ')
+	if i < 0 {
+		return Record{}, errStatusSize
+	}
+	status := line[i+1:]
+	line = line[:i]
+	if rec.Status, err = strconv.Atoi(status); err != nil || rec.Status < 100 || rec.Status > 599 {
+		return Record{}, fmt.Errorf("%w: %q", errStatus, status)
+	}
+
+	if !strings.HasSuffix(line, `"`) {
+		return Record{}, errRequest
+	}
+	rec.Request = line[:len(line)-1]
+	if err := parseRequest(&rec); err != nil {
+		return Record{}, err
+	}
+	return rec, nil
+}
+
+// parseRequest splits rec.Request to method, path and protocol. The path can
+// have spaces in it.
+func parseRequest(rec *Record) error {
+	method, rest, _ := strings.Cut(rec.Request, " ")
+	rest = strings.TrimSpace(rest)
+	if method == "" || rest == "" {
+		return fmt.Errorf("%w: %q", errPath, rec.Request)
+	}
+	if i := strings.LastIndexByte(rest, ' '); i >= 0 && strings.HasPrefix(rest[i+1:], "HTTP/") {
+		rec.Protocol = rest[i+1:]
+		rest = strings.TrimSpace(rest[:i])
+	}
+	rec.Method, rec.Path = method, rest
+	return nil
+}
+
+// dash returns "" for "-", which is used for missing fields
+func dash(s string) string {
+	if s == "-" {
+		return ""
+	}
+	return s
+}
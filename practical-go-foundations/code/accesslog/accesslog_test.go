@@ -0,0 +1,147 @@
+package accesslog
+
+import (
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseLine(t *testing.T) {
+	edt := time.FixedZone("", -4*60*60)
+	cases := []struct {
+		line string
+		want Record
+	}{
+		{
+			`in24.inetnebr.com - - [01/Aug/1995:00:00:01 -0400] "GET /shuttle/missions/sts-68/news/sts-68-mcc-05.txt HTTP/1.0" 200 1839`,
+			Record{
+				Host:     "in24.inetnebr.com",
+				Time:     time.Date(1995, 8, 1, 0, 0, 1, 0, edt),
+				Request:  "GET /shuttle/missions/sts-68/news/sts-68-mcc-05.txt HTTP/1.0",
+				Method:   "GET",
+				Path:     "/shuttle/missions/sts-68/news/sts-68-mcc-05.txt",
+				Protocol: "HTTP/1.0",
+				Status:   200,
+				Bytes:    1839,
+			},
+		},
+		{
+			`uplherc.upl.com - - [01/Aug/1995:00:00:07 -0400] "GET / HTTP/1.0" 304 -`,
+			Record{Host: "uplherc.upl.com", Time: time.Date(1995, 8, 1, 0, 0, 7, 0, edt), Request: "GET / HTTP/1.0", Method: "GET", Path: "/", Protocol: "HTTP/1.0", Status: 304, Bytes: -1},
+		},
+		{
+			// HTTP/0.9, no protocol
+			`h - - [01/Aug/1995:00:00:07 -0400] "GET /index.html" 200 10`,
+			Record{Host: "h", Time: time.Date(1995, 8, 1, 0, 0, 7, 0, edt), Request: "GET /index.html", Method: "GET", Path: "/index.html", Status: 200, Bytes: 10},
+		},
+		{
+			// Spaces and a quote in the request
+			`h - - [01/Aug/1995:00:00:07 -0400] "GET /a " b   HTTP/1.0" 404 -`,
+			Record{Host: "h", Time: time.Date(1995, 8, 1, 0, 0, 7, 0, edt), Request: `GET /a " b   HTTP/1.0`, Method: "GET", Path: `/a " b`, Protocol: "HTTP/1.0", Status: 404, Bytes: -1},
+		},
+		{
+			// Combined
+			`127.0.0.1 ident frank [10/Oct/2000:13:55:36 -0700] "GET /apache_pb.gif HTTP/1.0" 200 2326 "http://www.example.com/start.html" "Mozilla/4.08 [en] (Win98; I ;Nav)"`,
+			Record{
+				Host:      "127.0.0.1",
+				Ident:     "ident",
+				User:      "frank",
+				Time:      time.Date(2000, 10, 10, 13, 55, 36, 0, time.FixedZone("", -7*60*60)),
+				Request:   "GET /apache_pb.gif HTTP/1.0",
+				Method:    "GET",
+				Path:      "/apache_pb.gif",
+				Protocol:  "HTTP/1.0",
+				Status:    200,
+				Bytes:     2326,
+				Referer:   "http://www.example.com/start.html",
+				UserAgent: "Mozilla/4.08 [en] (Win98; I ;Nav)",
+			},
+		},
+		{
+			`h - - [01/Aug/1995:00:00:07 -0400] "GET / HTTP/1.1" 200 5 "-" "-"`,
+			Record{Host: "h", Time: time.Date(1995, 8, 1, 0, 0, 7, 0, edt), Request: "GET / HTTP/1.1", Method: "GET", Path: "/", Protocol: "HTTP/1.1", Status: 200, Bytes: 5},
+		},
+	}
+	for _, tc := range cases {
+		got, err := ParseLine(tc.line)
+		if err != nil {
+			t.Errorf("%s: %s", tc.line, err)
+			continue
+		}
+		if !got.Time.Equal(tc.want.Time) {
+			t.Errorf("%s: time %v, want %v", tc.line, got.Time, tc.want.Time)
+		}
+		got.Time = tc.want.Time
+		if got != tc.want {
+			t.Errorf("%s:\ngot  %+v\nwant %+v", tc.line, got, tc.want)
+		}
+	}
+}
+
+func TestParseLineErrors(t *testing.T) {
+	cases := []struct {
+		line string
+		err  error
+	}{
+		{"nohost", errHost},
+		{"h -", errIdent},
+		{"h - - 01/Aug/1995:00:00:07 -0400", errTime},
+		{"h - - [01/Aug/1995:00:00:07 -0400] GET / 200 1", errRequest},
+		{`h - - [01/Aug/1995:00:00:07 -0400] "GET / HTTP/1.0" 2000 1`, errStatus},
+		{`h - - [01/Aug/1995:00:00:07 -0400] "GET / HTTP/1.0" 200 x`, errBytes},
+		{`h - - [01/Aug/1995:00:00:07 -0400] "GET / HTTP/1.0" 200 -1`, errBytes},
+		{`h - - [01/Aug/1995:00:00:07 -0400] "GET" 200 1`, errPath},
+		{`h - - [01/Aug/1995:00:00:07 -0400] "GET / HTTP/1.0" 200 1 "ua"`, errCombined},
+	}
+	for _, tc := range cases {
+		if _, err := ParseLine(tc.line); !errors.Is(err, tc.err) {
+			t.Errorf("%s: got error %v, want %v", tc.line, err, tc.err)
+		}
+	}
+
+	if _, err := ParseLine(`h - - [32/Aug/1995:00:00:07 -0400] "GET / HTTP/1.0" 200 1`); err == nil {
+		t.Error("bad timestamp: no error")
+	}
+}
+
+func TestReader(t *testing.T) {
+	log := strings.Join([]string{
+		`a - - [01/Aug/1995:00:00:01 -0400] "GET / HTTP/1.0" 200 1`,
+		``,
+		`garbage`,
+		`b - - [01/Aug/1995:00:00:02 -0400] "GET /x HTTP/1.0" 404 -` + "\r",
+		`more garbage`,
+		`c - - [01/Aug/1995:00:00:03 -0400] "GET /y HTTP/1.0" 200 2`,
+	}, "\n")
+
+	r := NewReader(strings.NewReader(log), "http.log")
+	r.MaxMalformed = 1
+	var hosts []string
+	var lines []int
+	for {
+		rec, err := r.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		hosts = append(hosts, rec.Host)
+		lines = append(lines, r.Line())
+	}
+
+	if got := strings.Join(hosts, ","); got != "a,b,c" {
+		t.Errorf("hosts %s, want a,b,c", got)
+	}
+	if lines[1] != 4 || lines[2] != 6 {
+		t.Errorf("lines %v, want [1 4 6]", lines)
+	}
+	if r.BadLines() != 2 || len(r.Malformed()) != 1 {
+		t.Fatalf("%d bad lines, %d kept; want 2 and 1", r.BadLines(), len(r.Malformed()))
+	}
+	if pe := r.Malformed()[0]; pe.Line != 3 || pe.Text != "garbage" || !strings.HasPrefix(pe.Error(), "http.log:3: ") {
+		t.Errorf("malformed %+v", pe)
+	}
+}
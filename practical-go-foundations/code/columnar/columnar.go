@@ -0,0 +1,596 @@
+// Package columnar is a compact columnar file format for taxi trips, so
+// analyses don't have to decompress bzip2 and parse CSV every time.
+//
+// Rows are stored in blocks (BlockRows rows each), a block has a chunk per
+// column. Every value is an int64 (times are Unix seconds, money is cents,
+// distance is 1/100 miles) and each chunk uses the smallest of these
+// encodings:
+//
+//	plain  zigzag varints
+//	delta  first value, then differences from the previous value (timestamps)
+//	dict   distinct values, then a byte index per row (small cardinality codes)
+//
+// The footer has the offset, encoding and min/max of every chunk. Readers load
+// only the chunks of the columns they need and skip blocks whose stats can't
+// match. Times are read back in UTC, like trip.Reader parses them by default.
+//
+//	"TRIPCOL\x01" chunks... footer (JSON) footer-length (uint32 LE) "TRIPCOL\x01"
+package columnar
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"strconv"
+	"time"
+
+	"day1/trip"
+)
+
+const (
+	magic   = "TRIPCOL\x01"
+	version = 1
+
+	// BlockRows is the default number of rows in a block
+	BlockRows = 64 * 1024
+)
+
+// Kind is how a column value maps to a trip field
+type Kind int
+
+const (
+	Int      Kind = iota // codes, counts, location IDs
+	Time                 // Unix seconds
+	Money                // cents
+	Distance             // 1/100 miles
+	Flag                 // 0 or 1
+)
+
+// Column is a column in the file, names are the CSV header names
+type Column struct {
+	Name string
+	Kind Kind
+	get  func(t *trip.Trip) int64
+	set  func(t *trip.Trip, v int64)
+}
+
+// Format returns v as in the CSV files
+func (c *Column) Format(v int64) string {
+	switch c.Kind {
+	case Time:
+		return time.Unix(v, 0).UTC().Format(trip.TimeLayout)
+	case Money:
+		return trip.Cents(v).String()
+	case Distance:
+		return strconv.FormatFloat(float64(v)/100, 'f', 2, 64)
+	case Flag:
+		if v != 0 {
+			return "Y"
+		}
+		return "N"
+	}
+	return strconv.FormatInt(v, 10)
+}
+
+// DateLayout is a time value without the time of day, Parse accepts it for
+// time columns
+const DateLayout = "2006-01-02"
+
+// Parse parses s as in the CSV files to a column value. Time columns also
+// take a date (DateLayout), which is midnight.
+func (c *Column) Parse(s string) (int64, error) {
+	switch c.Kind {
+	case Time:
+		t, err := time.Parse(trip.TimeLayout, s)
+		if err != nil {
+			if t, err = time.Parse(DateLayout, s); err != nil {
+				return 0, fmt.Errorf("bad time %q, should be %s or %s", s, trip.TimeLayout, DateLayout)
+			}
+		}
+		return t.Unix(), nil
+	case Money:
+		v, err := trip.ParseCents(s)
+		return int64(v), err
+	case Distance:
+		f, err := strconv.ParseFloat(s, 64)
+		if err != nil {
+			return 0, err
+		}
+		return hundredths(f), nil
+	case Flag:
+		switch s {
+		case "Y":
+			return 1, nil
+		case "N":
+			return 0, nil
+		}
+		return 0, fmt.Errorf("bad flag: %q", s)
+	}
+	return strconv.ParseInt(s, 10, 64)
+}
+
+func hundredths(f float64) int64 {
+	return int64(math.Round(f * 100))
+}
+
+// Columns are the columns of a file, in file order
+var Columns = []*Column{
+	{"VendorID", Int, func(t *trip.Trip) int64 { return int64(t.Vendor) }, func(t *trip.Trip, v int64) { t.Vendor = trip.Vendor(v) }},
+	{"tpep_pickup_datetime", Time, func(t *trip.Trip) int64 { return t.Pickup.Unix() }, func(t *trip.Trip, v int64) { t.Pickup = time.Unix(v, 0).UTC() }},
+	{"tpep_dropoff_datetime", Time, func(t *trip.Trip) int64 { return t.Dropoff.Unix() }, func(t *trip.Trip, v int64) { t.Dropoff = time.Unix(v, 0).UTC() }},
+	{"passenger_count", Int, func(t *trip.Trip) int64 { return int64(t.Passengers) }, func(t *trip.Trip, v int64) { t.Passengers = int(v) }},
+	{"trip_distance", Distance, func(t *trip.Trip) int64 { return hundredths(t.Distance) }, func(t *trip.Trip, v int64) { t.Distance = float64(v) / 100 }},
+	{"RatecodeID", Int, func(t *trip.Trip) int64 { return int64(t.RateCode) }, func(t *trip.Trip, v int64) { t.RateCode = trip.RateCode(v) }},
+	{"store_and_fwd_flag", Flag, func(t *trip.Trip) int64 { return boolInt(t.StoreAndForward) }, func(t *trip.Trip, v int64) { t.StoreAndForward = v != 0 }},
+	{"PULocationID", Int, func(t *trip.Trip) int64 { return int64(t.PickupLocation) }, func(t *trip.Trip, v int64) { t.PickupLocation = int(v) }},
+	{"DOLocationID", Int, func(t *trip.Trip) int64 { return int64(t.DropoffLocation) }, func(t *trip.Trip, v int64) { t.DropoffLocation = int(v) }},
+	{"payment_type", Int, func(t *trip.Trip) int64 { return int64(t.PaymentType) }, func(t *trip.Trip, v int64) { t.PaymentType = trip.PaymentType(v) }},
+	{"fare_amount", Money, func(t *trip.Trip) int64 { return int64(t.Fare) }, func(t *trip.Trip, v int64) { t.Fare = trip.Cents(v) }},
+	{"extra", Money, func(t *trip.Trip) int64 { return int64(t.Extra) }, func(t *trip.Trip, v int64) { t.Extra = trip.Cents(v) }},
+	{"mta_tax", Money, func(t *trip.Trip) int64 { return int64(t.MTATax) }, func(t *trip.Trip, v int64) { t.MTATax = trip.Cents(v) }},
+	{"tip_amount", Money, func(t *trip.Trip) int64 { return int64(t.Tip) }, func(t *trip.Trip, v int64) { t.Tip = trip.Cents(v) }},
+	{"tolls_amount", Money, func(t *trip.Trip) int64 { return int64(t.Tolls) }, func(t *trip.Trip, v int64) { t.Tolls = trip.Cents(v) }},
+	{"improvement_surcharge", Money, func(t *trip.Trip) int64 { return int64(t.ImprovementSurcharge) }, func(t *trip.Trip, v int64) { t.ImprovementSurcharge = trip.Cents(v) }},
+	{"total_amount", Money, func(t *trip.Trip) int64 { return int64(t.Total) }, func(t *trip.Trip, v int64) { t.Total = trip.Cents(v) }},
+}
+
+func boolInt(b bool) int64 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// ColumnByName returns the column called name, nil if there's none
+func ColumnByName(name string) *Column {
+	for _, c := range Columns {
+		if c.Name == name {
+			return c
+		}
+	}
+	return nil
+}
+
+// Chunk encodings
+const (
+	encPlain = "plain"
+	encDelta = "delta"
+	encDict  = "dict"
+)
+
+// footer is the file metadata
+type footer struct {
+	Version int         `json:"version"`
+	Columns []string    `json:"columns"`
+	Rows    int64       `json:"rows"`
+	Blocks  []blockMeta `json:"blocks"`
+}
+
+type blockMeta struct {
+	Rows   int         `json:"rows"`
+	Chunks []chunkMeta `json:"chunks"` // same order as the columns
+}
+
+type chunkMeta struct {
+	Offset   int64  `json:"offset"`
+	Length   int64  `json:"length"`
+	Encoding string `json:"encoding"`
+	Min      int64  `json:"min"`
+	Max      int64  `json:"max"`
+}
+
+// Writer writes trips to a columnar file
+type Writer struct {
+	BlockRows int // rows per block, set before the first Write
+
+	w      *bufio.Writer
+	offset int64
+	cols   [][]int64 // values of the current block, by column
+	footer footer
+	err    error
+}
+
+// NewWriter returns a writer to w, call Close to write the footer
+func NewWriter(w io.Writer) *Writer {
+	cw := &Writer{
+		BlockRows: BlockRows,
+		w:         bufio.NewWriter(w),
+		cols:      make([][]int64, len(Columns)),
+		footer:    footer{Version: version},
+	}
+	for _, c := range Columns {
+		cw.footer.Columns = append(cw.footer.Columns, c.Name)
+	}
+	cw.write([]byte(magic))
+	return cw
+}
+
+func (w *Writer) write(data []byte) {
+	if w.err != nil {
+		return
+	}
+	n, err := w.w.Write(data)
+	w.offset += int64(n)
+	w.err = err
+}
+
+// Write adds a trip
+func (w *Writer) Write(t *trip.Trip) error {
+	for i, c := range Columns {
+		w.cols[i] = append(w.cols[i], c.get(t))
+	}
+	if len(w.cols[0]) >= w.BlockRows {
+		w.flush()
+	}
+	return w.err
+}
+
+// flush writes the current block
+func (w *Writer) flush() {
+	rows := len(w.cols[0])
+	if rows == 0 {
+		return
+	}
+
+	bm := blockMeta{Rows: rows}
+	for i, values := range w.cols {
+		enc, data := encode(values)
+		min, max := values[0], values[0]
+		for _, v := range values {
+			if v < min {
+				min = v
+			}
+			if v > max {
+				max = v
+			}
+		}
+		bm.Chunks = append(bm.Chunks, chunkMeta{w.offset, int64(len(data)), enc, min, max})
+		w.write(data)
+		w.cols[i] = values[:0]
+	}
+	w.footer.Blocks = append(w.footer.Blocks, bm)
+	w.footer.Rows += int64(rows)
+}
+
+// Close writes the last block and the footer, it doesn't close the
+// underlying writer
+func (w *Writer) Close() error {
+	w.flush()
+
+	data, err := json.Marshal(w.footer)
+	if err != nil {
+		return err
+	}
+	w.write(data)
+	w.write(binary.LittleEndian.AppendUint32(nil, uint32(len(data))))
+	w.write([]byte(magic))
+	if w.err != nil {
+		return w.err
+	}
+	return w.w.Flush()
+}
+
+// encode returns the smallest encoding of values
+func encode(values []int64) (string, []byte) {
+	enc, best := encPlain, encodePlain(values)
+	if data := encodeDelta(values); len(data) < len(best) {
+		enc, best = encDelta, data
+	}
+	if data, ok := encodeDict(values); ok && len(data) < len(best) {
+		enc, best = encDict, data
+	}
+	return enc, best
+}
+
+func encodePlain(values []int64) []byte {
+	var data []byte
+	for _, v := range values {
+		data = binary.AppendVarint(data, v)
+	}
+	return data
+}
+
+func encodeDelta(values []int64) []byte {
+	var data []byte
+	prev := int64(0)
+	for _, v := range values {
+		data = binary.AppendVarint(data, v-prev)
+		prev = v
+	}
+	return data
+}
+
+// encodeDict fails if there are more than 256 distinct values
+func encodeDict(values []int64) ([]byte, bool) {
+	index := make(map[int64]int)
+	var dict []int64
+	for _, v := range values {
+		if _, ok := index[v]; !ok {
+			if len(dict) == 256 {
+				return nil, false
+			}
+			index[v] = len(dict)
+			dict = append(dict, v)
+		}
+	}
+
+	data := binary.AppendUvarint(nil, uint64(len(dict)))
+	for _, v := range dict {
+		data = binary.AppendVarint(data, v)
+	}
+	for _, v := range values {
+		data = append(data, byte(index[v]))
+	}
+	return data, true
+}
+
+var errCorrupt = errors.New("corrupt chunk")
+
+// decode decodes rows values of a chunk. Every encoding takes at least a byte
+// per value, so more rows than bytes is a corrupt chunk.
+func decode(enc string, data []byte, rows int) ([]int64, error) {
+	if rows <= 0 || rows > len(data) {
+		return nil, errCorrupt
+	}
+	values := make([]int64, rows)
+	switch enc {
+	case encPlain, encDelta:
+		prev := int64(0)
+		for i := range values {
+			v, n := binary.Varint(data)
+			if n <= 0 {
+				return nil, errCorrupt
+			}
+			data = data[n:]
+			if enc == encDelta {
+				v += prev
+				prev = v
+			}
+			values[i] = v
+		}
+	case encDict:
+		size, n := binary.Uvarint(data)
+		if n <= 0 || size > 256 {
+			return nil, errCorrupt
+		}
+		data = data[n:]
+		dict := make([]int64, size)
+		for i := range dict {
+			v, n := binary.Varint(data)
+			if n <= 0 {
+				return nil, errCorrupt
+			}
+			dict[i], data = v, data[n:]
+		}
+		if len(data) != rows {
+			return nil, errCorrupt
+		}
+		for i, b := range data {
+			if int(b) >= len(dict) {
+				return nil, errCorrupt
+			}
+			values[i] = dict[b]
+		}
+		return values, nil
+	default:
+		return nil, fmt.Errorf("unknown encoding: %q", enc)
+	}
+
+	if len(data) != 0 {
+		return nil, errCorrupt
+	}
+	return values, nil
+}
+
+// Reader reads a columnar file
+type Reader struct {
+	file   *os.File
+	footer footer
+	cols   []int // file column index by Columns index
+}
+
+// Open opens a columnar file and reads its footer
+func Open(path string) (*Reader, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	r, err := newReader(file)
+	if err != nil {
+		file.Close()
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return r, nil
+}
+
+func newReader(file *os.File) (*Reader, error) {
+	info, err := file.Stat()
+	if err != nil {
+		return nil, err
+	}
+
+	trailer := make([]byte, 4+len(magic))
+	size := info.Size()
+	if size < int64(len(magic)+len(trailer)) {
+		return nil, errors.New("not a columnar file")
+	}
+	if _, err := file.ReadAt(trailer, size-int64(len(trailer))); err != nil {
+		return nil, err
+	}
+	head := make([]byte, len(magic))
+	if _, err := file.ReadAt(head, 0); err != nil {
+		return nil, err
+	}
+	if string(head) != magic || string(trailer[4:]) != magic {
+		return nil, errors.New("not a columnar file")
+	}
+
+	n := int64(binary.LittleEndian.Uint32(trailer))
+	if n > size-int64(len(magic)+len(trailer)) {
+		return nil, errors.New("bad footer length")
+	}
+	data := make([]byte, n)
+	if _, err := file.ReadAt(data, size-int64(len(trailer))-n); err != nil {
+		return nil, err
+	}
+
+	r := &Reader{file: file}
+	if err := json.Unmarshal(data, &r.footer); err != nil {
+		return nil, fmt.Errorf("bad footer: %w", err)
+	}
+	if r.footer.Version != version {
+		return nil, fmt.Errorf("unknown version %d", r.footer.Version)
+	}
+
+	byName := make(map[string]int)
+	for i, name := range r.footer.Columns {
+		byName[name] = i
+	}
+	for _, c := range Columns {
+		i, ok := byName[c.Name]
+		if !ok {
+			return nil, fmt.Errorf("missing column %q", c.Name)
+		}
+		r.cols = append(r.cols, i)
+	}
+	// Don't trust the footer, rows and chunk sizes are used to allocate
+	end := size - int64(len(trailer)) - n // chunks are before the footer
+	var rows int64
+	for i, b := range r.footer.Blocks {
+		if len(b.Chunks) != len(r.footer.Columns) {
+			return nil, fmt.Errorf("block %d: %d chunks for %d columns", i, len(b.Chunks), len(r.footer.Columns))
+		}
+		if b.Rows <= 0 {
+			return nil, fmt.Errorf("block %d: bad number of rows %d", i, b.Rows)
+		}
+		for _, ch := range b.Chunks {
+			if ch.Offset < int64(len(magic)) || ch.Offset > end || ch.Length < 0 || ch.Length > end-ch.Offset {
+				return nil, fmt.Errorf("block %d: chunk out of file", i)
+			}
+			if int64(b.Rows) > ch.Length { // at least a byte per value
+				return nil, fmt.Errorf("block %d: %d rows don't fit in a %d bytes chunk", i, b.Rows, ch.Length)
+			}
+		}
+		rows += int64(b.Rows)
+	}
+	if rows != r.footer.Rows {
+		return nil, fmt.Errorf("footer has %d rows, blocks have %d", r.footer.Rows, rows)
+	}
+	return r, nil
+}
+
+// Close closes the file
+func (r *Reader) Close() error {
+	return r.file.Close()
+}
+
+// Rows returns the number of rows in the file
+func (r *Reader) Rows() int64 {
+	return r.footer.Rows
+}
+
+// Blocks returns the number of blocks in the file
+func (r *Reader) Blocks() int {
+	return len(r.footer.Blocks)
+}
+
+// Range is a condition on a column value, Min <= value <= Max
+type Range struct {
+	Column *Column
+	Min    int64
+	Max    int64
+}
+
+// Match returns true if v is in the range
+func (rg Range) Match(v int64) bool {
+	return v >= rg.Min && v <= rg.Max
+}
+
+// Batch is the rows of a block, only the scanned columns are loaded
+type Batch struct {
+	Block int
+	Rows  int
+	cols  map[*Column][]int64
+}
+
+// Values returns the values of c, nil if it wasn't scanned
+func (b *Batch) Values(c *Column) []int64 {
+	return b.cols[c]
+}
+
+// Trip returns row i as a trip, fields of columns that weren't scanned are
+// zero
+func (b *Batch) Trip(i int) trip.Trip {
+	var t trip.Trip
+	for c, values := range b.cols {
+		c.set(&t, values[i])
+	}
+	return t
+}
+
+// ScanStats are the number of blocks read and skipped by a scan
+type ScanStats struct {
+	Read    int
+	Skipped int
+}
+
+// Scan calls fn with a batch per block, loading only the columns in cols.
+// Blocks whose min/max stats don't overlap all the ranges in where are
+// skipped without reading them, rows in the other blocks are not filtered.
+// Range columns must be in cols.
+func (r *Reader) Scan(cols []*Column, where []Range, fn func(b *Batch) error) (ScanStats, error) {
+	var stats ScanStats
+	index := make(map[*Column]int) // Columns index
+	for i, c := range Columns {
+		index[c] = i
+	}
+	for _, c := range cols {
+		if _, ok := index[c]; !ok {
+			return stats, fmt.Errorf("unknown column %v", c.Name)
+		}
+	}
+
+	for bi, b := range r.footer.Blocks {
+		skip := false
+		for _, rg := range where {
+			i, ok := index[rg.Column]
+			if !ok {
+				return stats, fmt.Errorf("unknown column %v", rg.Column.Name)
+			}
+			ch := b.Chunks[r.cols[i]]
+			if ch.Max < rg.Min || ch.Min > rg.Max {
+				skip = true
+				break
+			}
+		}
+		if skip {
+			stats.Skipped++
+			continue
+		}
+
+		batch := &Batch{Block: bi, Rows: b.Rows, cols: make(map[*Column][]int64)}
+		for _, c := range cols {
+			ch := b.Chunks[r.cols[index[c]]]
+			data := make([]byte, ch.Length)
+			if _, err := r.file.ReadAt(data, ch.Offset); err != nil {
+				return stats, err
+			}
+			values, err := decode(ch.Encoding, data, b.Rows)
+			if err != nil {
+				return stats, fmt.Errorf("block %d: %s: %w", bi, c.Name, err)
+			}
+			batch.cols[c] = values
+		}
+		stats.Read++
+
+		if err := fn(batch); err != nil {
+			return stats, err
+		}
+	}
+	return stats, nil
+}
@@ -0,0 +1,246 @@
+package columnar
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"day1/trip"
+)
+
+func testTrips(n int) []trip.Trip {
+	start := time.Date(2018, 5, 1, 0, 0, 0, 0, time.UTC)
+	trips := make([]trip.Trip, n)
+	for i := range trips {
+		pickup := start.Add(time.Duration(i) * time.Minute)
+		trips[i] = trip.Trip{
+			Vendor:          trip.Vendor(1 + i%2),
+			Pickup:          pickup,
+			Dropoff:         pickup.Add(time.Duration(5+i%7) * time.Minute),
+			Passengers:      1 + i%4,
+			Distance:        float64(i%50) / 10,
+			RateCode:        1,
+			StoreAndForward: i%10 == 0,
+			PickupLocation:  100 + i%30,
+			DropoffLocation: 200 + i%40,
+			PaymentType:     1,
+			Fare:            trip.Cents(250 + 10*i),
+			MTATax:          50,
+			Tip:             trip.Cents(i % 300),
+			Total:           trip.Cents(300 + 10*i + i%300),
+		}
+	}
+	return trips
+}
+
+// writeFile writes trips to a file in blocks of blockRows
+func writeFile(t *testing.T, trips []trip.Trip, blockRows int) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "trips.col")
+	file, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	w := NewWriter(file)
+	w.BlockRows = blockRows
+	for i := range trips {
+		if err := w.Write(&trips[i]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestRoundTrip(t *testing.T) {
+	trips := testTrips(1000)
+	r, err := Open(writeFile(t, trips, 300))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	if r.Rows() != 1000 || r.Blocks() != 4 {
+		t.Fatalf("%d rows in %d blocks, want 1000 in 4", r.Rows(), r.Blocks())
+	}
+
+	var got []trip.Trip
+	stats, err := r.Scan(Columns, nil, func(b *Batch) error {
+		for i := 0; i < b.Rows; i++ {
+			got = append(got, b.Trip(i))
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.Read != 4 || stats.Skipped != 0 {
+		t.Errorf("stats %+v", stats)
+	}
+	if !reflect.DeepEqual(got, trips) {
+		t.Error("trips read back differ")
+	}
+}
+
+func TestScanSkipsBlocks(t *testing.T) {
+	trips := testTrips(1000) // fares go up with i
+	r, err := Open(writeFile(t, trips, 100))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	fare := ColumnByName("fare_amount")
+	where := []Range{{Column: fare, Min: int64(trips[250].Fare), Max: int64(trips[260].Fare)}}
+	matched := 0
+	stats, err := r.Scan([]*Column{fare}, where, func(b *Batch) error {
+		if b.Block != 2 {
+			t.Errorf("read block %d", b.Block)
+		}
+		if b.Values(ColumnByName("tip_amount")) != nil {
+			t.Error("column that wasn't scanned is loaded")
+		}
+		for _, v := range b.Values(fare) {
+			if where[0].Match(v) {
+				matched++
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.Read != 1 || stats.Skipped != 9 {
+		t.Errorf("stats %+v, want 1 read and 9 skipped", stats)
+	}
+	if matched != 11 {
+		t.Errorf("%d rows match, want 11", matched)
+	}
+}
+
+func TestEncodings(t *testing.T) {
+	cases := map[string][]int64{
+		encPlain: {5, -1000000, 77, 123456789, -3},
+		encDelta: {1525132800, 1525132860, 1525132920, 1525132980, 1525133040, 1525133100},
+		encDict:  {2500, 2500, 500, 2500, 500, 1000, 1000, 2500, 500, 2500},
+	}
+	for want, values := range cases {
+		enc, data := encode(values)
+		if enc != want {
+			t.Errorf("%v: encoding %s, want %s", values, enc, want)
+		}
+		got, err := decode(enc, data, len(values))
+		if err != nil || !reflect.DeepEqual(got, values) {
+			t.Errorf("%s: decoded %v, %v; want %v", enc, got, err, values)
+		}
+
+		if _, err := decode(enc, data[:len(data)-1], len(values)); err == nil {
+			t.Errorf("%s: no error for a truncated chunk", enc)
+		}
+		if _, err := decode(enc, data, len(data)+1); err == nil {
+			t.Errorf("%s: no error for more rows than bytes", enc)
+		}
+	}
+}
+
+// writeRaw writes a file with chunks and a footer
+func writeRaw(t *testing.T, chunks []byte, f footer) string {
+	t.Helper()
+	footer, err := json.Marshal(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := append([]byte(magic), chunks...)
+	data = append(data, footer...)
+	data = binary.LittleEndian.AppendUint32(data, uint32(len(footer)))
+	data = append(data, magic...)
+
+	path := filepath.Join(t.TempDir(), "bad.col")
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestBadFooter(t *testing.T) {
+	var names []string
+	for _, c := range Columns {
+		names = append(names, c.Name)
+	}
+	chunks := func(offset, length int64) []chunkMeta {
+		cm := make([]chunkMeta, len(Columns))
+		for i := range cm {
+			cm[i] = chunkMeta{Offset: offset, Length: length, Encoding: encPlain}
+		}
+		return cm
+	}
+	data := make([]byte, 10) // ten zero varints
+	off := int64(len(magic))
+
+	cases := map[string]footer{
+		"out of file":     {Version: version, Columns: names, Rows: 10, Blocks: []blockMeta{{10, chunks(off, 1<<40)}}},
+		"overflow":        {Version: version, Columns: names, Rows: 10, Blocks: []blockMeta{{10, chunks(1<<62, 1<<62)}}},
+		"too many rows":   {Version: version, Columns: names, Rows: 1 << 40, Blocks: []blockMeta{{1 << 40, chunks(off, 10)}}},
+		"no rows":         {Version: version, Columns: names, Rows: 0, Blocks: []blockMeta{{0, chunks(off, 10)}}},
+		"rows don't add":  {Version: version, Columns: names, Rows: 20, Blocks: []blockMeta{{10, chunks(off, 10)}}},
+		"missing chunks":  {Version: version, Columns: names, Rows: 10, Blocks: []blockMeta{{10, chunks(off, 10)[:3]}}},
+		"missing column":  {Version: version, Columns: names[1:], Rows: 0},
+		"unknown version": {Version: version + 1, Columns: names, Rows: 0},
+	}
+	for name, f := range cases {
+		if r, err := Open(writeRaw(t, data, f)); err == nil {
+			r.Close()
+			t.Errorf("%s: no error", name)
+		}
+	}
+
+	// The same chunks with a good footer are fine
+	good := footer{Version: version, Columns: names, Rows: 10, Blocks: []blockMeta{{10, chunks(off, 10)}}}
+	r, err := Open(writeRaw(t, data, good))
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.Close()
+}
+
+func TestParse(t *testing.T) {
+	pickup := ColumnByName("tpep_pickup_datetime")
+	cases := []struct {
+		col  string
+		s    string
+		want int64
+	}{
+		{"tpep_pickup_datetime", "2018-05-01 00:13:56", time.Date(2018, 5, 1, 0, 13, 56, 0, time.UTC).Unix()},
+		{"tpep_pickup_datetime", "2018-05-01", time.Date(2018, 5, 1, 0, 0, 0, 0, time.UTC).Unix()},
+		{"fare_amount", "11.15", 1115},
+		{"trip_distance", "1.60", 160},
+		{"store_and_fwd_flag", "Y", 1},
+		{"PULocationID", "230", 230},
+	}
+	for _, tc := range cases {
+		c := ColumnByName(tc.col)
+		got, err := c.Parse(tc.s)
+		if err != nil || got != tc.want {
+			t.Errorf("%s: Parse(%q) = %d, %v; want %d", tc.col, tc.s, got, err, tc.want)
+		}
+		if c != pickup || len(tc.s) > len(DateLayout) {
+			if s := c.Format(got); s != tc.s {
+				t.Errorf("%s: Format(%d) = %q, want %q", tc.col, got, s, tc.s)
+			}
+		}
+	}
+
+	_, err := pickup.Parse("2018-05")
+	if err == nil || !strings.Contains(err.Error(), DateLayout) {
+		t.Errorf("bad time: got error %v, want one with the layouts", err)
+	}
+}
@@ -0,0 +1,381 @@
+// Package decompress opens files and streams and transparently decompresses
+// them. The format is detected from the magic bytes at the start of the data,
+// not from the file extension.
+package decompress
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"compress/bzip2"
+	"compress/gzip"
+	"compress/zlib"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+)
+
+// Format is a compression (or archive) format
+type Format struct {
+	Name  string
+	Exts  []string                 // common file extensions, e.g. ".gz"
+	Match func(header []byte) bool // header is up to HeaderSize bytes
+	Open  func(r io.Reader) (io.Reader, error)
+}
+
+// HeaderSize is the number of bytes we peek to detect the format, tar magic
+// is at offset 257.
+const HeaderSize = 512
+
+// maxDepth limits nesting (e.g. tar inside gzip inside zip)
+const maxDepth = 4
+
+// ErrUnsupported is returned for formats we can detect but not decompress
+var ErrUnsupported = errors.New("unsupported compression format")
+
+var (
+	mu      sync.RWMutex
+	formats []Format
+)
+
+// Register adds a format to the registry. Formats registered later are
+// checked first, so you can override the built-in ones.
+func Register(f Format) {
+	mu.Lock()
+	defer mu.Unlock()
+	formats = append([]Format{f}, formats...)
+}
+
+// Formats returns the registered formats
+func Formats() []Format {
+	mu.RLock()
+	defer mu.RUnlock()
+	return append([]Format(nil), formats...)
+}
+
+// Extensions returns file extensions of all registered formats
+func Extensions() []string {
+	var exts []string
+	for _, f := range Formats() {
+		exts = append(exts, f.Exts...)
+	}
+	return exts
+}
+
+// Detect returns the format matching header
+func Detect(header []byte) (Format, bool) {
+	for _, f := range Formats() {
+		if f.Match(header) {
+			return f, true
+		}
+	}
+	return Format{}, false
+}
+
+// Open opens the file at path, the returned reader has the decompressed content
+func Open(path string) (io.ReadCloser, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+
+	rc, err := NewFileReader(file, info.Size())
+	if err != nil {
+		file.Close()
+		return nil, &os.PathError{Op: "decompress", Path: path, Err: err}
+	}
+	return &multiCloser{rc, []io.Closer{rc, file}}, nil
+}
+
+// File is a file opened for reading, *os.File implements it
+type File interface {
+	io.Reader
+	io.ReaderAt
+}
+
+// NewFileReader is like NewReader for a file with size bytes, the file should
+// be at offset 0. It uses random access for zip instead of reading all of it
+// to memory. Close does not close f.
+func NewFileReader(f File, size int64) (io.ReadCloser, error) {
+	header := make([]byte, HeaderSize)
+	n, err := f.ReadAt(header, 0)
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+	if format, ok := Detect(header[:n]); !ok || format.Name != "zip" {
+		return NewReader(f)
+	}
+
+	r, err := openZip(f, size)
+	if err != nil {
+		return nil, fmt.Errorf("zip: %w", err)
+	}
+	rc, err := NewReader(r)
+	if err != nil {
+		return nil, err
+	}
+	if c, ok := r.(io.Closer); ok {
+		return &multiCloser{rc, []io.Closer{rc, c}}, nil
+	}
+	return rc, nil
+}
+
+// NewReader returns a reader with the decompressed content of r. Data in an
+// unknown format is returned as is. Close does not close r.
+func NewReader(r io.Reader) (io.ReadCloser, error) {
+	mc := &multiCloser{}
+	for depth := 0; ; depth++ {
+		br := bufio.NewReaderSize(r, HeaderSize)
+		header, err := br.Peek(HeaderSize)
+		if err != nil && err != io.EOF {
+			mc.Close()
+			return nil, err
+		}
+
+		f, ok := Detect(header)
+		if !ok {
+			mc.Reader = br
+			return mc, nil
+		}
+
+		if depth == maxDepth {
+			mc.Close()
+			return nil, fmt.Errorf("%s: too many nesting levels", f.Name)
+		}
+
+		dr, err := f.Open(br)
+		if err != nil {
+			mc.Close()
+			return nil, fmt.Errorf("%s: %w", f.Name, err)
+		}
+		if c, ok := dr.(io.Closer); ok {
+			mc.closers = append([]io.Closer{c}, mc.closers...)
+		}
+		r = dr
+	}
+}
+
+type multiCloser struct {
+	io.Reader
+	closers []io.Closer
+}
+
+func (m *multiCloser) Close() error {
+	var err error
+	for _, c := range m.closers {
+		if cerr := c.Close(); cerr != nil && err == nil {
+			err = cerr
+		}
+	}
+	m.closers = nil
+	return err
+}
+
+func init() {
+	Register(Format{
+		Name:  "zstd",
+		Exts:  []string{".zst"},
+		Match: prefix("\x28\xb5\x2f\xfd"),
+		Open:  unsupported("zstd"),
+	})
+	Register(Format{
+		Name:  "xz",
+		Exts:  []string{".xz"},
+		Match: prefix("\xfd7zXZ\x00"),
+		Open:  unsupported("xz"),
+	})
+	Register(Format{
+		Name:  "tar",
+		Exts:  []string{".tar"},
+		Match: isTar,
+		Open:  openTar,
+	})
+	Register(Format{
+		Name:  "zip",
+		Exts:  []string{".zip"},
+		Match: prefix("PK\x03\x04"),
+		Open:  spoolZip,
+	})
+	Register(Format{
+		Name:  "zlib",
+		Exts:  []string{".zz", ".zlib"},
+		Match: isZlib,
+		Open: func(r io.Reader) (io.Reader, error) {
+			return zlib.NewReader(r)
+		},
+	})
+	Register(Format{
+		Name:  "bzip2",
+		Exts:  []string{".bz2"},
+		Match: isBzip2,
+		Open: func(r io.Reader) (io.Reader, error) {
+			return bzip2.NewReader(r), nil
+		},
+	})
+	Register(Format{
+		Name:  "gzip",
+		Exts:  []string{".gz"},
+		Match: prefix("\x1f\x8b"),
+		Open: func(r io.Reader) (io.Reader, error) {
+			return gzip.NewReader(r)
+		},
+	})
+}
+
+func prefix(magic string) func([]byte) bool {
+	return func(header []byte) bool {
+		return bytes.HasPrefix(header, []byte(magic))
+	}
+}
+
+func unsupported(name string) func(io.Reader) (io.Reader, error) {
+	return func(io.Reader) (io.Reader, error) {
+		return nil, fmt.Errorf("%w: %s", ErrUnsupported, name)
+	}
+}
+
+// isZlib checks the RFC 1950 header: deflate method, window <= 32K, and the
+// header checksum. Only the common compression levels are accepted since two
+// bytes of text can pass the checksum.
+func isZlib(header []byte) bool {
+	if len(header) < 2 || header[0] != 0x78 {
+		return false
+	}
+	switch header[1] {
+	case 0x01, 0x5e, 0x9c, 0xda:
+		return (uint16(header[0])<<8|uint16(header[1]))%31 == 0
+	}
+	return false
+}
+
+// isBzip2 checks the block size digit after "BZh" and the magic of the first
+// block (pi) or of the end of stream (sqrt(pi)) for an empty file, "BZh" is
+// common at the start of text.
+func isBzip2(header []byte) bool {
+	if len(header) < 10 || string(header[:3]) != "BZh" || header[3] < '1' || header[3] > '9' {
+		return false
+	}
+	magic := string(header[4:10])
+	return magic == "1AY&SY" || magic == "\x17\x72\x45\x38\x50\x90"
+}
+
+func isTar(header []byte) bool {
+	const off = 257
+	if len(header) < off+5 {
+		return false
+	}
+	return string(header[off:off+5]) == "ustar"
+}
+
+// openZip returns the content of the single file in a zip archive
+func openZip(r io.ReaderAt, size int64) (io.Reader, error) {
+	zr, err := zip.NewReader(r, size)
+	if err != nil {
+		return nil, err
+	}
+
+	var files []*zip.File
+	for _, f := range zr.File {
+		if !f.FileInfo().IsDir() {
+			files = append(files, f)
+		}
+	}
+	if len(files) != 1 {
+		return nil, fmt.Errorf("expected 1 file in archive, found %d", len(files))
+	}
+
+	return files[0].Open()
+}
+
+// spoolZip opens a zip inside a stream. zip needs random access, so it's
+// copied to a temporary file (not memory, it can be huge) that's removed on
+// Close.
+func spoolZip(r io.Reader) (io.Reader, error) {
+	tmp, err := os.CreateTemp("", "decompress-*.zip")
+	if err != nil {
+		return nil, err
+	}
+	sz := &spooledZip{tmp: tmp}
+
+	n, err := io.Copy(tmp, r)
+	if err != nil {
+		sz.Close()
+		return nil, err
+	}
+	if sz.Reader, err = openZip(tmp, n); err != nil {
+		sz.Close()
+		return nil, err
+	}
+	return sz, nil
+}
+
+type spooledZip struct {
+	io.Reader
+	tmp *os.File
+}
+
+func (s *spooledZip) Close() error {
+	if c, ok := s.Reader.(io.Closer); ok {
+		c.Close()
+	}
+	err := s.tmp.Close()
+	if rerr := os.Remove(s.tmp.Name()); rerr != nil && err == nil {
+		err = rerr
+	}
+	return err
+}
+
+// openTar returns the content of the single regular file in a tar stream.
+// Since a stream can't be rewound, a second file is reported at the end of
+// the first one.
+func openTar(r io.Reader) (io.Reader, error) {
+	tr := tar.NewReader(r)
+	if err := nextRegular(tr); err != nil {
+		if err == io.EOF {
+			return nil, fmt.Errorf("no files in archive")
+		}
+		return nil, err
+	}
+	return &tarMember{tr: tr}, nil
+}
+
+func nextRegular(tr *tar.Reader) error {
+	for {
+		hdr, err := tr.Next()
+		if err != nil {
+			return err
+		}
+		if hdr.Typeflag == tar.TypeReg {
+			return nil
+		}
+	}
+}
+
+type tarMember struct {
+	tr *tar.Reader
+}
+
+func (t *tarMember) Read(p []byte) (int, error) {
+	n, err := t.tr.Read(p)
+	if err != io.EOF {
+		return n, err
+	}
+
+	switch err := nextRegular(t.tr); err {
+	case io.EOF:
+		return n, io.EOF
+	case nil:
+		return n, fmt.Errorf("tar: more than one file in archive")
+	default:
+		return n, err
+	}
+}
@@ -0,0 +1,245 @@
+package decompress
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const content = "hello\n"
+
+// bzip2 of content and of nothing, made by the bzip2 command (Go has no
+// bzip2 writer)
+var (
+	bzip2Data = []byte{
+		0x42, 0x5a, 0x68, 0x39, 0x31, 0x41, 0x59, 0x26, 0x53, 0x59, 0xc1, 0xc0,
+		0x80, 0xe2, 0x00, 0x00, 0x01, 0x41, 0x00, 0x00, 0x10, 0x02, 0x44, 0xa0,
+		0x00, 0x30, 0xcd, 0x00, 0xc3, 0x46, 0x29, 0x97, 0x17, 0x72, 0x45, 0x38,
+		0x50, 0x90, 0xc1, 0xc0, 0x80, 0xe2,
+	}
+	bzip2Empty = []byte{
+		0x42, 0x5a, 0x68, 0x39, 0x17, 0x72, 0x45, 0x38, 0x50, 0x90, 0x00, 0x00,
+		0x00, 0x00,
+	}
+)
+
+func gzipData(t *testing.T, data []byte) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	w := gzip.NewWriter(&buf)
+	w.Write(data)
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func zlibData(t *testing.T, data []byte) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	w := zlib.NewWriter(&buf)
+	w.Write(data)
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// zipData is an archive with a file per name, all with content
+func zipData(t *testing.T, names ...string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	w := zip.NewWriter(&buf)
+	for _, name := range names {
+		fw, err := w.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		io.WriteString(fw, content)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// tarData is an archive with a directory and a file per name, all with
+// content
+func tarData(t *testing.T, names ...string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	w := tar.NewWriter(&buf)
+	if err := w.WriteHeader(&tar.Header{Name: "dir/", Typeflag: tar.TypeDir, Mode: 0755}); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range names {
+		hdr := &tar.Header{Name: name, Typeflag: tar.TypeReg, Mode: 0644, Size: int64(len(content))}
+		if err := w.WriteHeader(hdr); err != nil {
+			t.Fatal(err)
+		}
+		io.WriteString(w, content)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestDetect(t *testing.T) {
+	cases := []struct {
+		name   string
+		data   []byte
+		format string // "" for none
+	}{
+		{"gzip", gzipData(t, []byte(content)), "gzip"},
+		{"bzip2", bzip2Data, "bzip2"},
+		{"bzip2 empty", bzip2Empty, "bzip2"},
+		{"zlib", zlibData(t, []byte(content)), "zlib"},
+		{"zip", zipData(t, "a.txt"), "zip"},
+		{"tar", tarData(t, "a.txt"), "tar"},
+		{"xz", []byte("\xfd7zXZ\x00\x00\x04"), "xz"},
+		{"zstd", []byte("\x28\xb5\x2f\xfd\x04\x00"), "zstd"},
+		{"text", []byte(content), ""},
+		{"empty", nil, ""},
+		{"BZh text", []byte("BZh9 is not bzip2 data"), ""},
+		{"x text", []byte("xylophone"), ""},
+		{"short gzip", []byte("\x1f"), ""},
+	}
+	for _, tc := range cases {
+		f, ok := Detect(tc.data)
+		switch {
+		case tc.format == "" && ok:
+			t.Errorf("%s: detected %s", tc.name, f.Name)
+		case tc.format != "" && !ok:
+			t.Errorf("%s: not detected", tc.name)
+		case ok && f.Name != tc.format:
+			t.Errorf("%s: got %s, want %s", tc.name, f.Name, tc.format)
+		}
+	}
+}
+
+func readAll(t *testing.T, r io.Reader) (string, error) {
+	t.Helper()
+	rc, err := NewReader(r)
+	if err != nil {
+		return "", err
+	}
+	defer rc.Close()
+	data, err := io.ReadAll(rc)
+	return string(data), err
+}
+
+func TestNewReader(t *testing.T) {
+	cases := []struct {
+		name string
+		data []byte
+		want string
+	}{
+		{"gzip", gzipData(t, []byte(content)), content},
+		{"bzip2", bzip2Data, content},
+		{"bzip2 empty", bzip2Empty, ""},
+		{"zlib", zlibData(t, []byte(content)), content},
+		{"zip", zipData(t, "a.txt"), content},
+		{"tar", tarData(t, "dir/a.txt"), content},
+		{"tar.gz", gzipData(t, tarData(t, "a.txt")), content},
+		{"zip in gzip", gzipData(t, zipData(t, "a.txt")), content},
+		{"text", []byte(content), content},
+		{"empty", nil, ""},
+	}
+	for _, tc := range cases {
+		got, err := readAll(t, bytes.NewReader(tc.data))
+		if err != nil {
+			t.Errorf("%s: %s", tc.name, err)
+			continue
+		}
+		if got != tc.want {
+			t.Errorf("%s: got %q, want %q", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestUnsupported(t *testing.T) {
+	for _, data := range []string{"\xfd7zXZ\x00\x00\x04", "\x28\xb5\x2f\xfd\x04\x00"} {
+		_, err := readAll(t, strings.NewReader(data))
+		if !errors.Is(err, ErrUnsupported) {
+			t.Errorf("%q: got %v, want ErrUnsupported", data, err)
+		}
+	}
+}
+
+// We hash a single file, archives with several files are errors
+func TestMultiFile(t *testing.T) {
+	cases := []struct {
+		name string
+		data []byte
+	}{
+		{"zip", zipData(t, "a.txt", "b.txt")},
+		{"tar", tarData(t, "a.txt", "b.txt")},
+		{"empty tar", tarData(t)},
+		{"tar.gz", gzipData(t, tarData(t, "a.txt", "b.txt"))},
+	}
+	for _, tc := range cases {
+		if _, err := readAll(t, bytes.NewReader(tc.data)); err == nil {
+			t.Errorf("%s: no error", tc.name)
+		}
+	}
+}
+
+func TestNesting(t *testing.T) {
+	data := []byte(content)
+	for i := 0; i < maxDepth; i++ {
+		data = gzipData(t, data)
+	}
+	if got, err := readAll(t, bytes.NewReader(data)); err != nil || got != content {
+		t.Errorf("%d levels: got %q, %v", maxDepth, got, err)
+	}
+
+	data = gzipData(t, data)
+	if _, err := readAll(t, bytes.NewReader(data)); err == nil {
+		t.Errorf("%d levels: no error", maxDepth+1)
+	}
+}
+
+// Open reads zip files in place, other formats as streams
+func TestOpen(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string][]byte{
+		"a.zip":    zipData(t, "a.txt"),
+		"a.csv.gz": gzipData(t, []byte(content)),
+		"a.bin":    bzip2Data, // the extension doesn't matter
+		"a.txt":    []byte(content),
+	}
+	for name, data := range files {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, data, 0644); err != nil {
+			t.Fatal(err)
+		}
+
+		rc, err := Open(path)
+		if err != nil {
+			t.Errorf("%s: %s", name, err)
+			continue
+		}
+		got, err := io.ReadAll(rc)
+		rc.Close()
+		if err != nil || string(got) != content {
+			t.Errorf("%s: got %q, %v", name, got, err)
+		}
+	}
+
+	path := filepath.Join(dir, "two.zip")
+	if err := os.WriteFile(path, zipData(t, "a.txt", "b.txt"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Open(path); err == nil {
+		t.Errorf("two.zip: no error")
+	}
+}
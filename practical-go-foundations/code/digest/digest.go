@@ -0,0 +1,138 @@
+// Package digest is a small registry of hash algorithms used by the checksum
+// tools (taxi, sha1).
+package digest
+
+import (
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"regexp"
+	"strings"
+)
+
+// Algorithm is a hash algorithm
+type Algorithm struct {
+	Name string // canonical name, e.g. "sha256"
+	Tag  string // BSD tag, e.g. "SHA256"
+	Size int    // digest size in bytes
+	New  func() hash.Hash
+}
+
+func (a Algorithm) String() string {
+	return a.Name
+}
+
+// HexLen is the length of the hex encoded digest
+func (a Algorithm) HexLen() int {
+	return a.Size * 2
+}
+
+var (
+	MD5        = Algorithm{"md5", "MD5", md5.Size, md5.New}
+	SHA1       = Algorithm{"sha1", "SHA1", sha1.Size, sha1.New}
+	SHA224     = Algorithm{"sha224", "SHA224", sha256.Size224, sha256.New224}
+	SHA256     = Algorithm{"sha256", "SHA256", sha256.Size, sha256.New}
+	SHA384     = Algorithm{"sha384", "SHA384", sha512.Size384, sha512.New384}
+	SHA512     = Algorithm{"sha512", "SHA512", sha512.Size, sha512.New}
+	SHA512_256 = Algorithm{"sha512/256", "SHA512/256", sha512.Size256, sha512.New512_256}
+)
+
+// Algorithms are all the supported algorithms. When two algorithms have the
+// same digest size, the first one wins in BySize.
+var Algorithms = []Algorithm{MD5, SHA1, SHA224, SHA256, SHA384, SHA512, SHA512_256}
+
+// aliases for names people (and BSD tools) use
+var aliases = map[string]Algorithm{
+	"sha-1":       SHA1,
+	"sha-224":     SHA224,
+	"sha-256":     SHA256,
+	"sha-384":     SHA384,
+	"sha-512":     SHA512,
+	"sha-512/256": SHA512_256,
+	"sha512t256":  SHA512_256, // FreeBSD
+	"sha512_256":  SHA512_256,
+}
+
+// ByName returns algorithm by name or BSD tag, case insensitive
+func ByName(name string) (Algorithm, error) {
+	key := strings.ToLower(name)
+	for _, a := range Algorithms {
+		if a.Name == key {
+			return a, nil
+		}
+	}
+	if a, ok := aliases[key]; ok {
+		return a, nil
+	}
+
+	return Algorithm{}, fmt.Errorf("unknown hash algorithm: %q", name)
+}
+
+// BySize returns the algorithm that produces hex digests of length n.
+// SHA-256 and SHA-512/256 have the same size, SHA-256 is returned.
+func BySize(n int) (Algorithm, error) {
+	for _, a := range Algorithms {
+		if a.HexLen() == n {
+			return a, nil
+		}
+	}
+
+	return Algorithm{}, fmt.Errorf("no hash algorithm with %d hex digits", n)
+}
+
+// Sum returns the hex encoded digest of everything in r
+func Sum(alg Algorithm, r io.Reader) (string, error) {
+	h := alg.New()
+	if _, err := io.Copy(h, r); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// IsHex returns true if s is a non empty hex string
+func IsHex(s string) bool {
+	if s == "" {
+		return false
+	}
+	for _, c := range s {
+		switch {
+		case c >= '0' && c <= '9', c >= 'a' && c <= 'f', c >= 'A' && c <= 'F':
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// SHA256 (taxi-01.csv) = 0c4ccc63...
+var tagRe = regexp.MustCompile(`^([A-Za-z0-9/_-]+) \((.*)\) = ([0-9a-fA-F]+)$`)
+
+// ParseTagged parses a BSD style (--tag) line
+//
+//	SHA256 (file) = hex
+//
+// It returns the algorithm, file name and digest.
+func ParseTagged(line string) (Algorithm, string, string, error) {
+	m := tagRe.FindStringSubmatch(line)
+	if m == nil {
+		return Algorithm{}, "", "", fmt.Errorf("not a tagged line")
+	}
+
+	alg, err := ByName(m[1])
+	if err != nil {
+		return Algorithm{}, "", "", err
+	}
+
+	sig := strings.ToLower(m[3])
+	if len(sig) != alg.HexLen() {
+		return Algorithm{}, "", "", fmt.Errorf("%s digest should have %d hex digits, got %d", alg, alg.HexLen(), len(sig))
+	}
+
+	return alg, m[2], sig, nil
+}
@@ -0,0 +1,166 @@
+package digest
+
+import (
+	"strings"
+	"testing"
+)
+
+// Digests of "" and "abc" (the FIPS 180 and RFC 1321 examples)
+var vectors = []struct {
+	alg   Algorithm
+	empty string
+	abc   string
+}{
+	{MD5, "d41d8cd98f00b204e9800998ecf8427e", "900150983cd24fb0d6963f7d28e17f72"},
+	{SHA1, "da39a3ee5e6b4b0d3255bfef95601890afd80709", "a9993e364706816aba3e25717850c26c9cd0d89d"},
+	{
+		SHA224,
+		"d14a028c2a3a2bc9476102bb288234c415a2b01f828ea62ac5b3e42f",
+		"23097d223405d8228642a477bda255b32aadbce4bda0b3f7e36c9da7",
+	},
+	{
+		SHA256,
+		"e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855",
+		"ba7816bf8f01cfea414140de5dae2223b00361a396177a9cb410ff61f20015ad",
+	},
+	{
+		SHA384,
+		"38b060a751ac96384cd9327eb1b1e36a21fdb71114be07434c0cc7bf63f6e1da274edebfe76f65fbd51ad2f14898b95b",
+		"cb00753f45a35e8bb5a03d699ac65007272c32ab0eded1631a8b605a43ff5bed8086072ba1e7cc2358baeca134c825a7",
+	},
+	{
+		SHA512,
+		"cf83e1357eefb8bdf1542850d66d8007d620e4050b5715dc83f4a921d36ce9ce47d0d13c5d85f2b0ff8318d2877eec2f63b931bd47417a81a538327af927da3e",
+		"ddaf35a193617abacc417349ae20413112e6fa4e89a97ea20a9eeee64b55d39a2192992a274fc1a836ba3c23a3feebbd454d4423643ce80e2a9ac94fa54ca49f",
+	},
+	{
+		SHA512_256,
+		"c672b8d1ef56ed28ab87c3622c5114069bdd3ad7b8f9737498d0c01ecef0967a",
+		"53048e2681941ef99b2e29b76b4c7dabe4c2d0c634fc6d46e0e2f13107e7af23",
+	},
+}
+
+func TestSum(t *testing.T) {
+	for _, v := range vectors {
+		for input, want := range map[string]string{"": v.empty, "abc": v.abc} {
+			got, err := Sum(v.alg, strings.NewReader(input))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != want {
+				t.Errorf("%s(%q): got %s, want %s", v.alg, input, got, want)
+			}
+			if len(got) != v.alg.HexLen() {
+				t.Errorf("%s: %d hex digits, HexLen is %d", v.alg, len(got), v.alg.HexLen())
+			}
+		}
+	}
+	if len(vectors) != len(Algorithms) {
+		t.Errorf("%d vectors for %d algorithms", len(vectors), len(Algorithms))
+	}
+}
+
+func TestBySize(t *testing.T) {
+	cases := []struct {
+		n    int
+		want string // "" for an error
+	}{
+		{32, "md5"},
+		{40, "sha1"},
+		{56, "sha224"},
+		{64, "sha256"}, // not sha512/256, same length
+		{96, "sha384"},
+		{128, "sha512"},
+		{0, ""},
+		{63, ""},
+		{65, ""},
+		{20, ""}, // bytes, not hex digits
+	}
+	for _, tc := range cases {
+		alg, err := BySize(tc.n)
+		switch {
+		case tc.want == "" && err == nil:
+			t.Errorf("BySize(%d): got %s, want an error", tc.n, alg)
+		case tc.want != "" && err != nil:
+			t.Errorf("BySize(%d): %s", tc.n, err)
+		case alg.Name != tc.want:
+			t.Errorf("BySize(%d): got %s, want %s", tc.n, alg, tc.want)
+		}
+	}
+}
+
+func TestByName(t *testing.T) {
+	cases := map[string]Algorithm{
+		"sha256":      SHA256,
+		"SHA256":      SHA256,
+		"Sha-256":     SHA256,
+		"sha-1":       SHA1,
+		"MD5":         MD5,
+		"sha512/256":  SHA512_256,
+		"SHA512t256":  SHA512_256,
+		"sha512_256":  SHA512_256,
+		"sha-512/256": SHA512_256,
+	}
+	for name, want := range cases {
+		if got, err := ByName(name); err != nil || got.Name != want.Name {
+			t.Errorf("ByName(%q) = %s, %v; want %s", name, got, err, want)
+		}
+	}
+	for _, name := range []string{"", "sha", "sha3-256", "crc32"} {
+		if _, err := ByName(name); err == nil {
+			t.Errorf("ByName(%q): no error", name)
+		}
+	}
+}
+
+func TestIsHex(t *testing.T) {
+	for s, want := range map[string]bool{
+		"0123456789abcdef": true,
+		"ABCDEF":           true,
+		"":                 false,
+		"0x12":             false,
+		"12 34":            false,
+		"g":                false,
+	} {
+		if got := IsHex(s); got != want {
+			t.Errorf("IsHex(%q) = %v, want %v", s, got, want)
+		}
+	}
+}
+
+func TestParseTagged(t *testing.T) {
+	sha256abc := vectors[3].abc
+	cases := []struct {
+		line string
+		alg  string
+		name string
+	}{
+		{"SHA256 (taxi-01.csv) = " + sha256abc, "sha256", "taxi-01.csv"},
+		{"SHA256 (a (1).txt) = " + strings.ToUpper(sha256abc), "sha256", "a (1).txt"},
+		{"SHA512/256 (x) = " + vectors[6].abc, "sha512/256", "x"},
+		{"MD5 () = " + vectors[0].abc, "md5", ""},
+	}
+	for _, tc := range cases {
+		alg, name, sig, err := ParseTagged(tc.line)
+		if err != nil {
+			t.Errorf("%q: %s", tc.line, err)
+			continue
+		}
+		if alg.Name != tc.alg || name != tc.name || sig != strings.ToLower(sig) || len(sig) != alg.HexLen() {
+			t.Errorf("%q: got %s %q %s", tc.line, alg, name, sig)
+		}
+	}
+
+	for _, line := range []string{
+		"",
+		sha256abc + "  taxi-01.csv",
+		"SHA256 (taxi-01.csv) = " + vectors[0].abc, // md5 length
+		"SHA3 (taxi-01.csv) = " + sha256abc,
+		"SHA256 (taxi-01.csv) = xyz",
+		"SHA256 (taxi-01.csv)= " + sha256abc,
+	} {
+		if _, _, _, err := ParseTagged(line); err == nil {
+			t.Errorf("%q: no error", line)
+		}
+	}
+}
@@ -2,32 +2,138 @@ package main
 
 // Q: What is the most common word (ignoring case) in sherlock.txt?
 // Word frequency
+//
+//	go run ./freq
+//	go run ./freq -stopwords english -ngram 2 -j 8 -v corpus/ books.txt.gz
+//
+// Arguments are files or directories (default freq/sherlock.txt), files can
+// be compressed. See parallel.go for how big inputs are counted.
 
 import (
 	"bufio"
+	"flag"
 	"fmt"
 	"io"
 	"log"
 	"os"
-	"regexp"
-	"sort"
+	"runtime"
+	"strconv"
 	"strings"
+	"time"
+
+	"day1/topk"
+	"day1/words"
 )
 
 func main() {
-	file, err := os.Open("freq/sherlock.txt")
+	tokName := flag.String("tokenizer", "unicode", "word tokenizer: unicode or ascii ([a-zA-Z]+)")
+	stopWords := flag.String("stopwords", "none", "stop words to ignore: none, english or a file with a word per line")
+	stem := flag.Bool("stem", false, "count words by their stem (Porter2), \"detective\" and \"detectives\" are the same")
+	surface := flag.Bool("surface", false, "with -stem, print the most common form of each stem instead of the stem")
+	n := flag.Int("n", 3, "number of words to print")
+	ngram := flag.Int("ngram", 1, "count phrases of ngram words (e.g. 2 for \"sherlock holmes\"), they don't span stop words or paragraphs")
+	score := flag.String("score", "count", "rank phrases by: count, pmi or llr (collocation scores, -ngram 2 only)")
+	minCount := flag.Int("min", 1, "ignore phrases seen less than min times (pmi favors rare phrases)")
+	approx := flag.String("approx", "", "count in bounded memory with an approximate top-k: spacesaving or countmin (default exact)")
+	capacity := flag.Int("capacity", 10000, "with -approx, number of counters (width of the count-min sketch)")
+	workers := flag.Int("j", runtime.NumCPU(), "number of counting workers")
+	verbose := flag.Bool("v", false, "print input size, time and throughput to stderr")
+	flag.Parse()
+
+	if *workers < 1 {
+		log.Fatalf("error: -j must be positive")
+	}
 
+	tok, err := words.ByName(*tokName)
 	if err != nil {
 		log.Fatalf("error: %s", err)
 	}
+	p := &pipeline{tok: tok, score: *score, min: *minCount}
+	if *ngram > 1 {
+		p.n = *ngram
+	}
+	switch *score {
+	case "count":
+	case "pmi", "llr":
+		if *ngram != 2 {
+			log.Fatalf("error: -score %s needs -ngram 2", *score)
+		}
+	default:
+		log.Fatalf("error: unknown score: %q", *score)
+	}
+
+	switch *stopWords {
+	case "none", "":
+	case "english":
+		p.norm = append(p.norm, words.English.Filter)
+	default:
+		stop, err := words.LoadStopWords(*stopWords)
+		if err != nil {
+			log.Fatalf("error: %s", err)
+		}
+		p.norm = append(p.norm, stop.Filter)
+	}
+	if *stem {
+		p.norm = append(p.norm, words.Stem)
+		p.forms = *surface
+	}
 
-	defer file.Close()
+	switch *approx {
+	case "":
+	case "spacesaving", "countmin":
+		if *capacity < 1 {
+			log.Fatalf("error: -capacity must be positive")
+		}
+		if *score != "count" {
+			log.Fatalf("error: -score %s needs exact counts, it can't be used with -approx", *score)
+		}
+		if p.forms {
+			log.Fatalf("error: -surface can't be used with -approx")
+		}
+		p.approx, p.capacity, p.top = *approx, *capacity, *n
+	default:
+		log.Fatalf("error: unknown approx: %q", *approx)
+	}
 
-	w, err := mostCommon(file, 3)
+	paths := flag.Args()
+	if len(paths) == 0 {
+		paths = []string{"freq/sherlock.txt"}
+	}
+
+	start := time.Now()
+	sc, size, err := countFiles(paths, p, *workers)
 	if err != nil {
 		log.Fatalf("error: %s", err)
 	}
-	fmt.Println(w)
+	if *verbose {
+		d := time.Since(start)
+		fmt.Fprintf(os.Stderr, "%d bytes in %v (%.1f MB/s, %d workers)\n", size, d, float64(size)/1e6/d.Seconds(), *workers)
+	}
+
+	top := mostCommon(sc, *n, p)
+	if p.forms {
+		for i, it := range top {
+			stems := strings.Split(it.Key, " ") // words of phrases
+			for j, stem := range stems {
+				stems[j] = mostCommonForm(sc.shard(stem).forms[stem])
+			}
+			top[i].Key = strings.Join(stems, " ")
+		}
+	}
+	for _, it := range top {
+		key := it.Key
+		if p.n > 1 {
+			key = strconv.Quote(key) // phrases have spaces
+		}
+		switch {
+		case p.score != "count":
+			fmt.Printf("%s\t%d\t%.3f\n", key, it.Count, it.Score)
+		case it.Error > 0:
+			fmt.Printf("%s\t%d\t(±%d)\n", key, it.Count, it.Error)
+		default:
+			fmt.Printf("%s\t%d\n", key, it.Count)
+		}
+	}
 	// mapDemo()
 
 	/*
@@ -37,30 +143,104 @@ func main() {
 	*/
 }
 
-func mostCommon(r io.Reader, n int) ([]string, error) {
-	freqs, err := wordFrequency(r)
-	if err != nil {
-		return nil, err
+// pipeline turns text to words: split it with tok, then normalize the words
+// (e.g. drop stop words, stem)
+type pipeline struct {
+	tok   words.Tokenizer
+	norm  words.Normalizer // can be empty
+	forms bool             // count surface forms of normalized words
+
+	n     int    // if > 1, count phrases of n words
+	score string // how mostCommon ranks phrases: count, pmi or llr
+	min   int    // mostCommon ignores phrases seen less than min times
+
+	approx   string // if set, count in a topk sketch: spacesaving or countmin
+	capacity int    // number of counters of the sketch
+	top      int    // number of keys the sketch keeps
+}
+
+// newSketch returns the sketch of p.approx, nil if counting is exact
+func (p *pipeline) newSketch() topk.Sketch {
+	switch p.approx {
+	case "spacesaving":
+		return topk.NewSpaceSaving(p.capacity)
+	case "countmin":
+		return topk.NewCountMin(p.capacity, 4, p.top)
 	}
+	return nil
+}
 
-	// instantiate a slice of keys and populate with all keys
-	keys := make([]string, 0, len(freqs))
-	for key := range freqs {
-		keys = append(keys, key)
+// counts are the words (and phrases) of a text
+type counts struct {
+	freqs  map[string]int            // word -> count
+	ngrams map[string]int            // phrase (words joined by a space) -> count, if pipeline.n > 1
+	forms  map[string]map[string]int // normalized word -> surface form -> count, if pipeline.forms
+
+	// With pipeline.approx the words (or phrases) are counted only in top,
+	// the maps are empty. Shards have it in the first shard only.
+	top topk.Sketch
+}
+
+func newCounts(p *pipeline) *counts {
+	c := &counts{freqs: make(map[string]int)}
+	if p.n > 1 {
+		c.ngrams = make(map[string]int)
+	}
+	if p.forms {
+		c.forms = make(map[string]map[string]int)
 	}
+	return c
+}
 
-	// sort keys slice based on its value in the freqs map
-	sort.SliceStable(keys, func(i, j int) bool {
-		return freqs[keys[i]] > freqs[keys[j]]
-	})
+// mostCommon returns the n most common words, or phrases if p.n > 1. There
+// are less than n if there are less words.
+func mostCommon(sc shards, n int, p *pipeline) []topk.Item {
+	if p.approx != "" {
+		var top []topk.Item
+		if sc[0].top != nil {
+			for _, it := range sc[0].top.Top(n) {
+				if it.Count >= int64(p.min) {
+					top = append(top, it)
+				}
+			}
+		}
+		return top
+	}
 
-	// instantiate slice of n common words and fill with top n words from keys slice
-	nCommonStrings := make([]string, n)
-	for i := 0; i < n; i++ {
-		nCommonStrings[i] = keys[i]
+	count := func(c *counts) map[string]int { return c.freqs }
+	if p.n > 1 {
+		count = func(c *counts) map[string]int { return c.ngrams }
+	}
+	score := func(key string, n int) float64 { return float64(n) }
+	if p.score == "pmi" || p.score == "llr" {
+		var total int64
+		for _, c := range sc {
+			for _, n := range c.freqs {
+				total += int64(n)
+			}
+		}
+		colloc := words.PMI
+		if p.score == "llr" {
+			colloc = words.LLR
+		}
+		score = func(key string, n int) float64 {
+			w1, w2, _ := strings.Cut(key, " ")
+			n1, n2 := sc.shard(w1).freqs[w1], sc.shard(w2).freqs[w2]
+			return colloc(int64(n), int64(n1), int64(n2), total)
+		}
 	}
 
-	return nCommonStrings, nil
+	// keep the n best in a heap instead of sorting all the keys
+	top := topk.NewHeap(n)
+	for _, c := range sc {
+		for key, n := range count(c) {
+			if n < p.min {
+				continue
+			}
+			top.PushScore(key, int64(n), score(key, n))
+		}
+	}
+	return top.Items()
 }
 
 /*	You can use raw strings to create multi line strings
@@ -71,8 +251,9 @@ Connection: Close
 `
 */
 
-// "Who's on first?" -> [Who s on first]
-var wordRe = regexp.MustCompile(`[a-zA-Z]+`) // package level variable, executed BEFORE main fxn
+// Words are split by a words.Tokenizer:
+// "Who's on first?" -> [who s on first] with words.ASCII ([a-zA-Z]+)
+// "Who's on first?" -> [who's on first] with words.Unicode{}
 
 /* Will run before main as well
 func init() {
@@ -143,19 +324,75 @@ func maxWord(freqs map[string]int) (string, error) {
 	return maxW, nil
 }
 
-func wordFrequency(r io.Reader) (map[string]int, error) {
+// wordFrequency counts the words in r, it's a single shard. Use countFiles
+// for big inputs.
+func wordFrequency(r io.Reader, p *pipeline) (shards, error) {
+	c := newCounts(p)
+	c.top = p.newSketch()
+	if err := countText(c, r, p); err != nil {
+		return nil, err
+	}
+	return shards{c}, nil
+}
+
+// countText adds the words in r to c
+func countText(c *counts, r io.Reader, p *pipeline) error {
 	s := bufio.NewScanner(r)
-	freqs := make(map[string]int) // word -> count
+	s.Buffer(make([]byte, 0, 64<<10), chunkSize)
+	var window []string // last p.n words, for phrases
 	// lnum := 0
 	for s.Scan() {
-		words := wordRe.FindAllString(s.Text(), -1) // current line
-		for _, w := range words {
-			freqs[strings.ToLower(w)]++ // if key doesnt exist, returns 0
+		line := s.Text()
+		if strings.TrimSpace(line) == "" { // phrases don't span paragraphs
+			window = window[:0]
+		}
+		for _, w := range p.tok.Tokenize(line) { // current line, words are lower case
+			nw := p.norm.Normalize(w)
+			if nw == "" { // stop word
+				window = window[:0]
+				continue
+			}
+			if c.top == nil {
+				c.freqs[nw]++ // if key doesnt exist, returns 0
+			} else if p.n <= 1 {
+				c.top.Add(nw, 1)
+			}
+
+			if p.n > 1 {
+				if len(window) == p.n {
+					window = append(window[:0], window[1:]...)
+				}
+				window = append(window, nw)
+				if len(window) == p.n {
+					phrase := strings.Join(window, " ")
+					if c.top != nil {
+						c.top.Add(phrase, 1)
+					} else {
+						c.ngrams[phrase]++
+					}
+				}
+			}
+
+			if c.forms != nil {
+				if c.forms[nw] == nil {
+					c.forms[nw] = make(map[string]int)
+				}
+				c.forms[nw][w]++
+			}
 		}
-	}
-	if err := s.Err(); err != nil {
-		return nil, err
 	}
 	// fmt.Println("num lines:", lnum)
-	return freqs, nil
+	return s.Err()
+}
+
+// mostCommonForm returns the form with the highest count, the first in
+// alphabetical order on ties
+func mostCommonForm(forms map[string]int) string {
+	best, bestN := "", 0
+	for form, n := range forms {
+		if n > bestN || (n == bestN && form < best) {
+			best, bestN = form, n
+		}
+	}
+	return best
 }
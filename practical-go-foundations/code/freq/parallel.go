@@ -0,0 +1,264 @@
+package main
+
+import (
+	"bytes"
+	"hash/fnv"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"day1/decompress"
+)
+
+// Counting big inputs is map-reduce:
+//
+//   - Readers (one per file, up to -j at a time) decompress the files and cut
+//     them to chunks of about chunkSize at paragraph boundaries (a line if
+//     there's no blank line), so phrases are counted as in a single pass.
+//   - Workers count the words of chunks in their own counts, no locking.
+//   - Every worker splits its counts to one shard per worker by word hash,
+//     then shard i of all the workers is merged by one goroutine. Shards
+//     have different words so they are merged in parallel, and the result is
+//     never merged to a single map.
+//   - With -approx workers count in a fixed size topk sketch instead of maps,
+//     the sketches are merged in the first shard.
+
+// chunkSize is the size of the chunks workers count, it's also the longest
+// line
+const chunkSize = 4 << 20
+
+// shards are counts split by the hash of the word (or phrase), a word is only
+// in shard(word)
+type shards []*counts
+
+// shardOf returns the shard index of key
+func shardOf(key string, n int) int {
+	if n == 1 {
+		return 0
+	}
+	h := fnv.New32a()
+	h.Write([]byte(key))
+	return int(h.Sum32() % uint32(n))
+}
+
+// shard returns the counts of key
+func (sc shards) shard(key string) *counts {
+	return sc[shardOf(key, len(sc))]
+}
+
+// split splits c to n shards
+func (c *counts) split(n int, p *pipeline) shards {
+	sc := make(shards, n)
+	for i := range sc {
+		sc[i] = newCounts(p)
+	}
+	for w, n := range c.freqs {
+		sc.shard(w).freqs[w] = n
+	}
+	for g, n := range c.ngrams {
+		sc.shard(g).ngrams[g] = n
+	}
+	for w, forms := range c.forms {
+		sc.shard(w).forms[w] = forms
+	}
+	sc[0].top = c.top
+	return sc
+}
+
+// merge adds the counts in o to c
+func (c *counts) merge(o *counts) {
+	for w, n := range o.freqs {
+		c.freqs[w] += n
+	}
+	for g, n := range o.ngrams {
+		c.ngrams[g] += n
+	}
+	for w, forms := range o.forms {
+		dst := c.forms[w]
+		if dst == nil {
+			c.forms[w] = forms
+			continue
+		}
+		for f, n := range forms {
+			dst[f] += n
+		}
+	}
+
+	switch {
+	case o.top == nil:
+	case c.top == nil:
+		c.top = o.top
+	default:
+		if err := c.top.Merge(o.top); err != nil {
+			panic(err) // sketches of the same pipeline always merge
+		}
+	}
+}
+
+// inputFiles returns the files in paths, directories are walked (hidden files
+// are skipped)
+func inputFiles(paths []string) ([]string, error) {
+	var files []string
+	for _, root := range paths {
+		info, err := os.Stat(root)
+		if err != nil {
+			return nil, err
+		}
+		if !info.IsDir() {
+			files = append(files, root)
+			continue
+		}
+
+		err = filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if path != root && strings.HasPrefix(d.Name(), ".") {
+				if d.IsDir() {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			if d.Type().IsRegular() {
+				files = append(files, path)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return files, nil
+}
+
+// readChunks sends the decompressed content of path in chunks, it returns the
+// number of bytes read
+func readChunks(path string, chunks chan<- []byte) (int64, error) {
+	r, err := decompress.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer r.Close()
+
+	var size int64
+	var rest []byte // after the last cut of the previous chunk
+	for {
+		buf := make([]byte, chunkSize)
+		n := copy(buf, rest)
+		m, err := io.ReadFull(r, buf[n:])
+		size += int64(m)
+		buf = buf[:n+m]
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			if len(buf) > 0 {
+				chunks <- buf
+			}
+			return size, nil
+		}
+		if err != nil {
+			return size, err
+		}
+
+		cut := chunkEnd(buf)
+		rest = append([]byte(nil), buf[cut:]...)
+		chunks <- buf[:cut]
+	}
+}
+
+// chunkEnd returns where to cut buf: after the last blank line, or the last
+// line if there's none, or all of it for a huge line
+func chunkEnd(buf []byte) int {
+	end := -1
+	for _, sep := range []string{"\n\n", "\n\r\n"} {
+		if i := bytes.LastIndex(buf, []byte(sep)); i >= 0 && i+len(sep) > end {
+			end = i + len(sep)
+		}
+	}
+	if end > 0 {
+		return end
+	}
+	if i := bytes.LastIndexByte(buf, '\n'); i >= 0 {
+		return i + 1
+	}
+	return len(buf)
+}
+
+// countFiles counts the words in the files (or directories) in paths with
+// workers goroutines. It returns the counts in workers shards and the number
+// of (decompressed) bytes read.
+func countFiles(paths []string, p *pipeline, workers int) (shards, int64, error) {
+	files, err := inputFiles(paths)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	chunks := make(chan []byte, workers)
+	var size int64
+	var errOnce sync.Once
+	var firstErr error
+	setErr := func(err error) {
+		errOnce.Do(func() { firstErr = err })
+	}
+
+	// Readers
+	go func() {
+		sem := make(chan bool, workers)
+		var wg sync.WaitGroup
+		for _, path := range files {
+			wg.Add(1)
+			sem <- true
+			go func(path string) {
+				defer wg.Done()
+				defer func() { <-sem }()
+				n, err := readChunks(path, chunks)
+				atomic.AddInt64(&size, n)
+				if err != nil {
+					setErr(err)
+				}
+			}(path)
+		}
+		wg.Wait()
+		close(chunks)
+	}()
+
+	// Map: every worker counts to its own counts, then splits them to shards
+	parts := make([]shards, workers)
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			c := newCounts(p)
+			c.top = p.newSketch()
+			for chunk := range chunks {
+				if err := countText(c, bytes.NewReader(chunk), p); err != nil {
+					setErr(err)
+				}
+			}
+			parts[i] = c.split(workers, p)
+		}(i)
+	}
+	wg.Wait()
+	if firstErr != nil {
+		return nil, size, firstErr
+	}
+
+	// Reduce: shard i of all parts to result[i]
+	result := make(shards, workers)
+	for i := range result {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			c := parts[0][i]
+			for _, part := range parts[1:] {
+				c.merge(part[i])
+			}
+			result[i] = c
+		}(i)
+	}
+	wg.Wait()
+	return result, size, nil
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"day1/words"
+)
+
+// bigText writes copies of sherlock.txt to a file in dir, at least size bytes
+// so it's counted in several chunks
+func bigText(tb testing.TB, dir string, size int) string {
+	tb.Helper()
+	data, err := os.ReadFile("sherlock.txt")
+	if err != nil {
+		tb.Fatal(err)
+	}
+	path := filepath.Join(dir, "big.txt")
+	if err := os.WriteFile(path, bytes.Repeat(data, size/len(data)+1), 0644); err != nil {
+		tb.Fatal(err)
+	}
+	return path
+}
+
+// merged returns all the shards in one counts
+func merged(sc shards, p *pipeline) *counts {
+	c := newCounts(p)
+	if c.ngrams == nil {
+		c.ngrams = make(map[string]int)
+	}
+	if c.forms == nil {
+		c.forms = make(map[string]map[string]int)
+	}
+	for _, s := range sc {
+		c.merge(s)
+	}
+	return c
+}
+
+func TestCountFilesSameAsWordFrequency(t *testing.T) {
+	if testing.Short() {
+		t.Skip("counts 8MB of text")
+	}
+	path := bigText(t, t.TempDir(), 2*chunkSize) // 3 chunks
+
+	pipelines := map[string]*pipeline{
+		"words":  {tok: words.Unicode{}},
+		"bigram": {tok: words.Unicode{}, n: 2, norm: words.Normalizer{words.English.Filter}},
+		"trigram stem": {
+			tok:   words.Unicode{},
+			n:     3,
+			norm:  words.Normalizer{words.Stem},
+			forms: true,
+		},
+	}
+	for name, p := range pipelines {
+		t.Run(name, func(t *testing.T) {
+			file, err := os.Open(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer file.Close()
+			single, err := wordFrequency(file, p)
+			if err != nil {
+				t.Fatal(err)
+			}
+			want := merged(single, p)
+
+			for _, j := range []int{2, 4} {
+				sc, size, err := countFiles([]string{path}, p, j)
+				if err != nil {
+					t.Fatalf("-j %d: %s", j, err)
+				}
+				if info, _ := os.Stat(path); size != info.Size() {
+					t.Errorf("-j %d: read %d bytes, file is %d", j, size, info.Size())
+				}
+				if len(sc) != j {
+					t.Errorf("-j %d: %d shards", j, len(sc))
+				}
+				got := merged(sc, p)
+				if !reflect.DeepEqual(got.freqs, want.freqs) {
+					t.Errorf("-j %d: word counts differ from wordFrequency", j)
+				}
+				if !reflect.DeepEqual(got.ngrams, want.ngrams) {
+					t.Errorf("-j %d: phrase counts differ from wordFrequency", j)
+				}
+				if !reflect.DeepEqual(got.forms, want.forms) {
+					t.Errorf("-j %d: surface forms differ from wordFrequency", j)
+				}
+			}
+		})
+	}
+}
+
+func TestChunkEnd(t *testing.T) {
+	cases := []struct {
+		buf  string
+		want int
+	}{
+		{"a b\n\nc d\ne", 5},
+		{"a b\r\n\r\nc d", 7},
+		{"a b\nc d", 4},
+		{"a b c", 5},
+	}
+	for _, tc := range cases {
+		if got := chunkEnd([]byte(tc.buf)); got != tc.want {
+			t.Errorf("chunkEnd(%q) = %d, want %d", tc.buf, got, tc.want)
+		}
+	}
+}
+
+func BenchmarkCountFiles(b *testing.B) {
+	path := bigText(b, b.TempDir(), 8*chunkSize) // a chunk for every worker
+	info, err := os.Stat(path)
+	if err != nil {
+		b.Fatal(err)
+	}
+	p := &pipeline{tok: words.Unicode{}, n: 2}
+
+	for _, j := range []int{1, 2, 4, 8} {
+		b.Run(fmt.Sprintf("j=%d", j), func(b *testing.B) {
+			b.SetBytes(info.Size())
+			for i := 0; i < b.N; i++ {
+				if _, _, err := countFiles([]string{path}, p, j); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
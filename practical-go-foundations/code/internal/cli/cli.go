@@ -0,0 +1,200 @@
+// Package cli has what the taxi, trips and weblog commands share: sub
+// commands with their own options, Ctrl-C handling, repeatable glob options,
+// writing output files and printing counts and sizes.
+package cli
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"syscall"
+
+	"day1/decompress"
+)
+
+var prog = filepath.Base(os.Args[0])
+
+// Command is a sub command, Flags adds its options to the command flag set
+type Command struct {
+	Run   func(ctx context.Context) int
+	Flags func(fs *flag.FlagSet)
+	Help  string
+}
+
+// Main runs the command in the first argument with the rest of the arguments
+// as its options, and exits with its exit code. def is the command to run
+// when the first argument is an option, "" if a command must be given.
+//
+// The first Ctrl-C cancels ctx so the command can report what it has done,
+// the second one kills the program.
+func Main(commands map[string]Command, def string) {
+	name := def
+	args := os.Args[1:]
+	if len(args) > 0 && (def == "" || !strings.HasPrefix(args[0], "-")) {
+		name, args = args[0], args[1:]
+	}
+	cmd, ok := commands[name]
+	if !ok {
+		switch name {
+		case "", "-h", "-help", "--help":
+		default:
+			fmt.Fprintf(os.Stderr, "%s: unknown command: %q\n", prog, name)
+		}
+		usage(commands, def)
+		os.Exit(2)
+	}
+
+	fs := flag.NewFlagSet(prog+" "+name, flag.ExitOnError)
+	cmd.Flags(fs)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "usage: %s %s [options]\n\n%s\n\n", prog, name, cmd.Help)
+		fs.PrintDefaults()
+		if name == def {
+			fmt.Fprintln(fs.Output())
+			usage(commands, def)
+		}
+	}
+	fs.Parse(args)
+	if fs.NArg() > 0 {
+		fmt.Fprintf(os.Stderr, "%s: unknown argument: %q\n", prog, fs.Arg(0))
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	// -j is the number of workers in the commands that have it
+	if j := fs.Lookup("j"); j != nil && j.Value.(flag.Getter).Get().(int) < 1 {
+		fmt.Fprintf(os.Stderr, "%s: -j must be positive\n", prog)
+		os.Exit(1)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-ctx.Done()
+		stop()
+	}()
+
+	code := cmd.Run(ctx)
+	stop()
+	os.Exit(code)
+}
+
+func usage(commands map[string]Command, def string) {
+	names := make([]string, 0, len(commands))
+	width := 0
+	for name := range commands {
+		names = append(names, name)
+		if len(name) > width {
+			width = len(name)
+		}
+	}
+	sort.Strings(names)
+
+	if def != "" {
+		fmt.Fprintf(os.Stderr, "usage: %s [command] [options]\n\ncommands:\n", prog)
+	} else {
+		fmt.Fprintf(os.Stderr, "usage: %s <command> [options]\n\ncommands:\n", prog)
+	}
+	for _, name := range names {
+		help := commands[name].Help
+		if name == def {
+			help += " (default)"
+		}
+		fmt.Fprintf(os.Stderr, "  %-*s  %s\n", width, name, help)
+	}
+	fmt.Fprintf(os.Stderr, "\nrun \"%s <command> -h\" for the options of a command\n", prog)
+}
+
+// GlobList is a flag that can be repeated, -include '*.csv' -include '*.bz2'
+type GlobList []string
+
+func (g *GlobList) String() string {
+	return strings.Join(*g, ",")
+}
+
+func (g *GlobList) Set(pattern string) error {
+	if _, err := filepath.Match(pattern, ""); err != nil {
+		return fmt.Errorf("bad pattern %q: %w", pattern, err)
+	}
+	*g = append(*g, pattern)
+	return nil
+}
+
+// Match returns true if name (slash separated, relative to root) or its base
+// name matches one of the patterns
+func (g GlobList) Match(name string) bool {
+	for _, pattern := range g {
+		if ok, _ := filepath.Match(pattern, name); ok {
+			return true
+		}
+		if ok, _ := filepath.Match(pattern, path.Base(name)); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// TrimCompressExt removes a compression extension, taxi-01.csv.bz2 ->
+// taxi-01.csv
+func TrimCompressExt(name string) string {
+	for _, ext := range decompress.Extensions() {
+		if strings.HasSuffix(name, ext) && len(name) > len(ext) {
+			return strings.TrimSuffix(name, ext)
+		}
+	}
+	return name
+}
+
+// WriteFile calls write with the file at path, "-" is stdout. We write to a
+// temporary file and rename it, so a failed run won't leave a truncated file.
+func WriteFile(path string, write func(w io.Writer) error) error {
+	if path == "-" {
+		return write(os.Stdout)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if err := write(tmp); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// Plural returns n with one or many, "1 file", "2 files"
+func Plural(n int, one, many string) string {
+	if n == 1 {
+		return fmt.Sprintf("%d %s", n, one)
+	}
+	return fmt.Sprintf("%d %s", n, many)
+}
+
+// Size returns human readable size, 1.5MB
+func Size(n int64) string {
+	const unit = 1000
+	if n < unit {
+		return fmt.Sprintf("%dB", n)
+	}
+	div, exp := int64(unit), 0
+	for v := n / unit; v >= unit; v /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f%cB", float64(n)/float64(div), "kMGTPE"[exp])
+}
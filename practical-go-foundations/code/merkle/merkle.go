@@ -0,0 +1,420 @@
+// Package merkle builds a Merkle tree over a directory tree of files, so a
+// single root hash attests to a whole dataset.
+//
+// Every directory has a list of entries (files and sub directories) sorted by
+// name. An entry hash is
+//
+//	H(0x00 || kind || uvarint(len(name)) || name || digest)
+//
+// where kind is 'f' for files (digest is the file content digest) and 'd' for
+// directories (digest is the directory hash). The directory hash is the
+// RFC 6962 Merkle tree hash of its entry hashes, interior nodes are
+// H(0x01 || left || right). The root hash is the hash of the top directory.
+package merkle
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+
+	"day1/digest"
+)
+
+const (
+	leafPrefix = 0x00
+	nodePrefix = 0x01
+)
+
+// Node is a file or directory in the tree
+type Node struct {
+	Name     string // base name, "" for the root
+	Path     string // slash separated path from the root
+	Dir      bool
+	Digest   []byte  // file content digest or directory hash
+	Hash     []byte  // entry hash in the parent directory
+	Children []*Node // sorted by name, only for directories
+}
+
+// Tree is a Merkle tree over files
+type Tree struct {
+	Alg  digest.Algorithm
+	root *Node
+}
+
+// Build builds a tree from files, a map of slash separated path to content
+// digest.
+func Build(alg digest.Algorithm, files map[string][]byte) (*Tree, error) {
+	root := &Node{Dir: true}
+	for p, d := range files {
+		if !validPath(p) {
+			return nil, fmt.Errorf("bad path: %q", p)
+		}
+		if len(d) != alg.Size {
+			return nil, fmt.Errorf("%s: digest should be %d bytes, got %d", p, alg.Size, len(d))
+		}
+
+		dir := root
+		parts := strings.Split(p, "/")
+		for i, name := range parts {
+			last := i == len(parts)-1
+			child := dir.child(name)
+			if child == nil {
+				child = &Node{Name: name, Path: strings.Join(parts[:i+1], "/"), Dir: !last}
+				dir.Children = append(dir.Children, child)
+			}
+			if child.Dir == last {
+				return nil, fmt.Errorf("%s is both a file and a directory", child.Path)
+			}
+			if last {
+				child.Digest = d
+			}
+			dir = child
+		}
+	}
+
+	t := &Tree{Alg: alg, root: root}
+	t.hashDir(root)
+	return t, nil
+}
+
+// validPath returns true for clean relative paths inside the tree, no "..",
+// "." or empty elements
+func validPath(p string) bool {
+	if p == "" || path.IsAbs(p) || path.Clean(p) != p {
+		return false
+	}
+	for _, name := range strings.Split(p, "/") {
+		if name == "." || name == ".." {
+			return false
+		}
+	}
+	return true
+}
+
+func (n *Node) child(name string) *Node {
+	for _, c := range n.Children {
+		if c.Name == name {
+			return c
+		}
+	}
+	return nil
+}
+
+// hashDir computes digests & hashes bottom up
+func (t *Tree) hashDir(n *Node) {
+	sort.Slice(n.Children, func(i, j int) bool {
+		return n.Children[i].Name < n.Children[j].Name
+	})
+
+	hashes := make([][]byte, len(n.Children))
+	for i, c := range n.Children {
+		if c.Dir {
+			t.hashDir(c)
+		}
+		c.Hash = t.entryHash(c.Dir, c.Name, c.Digest)
+		hashes[i] = c.Hash
+	}
+	n.Digest = t.mth(hashes)
+}
+
+func (t *Tree) entryHash(dir bool, name string, d []byte) []byte {
+	kind := byte('f')
+	if dir {
+		kind = 'd'
+	}
+
+	h := t.Alg.New()
+	var buf [binary.MaxVarintLen64]byte
+	h.Write([]byte{leafPrefix, kind})
+	h.Write(buf[:binary.PutUvarint(buf[:], uint64(len(name)))])
+	h.Write([]byte(name))
+	h.Write(d)
+	return h.Sum(nil)
+}
+
+func (t *Tree) nodeHash(left, right []byte) []byte {
+	h := t.Alg.New()
+	h.Write([]byte{nodePrefix})
+	h.Write(left)
+	h.Write(right)
+	return h.Sum(nil)
+}
+
+// split returns the largest power of 2 smaller than n (n > 1)
+func split(n int) int {
+	k := 1
+	for k<<1 < n {
+		k <<= 1
+	}
+	return k
+}
+
+// mth is the RFC 6962 Merkle tree hash
+func (t *Tree) mth(hashes [][]byte) []byte {
+	switch len(hashes) {
+	case 0:
+		return t.Alg.New().Sum(nil)
+	case 1:
+		return hashes[0]
+	}
+	k := split(len(hashes))
+	return t.nodeHash(t.mth(hashes[:k]), t.mth(hashes[k:]))
+}
+
+// Root returns the RFC 6962 Merkle tree hash of a list of leaves, e.g. the
+// block digests of a file. Leaf hashes are H(0x00 || leaf).
+func Root(alg digest.Algorithm, leaves [][]byte) []byte {
+	t := &Tree{Alg: alg}
+	hashes := make([][]byte, len(leaves))
+	for i, leaf := range leaves {
+		h := alg.New()
+		h.Write([]byte{leafPrefix})
+		h.Write(leaf)
+		hashes[i] = h.Sum(nil)
+	}
+	return t.mth(hashes)
+}
+
+// auditPath is the RFC 6962 PATH(m, D[n])
+func (t *Tree) auditPath(m int, hashes [][]byte) [][]byte {
+	if len(hashes) <= 1 {
+		return nil
+	}
+	k := split(len(hashes))
+	if m < k {
+		return append(t.auditPath(m, hashes[:k]), t.mth(hashes[k:]))
+	}
+	return append(t.auditPath(m-k, hashes[k:]), t.mth(hashes[:k]))
+}
+
+// Root returns the root hash
+func (t *Tree) Root() []byte {
+	return t.root.Digest
+}
+
+// Find returns the node at path ("" is the root), nil if not found
+func (t *Tree) Find(p string) *Node {
+	n := t.root
+	if p == "" {
+		return n
+	}
+	for _, name := range strings.Split(p, "/") {
+		if n = n.child(name); n == nil {
+			return nil
+		}
+	}
+	return n
+}
+
+// Files returns all the files in the tree, sorted by path
+func (t *Tree) Files() []*Node {
+	var files []*Node
+	var walk func(n *Node)
+	walk = func(n *Node) {
+		for _, c := range n.Children {
+			if c.Dir {
+				walk(c)
+			} else {
+				files = append(files, c)
+			}
+		}
+	}
+	walk(t.root)
+	return files
+}
+
+// ChangeKind is the kind of difference between two trees
+type ChangeKind string
+
+const (
+	Modified ChangeKind = "modified"
+	Added    ChangeKind = "added"   // in actual, not in expected
+	Removed  ChangeKind = "removed" // in expected, not in actual
+)
+
+// Change is a difference between trees
+type Change struct {
+	Path string
+	Dir  bool
+	Kind ChangeKind
+}
+
+// Diff returns the differences between the expected and actual trees. Every
+// diverged directory is reported (parents before children), identical
+// subtrees are skipped by comparing hashes.
+func Diff(expected, actual *Tree) []Change {
+	var changes []Change
+	var diff func(e, a *Node)
+	diff = func(e, a *Node) {
+		if bytes.Equal(e.Digest, a.Digest) {
+			return
+		}
+		changes = append(changes, Change{Path: e.Path, Dir: true, Kind: Modified})
+
+		i, j := 0, 0
+		for i < len(e.Children) || j < len(a.Children) {
+			switch {
+			case j == len(a.Children) || (i < len(e.Children) && e.Children[i].Name < a.Children[j].Name):
+				changes = append(changes, Change{e.Children[i].Path, e.Children[i].Dir, Removed})
+				i++
+			case i == len(e.Children) || e.Children[i].Name > a.Children[j].Name:
+				changes = append(changes, Change{a.Children[j].Path, a.Children[j].Dir, Added})
+				j++
+			default:
+				ec, ac := e.Children[i], a.Children[j]
+				switch {
+				case ec.Dir != ac.Dir:
+					changes = append(changes, Change{ec.Path, ec.Dir, Removed}, Change{ac.Path, ac.Dir, Added})
+				case ec.Dir:
+					diff(ec, ac)
+				case !bytes.Equal(ec.Digest, ac.Digest):
+					changes = append(changes, Change{ec.Path, false, Modified})
+				}
+				i++
+				j++
+			}
+		}
+	}
+	diff(expected.root, actual.root)
+	return changes
+}
+
+// Level is a step of an inclusion proof, from the file up to the root
+type Level struct {
+	Name  string   `json:"name"` // entry name in the directory
+	Dir   bool     `json:"dir"`
+	Index int      `json:"index"` // entry index in the directory
+	Count int      `json:"count"` // number of entries in the directory
+	Path  []string `json:"path"`  // RFC 6962 audit path, hex
+}
+
+// Proof is an inclusion proof for a file
+type Proof struct {
+	Algorithm string  `json:"algorithm"`
+	Path      string  `json:"path"`
+	Digest    string  `json:"digest"` // file content digest, hex
+	Levels    []Level `json:"levels"`
+	Root      string  `json:"root"` // hex, what the proof was created for
+}
+
+// Prove returns an inclusion proof for the file at path
+func (t *Tree) Prove(p string) (*Proof, error) {
+	n := t.Find(p)
+	if n == nil || n.Dir {
+		return nil, fmt.Errorf("%s: file not in tree", p)
+	}
+
+	proof := &Proof{
+		Algorithm: t.Alg.Name,
+		Path:      p,
+		Digest:    hex.EncodeToString(n.Digest),
+		Root:      hex.EncodeToString(t.Root()),
+	}
+
+	parts := strings.Split(p, "/")
+	for i := len(parts) - 1; i >= 0; i-- {
+		dir := t.Find(strings.Join(parts[:i], "/"))
+		hashes := make([][]byte, len(dir.Children))
+		index := 0
+		for j, c := range dir.Children {
+			hashes[j] = c.Hash
+			if c.Name == parts[i] {
+				index = j
+			}
+		}
+
+		var path []string
+		for _, h := range t.auditPath(index, hashes) {
+			path = append(path, hex.EncodeToString(h))
+		}
+		proof.Levels = append(proof.Levels, Level{
+			Name:  parts[i],
+			Dir:   i < len(parts)-1,
+			Index: index,
+			Count: len(hashes),
+			Path:  path,
+		})
+	}
+
+	return proof, nil
+}
+
+// FilePath returns the path of the file the levels prove, Path is only a label
+// that isn't hashed
+func (p *Proof) FilePath() string {
+	names := make([]string, len(p.Levels))
+	for i, l := range p.Levels {
+		names[len(names)-1-i] = l.Name
+	}
+	return strings.Join(names, "/")
+}
+
+// ComputeRoot returns the root hash the proof leads to, starting from the file
+// content digest d. Compare it to a trusted root hash. Path must be the path
+// the levels prove.
+func (p *Proof) ComputeRoot(d []byte) ([]byte, error) {
+	alg, err := digest.ByName(p.Algorithm)
+	if err != nil {
+		return nil, err
+	}
+	if len(d) != alg.Size {
+		return nil, fmt.Errorf("digest should be %d bytes, got %d", alg.Size, len(d))
+	}
+	if fp := p.FilePath(); fp != p.Path || !validPath(fp) {
+		return nil, fmt.Errorf("path %q doesn't match the proof levels (%q)", p.Path, fp)
+	}
+
+	t := &Tree{Alg: alg}
+	for i, l := range p.Levels {
+		if l.Dir != (i > 0) {
+			return nil, fmt.Errorf("%s: only the first level is a file", l.Name)
+		}
+		if l.Index < 0 || l.Index >= l.Count {
+			return nil, fmt.Errorf("%s: bad index %d of %d", l.Name, l.Index, l.Count)
+		}
+		path := make([][]byte, len(l.Path))
+		for i, s := range l.Path {
+			if path[i], err = hex.DecodeString(s); err != nil {
+				return nil, fmt.Errorf("%s: %w", l.Name, err)
+			}
+		}
+
+		leaf := t.entryHash(l.Dir, l.Name, d)
+		if d, err = t.rootFromPath(leaf, l.Index, l.Count, path); err != nil {
+			return nil, fmt.Errorf("%s: %w", l.Name, err)
+		}
+	}
+
+	return d, nil
+}
+
+func (t *Tree) rootFromPath(leaf []byte, index, count int, path [][]byte) ([]byte, error) {
+	if count == 1 {
+		if len(path) != 0 {
+			return nil, fmt.Errorf("audit path too long")
+		}
+		return leaf, nil
+	}
+	if len(path) == 0 {
+		return nil, fmt.Errorf("audit path too short")
+	}
+
+	k := split(count)
+	last, rest := path[len(path)-1], path[:len(path)-1]
+	if index < k {
+		left, err := t.rootFromPath(leaf, index, k, rest)
+		if err != nil {
+			return nil, err
+		}
+		return t.nodeHash(left, last), nil
+	}
+	right, err := t.rootFromPath(leaf, index-k, count-k, rest)
+	if err != nil {
+		return nil, err
+	}
+	return t.nodeHash(last, right), nil
+}
@@ -0,0 +1,215 @@
+package merkle
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"reflect"
+	"testing"
+
+	"day1/digest"
+)
+
+// RFC 6962 test vectors, from the certificate transparency reference
+// implementation: the leaves and the tree hash of the first n of them
+var (
+	rfcLeaves = []string{
+		"",
+		"00",
+		"10",
+		"2021",
+		"3031",
+		"40414243",
+		"5051525354555657",
+		"606162636465666768696a6b6c6d6e6f",
+	}
+	rfcRoots = []string{
+		"e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855",
+		"6e340b9cffb37a989ca544e6bb780a2c78901d3fb33738768511a30617afa01d",
+		"fac54203e7cc696cf0dfcb42c92a1d9dbaf70ad9e621f4bd8d98662f00e3c125",
+		"aeb6bcfe274b70a14fb067a5e5578264db0fa9b51af5e0ba159158f329e06e77",
+		"d37ee418976dd95753c1c73862b9398fa2a2cf9b4ff0fdfe8b30cd95209614b7",
+		"4e3bbb1f7b478dcfe71fb631631519a3bca12c9aefca1612bfce4c13a86264d4",
+		"76e67dadbcdf1e10e1b74ddc608abd2f98dfb16fbce75277b5232a127f2087ef",
+		"ddb89be403809e325750d3d263cd78929c2942b7942a34b77e122c9594a74c8c",
+		"5dc9da79a70659a9ad559cb701ded9a2ab9d823aad2f4960cfe370eff4604328",
+	}
+)
+
+func rfcLeafData(t *testing.T) [][]byte {
+	t.Helper()
+	leaves := make([][]byte, len(rfcLeaves))
+	for i, s := range rfcLeaves {
+		b, err := hex.DecodeString(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		leaves[i] = b
+	}
+	return leaves
+}
+
+func TestRootRFC6962(t *testing.T) {
+	leaves := rfcLeafData(t)
+	for n, want := range rfcRoots {
+		if got := hex.EncodeToString(Root(digest.SHA256, leaves[:n])); got != want {
+			t.Errorf("%d leaves: got %s, want %s", n, got, want)
+		}
+	}
+}
+
+// Every audit path of every RFC tree size leads back to the root
+func TestAuditPathRFC6962(t *testing.T) {
+	tree := &Tree{Alg: digest.SHA256}
+	leaves := rfcLeafData(t)
+	for n := 1; n <= len(leaves); n++ {
+		hashes := make([][]byte, n)
+		for i, leaf := range leaves[:n] {
+			hashes[i] = leafHash(leaf)
+		}
+		for m := 0; m < n; m++ {
+			path := tree.auditPath(m, hashes)
+			root, err := tree.rootFromPath(hashes[m], m, n, path)
+			if err != nil {
+				t.Fatalf("leaf %d of %d: %s", m, n, err)
+			}
+			if got := hex.EncodeToString(root); got != rfcRoots[n] {
+				t.Errorf("leaf %d of %d: got %s, want %s", m, n, got, rfcRoots[n])
+			}
+			if _, err := tree.rootFromPath(hashes[m], m, n, append(path, hashes[m])); err == nil && n > 1 {
+				t.Errorf("leaf %d of %d: no error for a long path", m, n)
+			}
+		}
+	}
+}
+
+func leafHash(leaf []byte) []byte {
+	h := sha256.New()
+	h.Write([]byte{leafPrefix})
+	h.Write(leaf)
+	return h.Sum(nil)
+}
+
+func sum(s string) []byte {
+	d := sha256.Sum256([]byte(s))
+	return d[:]
+}
+
+func testTree(t *testing.T, files map[string]string) *Tree {
+	t.Helper()
+	digests := make(map[string][]byte, len(files))
+	for p, content := range files {
+		digests[p] = sum(content)
+	}
+	tree, err := Build(digest.SHA256, digests)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tree
+}
+
+func TestBuildErrors(t *testing.T) {
+	bad := []map[string][]byte{
+		{"../etc/passwd": sum("")},
+		{"/etc/passwd": sum("")},
+		{"a/./b": sum("")},
+		{"a//b": sum("")},
+		{"a/": sum("")},
+		{"": sum("")},
+		{"a": sum("")[:10]},
+		{"a": sum(""), "a/b": sum("")},
+	}
+	for _, files := range bad {
+		if _, err := Build(digest.SHA256, files); err == nil {
+			t.Errorf("%v: no error", files)
+		}
+	}
+}
+
+func TestProve(t *testing.T) {
+	files := map[string]string{
+		"a.txt":       "a",
+		"b/c.txt":     "c",
+		"b/d.txt":     "d",
+		"b/e/f.txt":   "f",
+		"g.txt":       "g",
+		"h/i/j/k.txt": "k",
+	}
+	tree := testTree(t, files)
+	root := hex.EncodeToString(tree.Root())
+
+	for p, content := range files {
+		proof, err := tree.Prove(p)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if proof.FilePath() != p {
+			t.Errorf("%s: proof levels are for %s", p, proof.FilePath())
+		}
+		got, err := proof.ComputeRoot(sum(content))
+		if err != nil {
+			t.Fatalf("%s: %s", p, err)
+		}
+		if hex.EncodeToString(got) != root {
+			t.Errorf("%s: proof leads to %x, want %s", p, got, root)
+		}
+
+		if got, _ := proof.ComputeRoot(sum("changed")); hex.EncodeToString(got) == root {
+			t.Errorf("%s: changed content has the same root", p)
+		}
+	}
+
+	if _, err := tree.Prove("b"); err == nil {
+		t.Error("proof for a directory")
+	}
+	if _, err := tree.Prove("nope.txt"); err == nil {
+		t.Error("proof for a missing file")
+	}
+}
+
+func TestProofRelabeled(t *testing.T) {
+	tree := testTree(t, map[string]string{"a.txt": "a", "b.txt": "b"})
+	proof, err := tree.Prove("a.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	proof.Path = "b.txt"
+	if _, err := proof.ComputeRoot(sum("a")); err == nil {
+		t.Error("no error for a proof with another path")
+	}
+
+	proof.Path = "a.txt"
+	proof.Levels[0].Dir = true
+	if _, err := proof.ComputeRoot(sum("a")); err == nil {
+		t.Error("no error for a file level marked as a directory")
+	}
+}
+
+func TestDiff(t *testing.T) {
+	expected := testTree(t, map[string]string{
+		"a.txt":   "a",
+		"b/c.txt": "c",
+		"b/d.txt": "d",
+		"e/f.txt": "f",
+	})
+	actual := testTree(t, map[string]string{
+		"a.txt":   "a",
+		"b/c.txt": "changed",
+		"b/x.txt": "x",
+		"e/f.txt": "f",
+	})
+
+	want := []Change{
+		{"", true, Modified},
+		{"b", true, Modified},
+		{"b/c.txt", false, Modified},
+		{"b/d.txt", false, Removed},
+		{"b/x.txt", false, Added},
+	}
+	if got := Diff(expected, actual); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	if got := Diff(expected, expected); len(got) != 0 {
+		t.Errorf("same tree: got %v", got)
+	}
+}
@@ -1,23 +1,30 @@
 package main
 
 import (
-	"compress/gzip"
-	"crypto/sha1"
+	"flag"
 	"fmt"
-	"io"
 	"log"
-	"os"
-	"strings"
+
+	"day1/decompress"
+	"day1/digest"
 )
 
 func main() {
-	sig, err := shaSum("http.log.gz")
+	algo := flag.String("algo", "sha1", "hash algorithm (md5, sha1, sha224, sha256, sha384, sha512, sha512/256)")
+	flag.Parse()
+
+	alg, err := digest.ByName(*algo)
+	if err != nil {
+		log.Fatalf("error: %s", err)
+	}
+
+	sig, err := shaSum("http.log.gz", alg)
 	if err != nil {
 		log.Fatalf("error: %s", err)
 	}
 	fmt.Println(sig)
 
-	sig, err = shaSum("sha1.go")
+	sig, err = shaSum("sha1.go", alg)
 	if err != nil {
 		log.Fatalf("error: %s", err)
 	}
@@ -25,40 +32,25 @@ func main() {
 }
 
 /*
-if file names ends with .gz
+if file is compressed (gzip, bzip2, ...)
 
 	cat http.log.gz| gunzip | shasum
 
 else
 
 	ca http.log.gz | shasum
+
+The format is detected from the file content, not the name.
 */
-func shaSum(fileName string) (string, error) {
+func shaSum(fileName string, alg digest.Algorithm) (string, error) {
 	// idiom: acquire a resource, check for error, defer release
-	file, err := os.Open(fileName)
+	r, err := decompress.Open(fileName) // uncompress file content
 	if err != nil {
-		return "", nil
+		return "", err
 	}
 	// multiple defers are called in LIFO order
-	defer file.Close() // this will close the file whenver the function exits, happens in fxn level
+	defer r.Close() // this will close the file whenver the function exits, happens in fxn level
 
-	var r io.Reader = file
-	if strings.HasSuffix(fileName, ".gz") {
-		gz, err := gzip.NewReader(file) // uncompress file content
-		if err != nil {
-			return "", err
-		}
-		defer gz.Close()
-		r = gz
-	}
 	//io.CopyN(os.Stdout, r, 100)
-	w := sha1.New()
-
-	if _, err := io.Copy(w, r); err != nil {
-		return "", err
-	}
-
-	sig := w.Sum(nil)
-
-	return fmt.Sprintf("%x", sig), nil
+	return digest.Sum(alg, r) // hashes the decompressed content, like "gunzip | shasum"
 }
@@ -0,0 +1,113 @@
+package stats
+
+import (
+	"fmt"
+	"hash/fnv"
+	"math"
+	"math/bits"
+)
+
+// DefaultPrecision is the HyperLogLog precision used by NewHLL when precision
+// is 0: 2^14 registers (16KB), the standard error is 1.04/sqrt(2^14) ≈ 0.8%.
+const DefaultPrecision = 14
+
+// HLL is a HyperLogLog distinct counter (Flajolet et al.), with linear
+// counting for small cardinalities. Values are hashed to 64 bits so there's
+// no need for the large range correction.
+type HLL struct {
+	p         uint8
+	registers []uint8
+}
+
+// NewHLL returns an empty counter with 2^precision registers, precision
+// should be between 4 and 18
+func NewHLL(precision uint8) (*HLL, error) {
+	if precision == 0 {
+		precision = DefaultPrecision
+	}
+	if precision < 4 || precision > 18 {
+		return nil, fmt.Errorf("HLL precision %d not in 4-18", precision)
+	}
+	return &HLL{p: precision, registers: make([]uint8, 1<<precision)}, nil
+}
+
+// mix is the splitmix64 finalizer, it spreads the bits of x over the whole
+// hash which FNV does poorly on short input
+func mix(x uint64) uint64 {
+	x ^= x >> 30
+	x *= 0xbf58476d1ce4e5b9
+	x ^= x >> 27
+	x *= 0x94d049bb133111eb
+	x ^= x >> 31
+	return x
+}
+
+// Add adds a value
+func (h *HLL) Add(b []byte) {
+	f := fnv.New64a()
+	f.Write(b)
+	h.addHash(mix(f.Sum64()))
+}
+
+// AddString adds a value
+func (h *HLL) AddString(s string) {
+	h.Add([]byte(s))
+}
+
+// AddUint64 adds a value, e.g. a key built from several integer fields
+func (h *HLL) AddUint64(v uint64) {
+	h.addHash(mix(v))
+}
+
+func (h *HLL) addHash(x uint64) {
+	i := x >> (64 - h.p)
+	// rank of the first 1 bit in the rest, the guard bit caps it at 64-p+1
+	rank := uint8(bits.LeadingZeros64(x<<h.p|1<<(h.p-1))) + 1
+	if rank > h.registers[i] {
+		h.registers[i] = rank
+	}
+}
+
+// Merge adds the values of o, both need the same precision
+func (h *HLL) Merge(o *HLL) error {
+	if h.p != o.p {
+		return fmt.Errorf("can't merge HLL precision %d with %d", o.p, h.p)
+	}
+	for i, r := range o.registers {
+		if r > h.registers[i] {
+			h.registers[i] = r
+		}
+	}
+	return nil
+}
+
+// Count returns the estimated number of distinct values
+func (h *HLL) Count() uint64 {
+	m := float64(len(h.registers))
+	sum := 0.0
+	zeros := 0
+	for _, r := range h.registers {
+		sum += math.Ldexp(1, -int(r))
+		if r == 0 {
+			zeros++
+		}
+	}
+
+	var alpha float64
+	switch len(h.registers) {
+	case 16:
+		alpha = 0.673
+	case 32:
+		alpha = 0.697
+	case 64:
+		alpha = 0.709
+	default:
+		alpha = 0.7213 / (1 + 1.079/m)
+	}
+	est := alpha * m * m / sum
+
+	if est <= 2.5*m && zeros > 0 {
+		est = m * math.Log(m/float64(zeros)) // linear counting
+	}
+	return uint64(est + 0.5)
+}
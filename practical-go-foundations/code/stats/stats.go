@@ -0,0 +1,104 @@
+// Package stats has streaming statistics that use constant (or bounded)
+// memory regardless of the number of values: Moments (count, mean,
+// variance), Digest (approximate quantiles) and HLL (approximate distinct
+// count).
+//
+// All of them can be merged, so every goroutine can work on its part of the
+// data and the results combined at the end.
+package stats
+
+import (
+	"math"
+)
+
+// Moments computes count, mean, variance, min and max of a stream of values
+// using Welford's algorithm, which doesn't lose precision like summing
+// squares does. The zero value is ready to use.
+type Moments struct {
+	n    int64
+	mean float64
+	m2   float64 // sum of squared differences from the mean
+	min  float64
+	max  float64
+}
+
+// Add adds a value
+func (m *Moments) Add(x float64) {
+	if m.n == 0 {
+		m.min, m.max = x, x
+	}
+	if x < m.min {
+		m.min = x
+	}
+	if x > m.max {
+		m.max = x
+	}
+
+	m.n++
+	d := x - m.mean
+	m.mean += d / float64(m.n)
+	m.m2 += d * (x - m.mean)
+}
+
+// Merge adds the values of o (Chan et al. parallel algorithm)
+func (m *Moments) Merge(o *Moments) {
+	if o.n == 0 {
+		return
+	}
+	if m.n == 0 {
+		*m = *o
+		return
+	}
+
+	n := m.n + o.n
+	d := o.mean - m.mean
+	m.mean += d * float64(o.n) / float64(n)
+	m.m2 += o.m2 + d*d*float64(m.n)*float64(o.n)/float64(n)
+	m.n = n
+	if o.min < m.min {
+		m.min = o.min
+	}
+	if o.max > m.max {
+		m.max = o.max
+	}
+}
+
+// Count returns the number of values
+func (m *Moments) Count() int64 { return m.n }
+
+// Mean returns the mean, NaN if there are no values
+func (m *Moments) Mean() float64 {
+	if m.n == 0 {
+		return math.NaN()
+	}
+	return m.mean
+}
+
+// Variance returns the sample variance, NaN if there are less than two values
+func (m *Moments) Variance() float64 {
+	if m.n < 2 {
+		return math.NaN()
+	}
+	return m.m2 / float64(m.n-1)
+}
+
+// StdDev returns the sample standard deviation
+func (m *Moments) StdDev() float64 {
+	return math.Sqrt(m.Variance())
+}
+
+// Min returns the smallest value, NaN if there are no values
+func (m *Moments) Min() float64 {
+	if m.n == 0 {
+		return math.NaN()
+	}
+	return m.min
+}
+
+// Max returns the largest value, NaN if there are no values
+func (m *Moments) Max() float64 {
+	if m.n == 0 {
+		return math.NaN()
+	}
+	return m.max
+}
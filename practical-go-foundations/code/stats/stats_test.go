@@ -0,0 +1,167 @@
+package stats
+
+import (
+	"math"
+	"math/rand"
+	"sort"
+	"strconv"
+	"testing"
+)
+
+func TestMoments(t *testing.T) {
+	var m Moments
+	if !math.IsNaN(m.Mean()) || !math.IsNaN(m.Min()) || !math.IsNaN(m.Variance()) {
+		t.Error("empty moments aren't NaN")
+	}
+
+	for _, x := range []float64{2, 4, 4, 4, 5, 5, 7, 9} {
+		m.Add(x)
+	}
+	if m.Count() != 8 || m.Mean() != 5 || m.Min() != 2 || m.Max() != 9 {
+		t.Errorf("count %d, mean %v, min %v, max %v", m.Count(), m.Mean(), m.Min(), m.Max())
+	}
+	if v := m.Variance(); math.Abs(v-32.0/7) > 1e-12 {
+		t.Errorf("variance %v, want %v", v, 32.0/7)
+	}
+
+	var one Moments
+	one.Add(3)
+	if !math.IsNaN(one.Variance()) {
+		t.Errorf("variance of one value %v, want NaN", one.Variance())
+	}
+}
+
+// Merged moments are the same as the moments of all the values
+func TestMomentsMerge(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+	var all, a, b Moments
+	for i := 0; i < 1000; i++ {
+		x := rnd.NormFloat64()*10 + 1e6 // large mean, small variance
+		all.Add(x)
+		if i%3 == 0 {
+			a.Add(x)
+		} else {
+			b.Add(x)
+		}
+	}
+
+	var empty Moments
+	a.Merge(&empty)
+	a.Merge(&b)
+	if a.Count() != all.Count() || a.Min() != all.Min() || a.Max() != all.Max() {
+		t.Errorf("merged count %d, min %v, max %v; want %d, %v, %v", a.Count(), a.Min(), a.Max(), all.Count(), all.Min(), all.Max())
+	}
+	if math.Abs(a.Mean()-all.Mean()) > 1e-6 || math.Abs(a.Variance()-all.Variance())/all.Variance() > 1e-9 {
+		t.Errorf("merged mean %v, variance %v; want %v, %v", a.Mean(), a.Variance(), all.Mean(), all.Variance())
+	}
+
+	empty.Merge(&all)
+	if empty.Count() != all.Count() || empty.Mean() != all.Mean() {
+		t.Error("merge to empty moments")
+	}
+}
+
+// quantile is the exact q quantile of sorted values
+func quantile(sorted []float64, q float64) float64 {
+	return sorted[int(q*float64(len(sorted)-1))]
+}
+
+func TestDigest(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+	const n = 100000
+	values := make([]float64, n)
+	d1, d2 := NewDigest(0), NewDigest(0)
+	for i := range values {
+		values[i] = rnd.ExpFloat64() // skewed, like trip distances
+		if i%2 == 0 {
+			d1.Add(values[i])
+		} else {
+			d2.Add(values[i])
+		}
+	}
+	d1.Merge(d2)
+	sort.Float64s(values)
+
+	if d1.Count() != n {
+		t.Errorf("count %d, want %d", d1.Count(), n)
+	}
+	if d1.Quantile(0) != values[0] || d1.Quantile(1) != values[n-1] {
+		t.Errorf("min %v, max %v; want %v, %v", d1.Quantile(0), d1.Quantile(1), values[0], values[n-1])
+	}
+
+	// The error is in rank, check the estimate is between the values at
+	// q ± 0.5%
+	for _, q := range []float64{0.001, 0.01, 0.1, 0.25, 0.5, 0.75, 0.9, 0.99, 0.999} {
+		got := d1.Quantile(q)
+		lo := quantile(values, math.Max(q-0.005, 0))
+		hi := quantile(values, math.Min(q+0.005, 1))
+		if got < lo || got > hi {
+			t.Errorf("q %v: got %v, want between %v and %v (exact %v)", q, got, lo, hi, quantile(values, q))
+		}
+	}
+}
+
+func TestDigestEdges(t *testing.T) {
+	d := NewDigest(0)
+	if !math.IsNaN(d.Median()) {
+		t.Error("median of no values isn't NaN")
+	}
+	d.Add(math.NaN())
+	if d.Count() != 0 {
+		t.Error("NaN was added")
+	}
+	d.Add(42)
+	if d.Median() != 42 || d.Quantile(0.99) != 42 {
+		t.Errorf("one value: median %v", d.Median())
+	}
+	if !math.IsNaN(d.Quantile(1.5)) {
+		t.Error("quantile out of 0-1 isn't NaN")
+	}
+}
+
+func TestHLL(t *testing.T) {
+	for _, n := range []int{0, 1, 100, 10000, 1000000} {
+		h, err := NewHLL(0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i := 0; i < n; i++ {
+			h.AddString("key-" + strconv.Itoa(i))
+			h.AddString("key-" + strconv.Itoa(i/2)) // duplicates
+		}
+		// 4 standard errors of 0.8%, small counts are exact-ish
+		got := float64(h.Count())
+		if math.Abs(got-float64(n)) > 0.033*float64(n)+1 {
+			t.Errorf("%d distinct values: got %v", n, got)
+		}
+	}
+}
+
+func TestHLLMerge(t *testing.T) {
+	a, _ := NewHLL(12)
+	b, _ := NewHLL(12)
+	all, _ := NewHLL(12)
+	for i := uint64(0); i < 50000; i++ {
+		all.AddUint64(i)
+		if i < 30000 {
+			a.AddUint64(i)
+		}
+		if i >= 20000 {
+			b.AddUint64(i)
+		}
+	}
+	if err := a.Merge(b); err != nil {
+		t.Fatal(err)
+	}
+	if a.Count() != all.Count() {
+		t.Errorf("merged %d, want %d", a.Count(), all.Count())
+	}
+
+	c, _ := NewHLL(10)
+	if err := a.Merge(c); err == nil {
+		t.Error("merged HLLs of different precision")
+	}
+	if _, err := NewHLL(20); err == nil {
+		t.Error("precision 20 accepted")
+	}
+}
@@ -0,0 +1,178 @@
+package stats
+
+import (
+	"math"
+	"sort"
+)
+
+// DefaultCompression is the t-digest compression used by NewDigest when
+// compression is <= 0. The digest keeps about compression centroids, with 200
+// quantiles are typically within 0.1% of the rank, and better at the tails.
+const DefaultCompression = 200
+
+// centroid is the mean of weight values
+type centroid struct {
+	mean   float64
+	weight float64
+}
+
+// Digest is a merging t-digest (Dunning & Ertl, "Computing extremely accurate
+// quantiles using t-digests"). Values are buffered and merged into centroids
+// when the buffer fills, centroids near the tails are kept small so extreme
+// quantiles are accurate.
+type Digest struct {
+	compression float64
+	centroids   []centroid // merged, sorted by mean
+	buf         []centroid // not merged yet
+	count       float64
+	min         float64
+	max         float64
+}
+
+// NewDigest returns an empty digest
+func NewDigest(compression float64) *Digest {
+	if compression <= 0 {
+		compression = DefaultCompression
+	}
+	return &Digest{
+		compression: compression,
+		buf:         make([]centroid, 0, bufferSize(compression)),
+		min:         math.Inf(1),
+		max:         math.Inf(-1),
+	}
+}
+
+func bufferSize(compression float64) int {
+	return int(5 * compression)
+}
+
+// Add adds a value, NaNs are ignored
+func (d *Digest) Add(x float64) {
+	d.addCentroid(centroid{x, 1})
+}
+
+func (d *Digest) addCentroid(c centroid) {
+	if math.IsNaN(c.mean) || c.weight <= 0 {
+		return
+	}
+	if c.mean < d.min {
+		d.min = c.mean
+	}
+	if c.mean > d.max {
+		d.max = c.mean
+	}
+	d.count += c.weight
+	d.buf = append(d.buf, c)
+	if len(d.buf) >= bufferSize(d.compression) {
+		d.compress()
+	}
+}
+
+// Merge adds the values of o, o isn't changed
+func (d *Digest) Merge(o *Digest) {
+	for _, c := range o.centroids {
+		d.addCentroid(c)
+	}
+	for _, c := range o.buf {
+		d.addCentroid(c)
+	}
+	// centroid extremes are means, o may have seen more extreme values
+	if o.count > 0 {
+		if o.min < d.min {
+			d.min = o.min
+		}
+		if o.max > d.max {
+			d.max = o.max
+		}
+	}
+}
+
+// Count returns the number of values
+func (d *Digest) Count() int64 {
+	return int64(d.count)
+}
+
+// k is the k1 scale function, it maps a quantile to an index where
+// neighbouring centroids are at most 1 apart
+func (d *Digest) k(q float64) float64 {
+	return d.compression / (2 * math.Pi) * math.Asin(2*q-1)
+}
+
+// kInv is the inverse of k
+func (d *Digest) kInv(k float64) float64 {
+	return (math.Sin(k*2*math.Pi/d.compression) + 1) / 2
+}
+
+// compress merges the buffer into the centroids
+func (d *Digest) compress() {
+	if len(d.buf) == 0 {
+		return
+	}
+
+	all := append(d.buf, d.centroids...)
+	sort.Slice(all, func(i, j int) bool { return all[i].mean < all[j].mean })
+
+	merged := make([]centroid, 0, len(d.centroids)+1)
+	cur := all[0]
+	before := 0.0 // weight of the centroids before cur
+	limit := d.kInv(d.k(0) + 1)
+	for _, c := range all[1:] {
+		if (before+cur.weight+c.weight)/d.count <= limit {
+			// weighted mean, written this way to keep precision
+			cur.weight += c.weight
+			cur.mean += (c.mean - cur.mean) * c.weight / cur.weight
+			continue
+		}
+		merged = append(merged, cur)
+		before += cur.weight
+		limit = d.kInv(d.k(before/d.count) + 1)
+		cur = c
+	}
+	merged = append(merged, cur)
+
+	d.centroids = merged
+	d.buf = d.buf[:0]
+	if cap(d.buf) < bufferSize(d.compression) {
+		d.buf = make([]centroid, 0, bufferSize(d.compression))
+	}
+}
+
+// Quantile returns the approximate q quantile (0 <= q <= 1), NaN if there are
+// no values
+func (d *Digest) Quantile(q float64) float64 {
+	d.compress()
+	if d.count == 0 || q < 0 || q > 1 {
+		return math.NaN()
+	}
+	cs := d.centroids
+	if len(cs) == 1 {
+		return cs[0].mean
+	}
+
+	// Every centroid is at the middle of its weight, interpolate between
+	// them. Before the first and after the last interpolate with min & max.
+	index := q * d.count
+	if index <= cs[0].weight/2 {
+		return d.min + (cs[0].mean-d.min)*index/(cs[0].weight/2)
+	}
+	last := cs[len(cs)-1]
+	if index >= d.count-last.weight/2 {
+		rest := d.count - index
+		return d.max - (d.max-last.mean)*rest/(last.weight/2)
+	}
+
+	center := cs[0].weight / 2
+	for i := 0; i < len(cs)-1; i++ {
+		gap := (cs[i].weight + cs[i+1].weight) / 2
+		if index <= center+gap {
+			return cs[i].mean + (cs[i+1].mean-cs[i].mean)*(index-center)/gap
+		}
+		center += gap
+	}
+	return last.mean
+}
+
+// Median returns the approximate median
+func (d *Digest) Median() float64 {
+	return d.Quantile(0.5)
+}
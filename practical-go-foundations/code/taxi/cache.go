@@ -0,0 +1,162 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+const cacheVersion = 1
+
+// cacheEntry is what we know about a file the last time we hashed it
+type cacheEntry struct {
+	Size         int64     `json:"size"`
+	ModTime      time.Time `json:"mtime"`
+	Inode        uint64    `json:"inode"`
+	Algorithm    string    `json:"algorithm"`
+	Decompressed bool      `json:"decompressed"`
+	Digest       string    `json:"digest"`
+	BytesRead    int64     `json:"bytes_read"`
+	Chunk        int64     `json:"chunk,omitempty"`  // block size in chunked mode
+	Blocks       []string  `json:"blocks,omitempty"` // block digests in chunked mode
+}
+
+// sigCache is a persistent cache of file signatures, keyed by absolute path.
+// An entry is used only if the file size, mtime and inode didn't change and
+// it was computed with the same algorithm (and block size in chunked mode).
+type sigCache struct {
+	path string
+
+	mu    sync.Mutex
+	files map[string]cacheEntry
+	used  map[string]bool // entries looked up or added in this run
+}
+
+func cacheFileName(index string) string {
+	return index + ".cache"
+}
+
+// loadCache loads the cache from path, a missing or unreadable cache is an
+// empty one (we'll just rehash)
+func loadCache(path string) *sigCache {
+	c := &sigCache{
+		path:  path,
+		files: make(map[string]cacheEntry),
+		used:  make(map[string]bool),
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return c
+	}
+
+	var doc struct {
+		Version int                   `json:"version"`
+		Files   map[string]cacheEntry `json:"files"`
+	}
+	if err := json.Unmarshal(data, &doc); err != nil || doc.Version != cacheVersion {
+		return c
+	}
+	if doc.Files != nil {
+		c.files = doc.Files
+	}
+	return c
+}
+
+func cacheKey(path string) string {
+	if abs, err := filepath.Abs(path); err == nil {
+		return abs
+	}
+	return path
+}
+
+// lookup returns the cached entry for path if it's still valid, info is the
+// current file info and se the index entry
+func (c *sigCache) lookup(path string, info os.FileInfo, se sigEntry) (cacheEntry, bool) {
+	key := cacheKey(path)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.used[key] = true
+
+	e, ok := c.files[key]
+	if !ok || rehash {
+		return cacheEntry{}, false
+	}
+
+	valid := e.Size == info.Size() &&
+		e.ModTime.Equal(info.ModTime()) &&
+		e.Inode == inode(info) &&
+		e.Algorithm == se.alg.Name &&
+		e.Decompressed == !se.raw &&
+		e.Chunk == se.chunk
+	return e, valid
+}
+
+// add stores the signature of path from r. info is the file info from before
+// hashing, so a file changed while we hash it won't match next time.
+func (c *sigCache) add(path string, info os.FileInfo, se sigEntry, r *result, start time.Time) {
+	// A file modified in the same second we hash it might change again
+	// without changing mtime on file systems with coarse timestamps
+	if start.Sub(info.ModTime()) < time.Second {
+		return
+	}
+
+	key := cacheKey(path)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.used[key] = true
+	c.files[key] = cacheEntry{
+		Size:         info.Size(),
+		ModTime:      info.ModTime(),
+		Inode:        inode(info),
+		Algorithm:    se.alg.Name,
+		Decompressed: !se.raw,
+		Digest:       r.signature,
+		BytesRead:    r.bytesRead,
+		Chunk:        se.chunk,
+		Blocks:       r.blocks,
+	}
+}
+
+// save writes the cache, entries of files not seen in this run are dropped
+func (c *sigCache) save() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	files := make(map[string]cacheEntry)
+	for key, e := range c.files {
+		if c.used[key] {
+			files[key] = e
+		}
+	}
+
+	doc := struct {
+		Version int                   `json:"version"`
+		Files   map[string]cacheEntry `json:"files"`
+	}{cacheVersion, files}
+	data, err := json.MarshalIndent(doc, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(c.path), ".cache-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp.Name(), c.path); err != nil {
+		return fmt.Errorf("can't save cache: %w", err)
+	}
+	return nil
+}
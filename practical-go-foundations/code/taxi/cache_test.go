@@ -0,0 +1,185 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"day1/digest"
+)
+
+// cachedFile writes data to path with an mtime in the past (so it can be
+// cached), caches it and returns its info
+func cachedFile(t *testing.T, c *sigCache, path string, data []byte, se sigEntry) os.FileInfo {
+	t.Helper()
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	mtime := time.Now().Add(-time.Hour).Truncate(time.Second)
+	if err := os.Chtimes(path, mtime, mtime); err != nil {
+		t.Fatal(err)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.add(path, info, se, &result{signature: sha256Hex(data), bytesRead: int64(len(data))}, time.Now())
+	return info
+}
+
+func TestCacheLookup(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "taxi-01.csv")
+	se := sigEntry{name: "taxi-01.csv", alg: digest.SHA256}
+	c := loadCache(filepath.Join(dir, "SUMS.cache"))
+	info := cachedFile(t, c, path, []byte("data"), se)
+
+	if e, ok := c.lookup(path, info, se); !ok || e.Digest != sha256Hex([]byte("data")) {
+		t.Fatalf("unchanged file: got %+v, %v", e, ok)
+	}
+
+	// Other ways to hash the same file
+	entries := map[string]sigEntry{
+		"algorithm": {name: se.name, alg: digest.MD5},
+		"raw":       {name: se.name, alg: se.alg, raw: true},
+		"chunk":     {name: se.name, alg: se.alg, chunk: 4096},
+	}
+	for name, other := range entries {
+		if _, ok := c.lookup(path, info, other); ok {
+			t.Errorf("%s changed: cache used", name)
+		}
+	}
+
+	rehash = true
+	if _, ok := c.lookup(path, info, se); ok {
+		t.Errorf("-rehash: cache used")
+	}
+	rehash = false
+}
+
+// Any change to size, mtime or inode invalidates the entry
+func TestCacheInvalidation(t *testing.T) {
+	se := sigEntry{name: "taxi-01.csv", alg: digest.SHA256}
+	stat := func(path string) os.FileInfo {
+		info, err := os.Stat(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return info
+	}
+
+	cases := map[string]func(path string, info os.FileInfo){
+		"size": func(path string, info os.FileInfo) {
+			if err := os.WriteFile(path, []byte("more data"), 0644); err != nil {
+				t.Fatal(err)
+			}
+			os.Chtimes(path, info.ModTime(), info.ModTime())
+		},
+		"mtime": func(path string, info os.FileInfo) {
+			mtime := info.ModTime().Add(time.Second)
+			if err := os.Chtimes(path, mtime, mtime); err != nil {
+				t.Fatal(err)
+			}
+		},
+		"inode": func(path string, info os.FileInfo) {
+			// Same size and mtime, another file
+			tmp := path + ".new"
+			if err := os.WriteFile(tmp, []byte("DATA"), 0644); err != nil {
+				t.Fatal(err)
+			}
+			os.Chtimes(tmp, info.ModTime(), info.ModTime())
+			if err := os.Rename(tmp, path); err != nil {
+				t.Fatal(err)
+			}
+		},
+	}
+	for name, change := range cases {
+		dir := t.TempDir()
+		path := filepath.Join(dir, "taxi-01.csv")
+		c := loadCache(filepath.Join(dir, "SUMS.cache"))
+		info := cachedFile(t, c, path, []byte("data"), se)
+
+		if name == "inode" && inode(info) == 0 {
+			continue // no inodes here
+		}
+		change(path, info)
+		if _, ok := c.lookup(path, stat(path), se); ok {
+			t.Errorf("%s changed: cache used", name)
+		}
+	}
+}
+
+// Files modified right before we hash them aren't cached
+func TestCacheRecentFile(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "taxi-01.csv")
+	if err := os.WriteFile(path, []byte("data"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	se := sigEntry{name: "taxi-01.csv", alg: digest.SHA256}
+	c := loadCache(filepath.Join(dir, "SUMS.cache"))
+	c.add(path, info, se, &result{signature: sha256Hex([]byte("data"))}, info.ModTime())
+	if _, ok := c.lookup(path, info, se); ok {
+		t.Errorf("cache used")
+	}
+}
+
+func TestCacheSave(t *testing.T) {
+	dir := t.TempDir()
+	cachePath := filepath.Join(dir, "SUMS.cache")
+	se := sigEntry{name: "a.csv", alg: digest.SHA256}
+	c := loadCache(cachePath)
+	a := cachedFile(t, c, filepath.Join(dir, "a.csv"), []byte("a"), se)
+	cachedFile(t, c, filepath.Join(dir, "b.csv"), []byte("b"), se)
+	if err := c.save(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Only a is used in the second run, b is dropped on save
+	c = loadCache(cachePath)
+	if _, ok := c.lookup(filepath.Join(dir, "a.csv"), a, se); !ok {
+		t.Fatalf("a.csv not in the saved cache")
+	}
+	if err := c.save(); err != nil {
+		t.Fatal(err)
+	}
+	if c = loadCache(cachePath); len(c.files) != 1 {
+		t.Errorf("got %d entries, want 1", len(c.files))
+	}
+
+	// A bad cache is an empty one
+	if err := os.WriteFile(cachePath, []byte("{"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if c = loadCache(cachePath); len(c.files) != 0 {
+		t.Errorf("bad cache: got %d entries", len(c.files))
+	}
+}
+
+// The second check with -cache doesn't read the files
+func TestCheckCache(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string][]byte{
+		"a.txt": []byte("hello\n"),
+		"SUMS":  []byte(sha256Hex([]byte("hello\n")) + "  a.txt\n"),
+	})
+	mtime := time.Now().Add(-time.Hour)
+	if err := os.Chtimes(filepath.Join(dir, "a.txt"), mtime, mtime); err != nil {
+		t.Fatal(err)
+	}
+	indexPath := filepath.Join(dir, "SUMS")
+
+	for i, want := range []string{`"cached": false`, `"cached": true`} {
+		code, out, errOut := runCommand(t, "check", "-index", indexPath, "-cache", "-format", "json")
+		if code != 0 || !strings.Contains(out, want) {
+			t.Errorf("run %d: exit code %d, want %s\n%s%s", i+1, code, want, out, errOut)
+		}
+	}
+}
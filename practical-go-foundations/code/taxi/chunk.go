@@ -0,0 +1,447 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+
+	"day1/decompress"
+	"day1/digest"
+	"day1/internal/cli"
+	"day1/merkle"
+)
+
+// In chunked mode a file is split into fixed size blocks that are hashed in
+// parallel, so a single huge file isn't hashed by one goroutine. The index has
+// the tree hash of the block digests (merkle.Root) and <index>.blocks has the
+// block digests, check uses them to tell which byte ranges are corrupted.
+//
+//	go run ./taxi generate -dir /data -chunk 4MiB -o sha256sum.txt
+//	go run ./taxi check -index sha256sum.txt
+//	taxi-01.csv: FAILED
+//	taxi: taxi-01.csv: block 3 (bytes 12582912-16777215) differs
+//
+// A tree hash isn't the sha256sum of the file, so it has its own line format
+// with the block size in the tag:
+//
+//	SHA256-TREE-4194304 (taxi-01.csv) = 5f0e...
+//
+// sha256sum -c skips these lines as improperly formatted instead of
+// reporting the files FAILED, and check knows how to hash the file from the
+// line alone.
+//
+// Uncompressed files are read in parallel with ReadAt, compressed files are
+// decompressed sequentially and only the hashing is parallel. Block offsets
+// are in the decompressed content. Blocks of all the files are hashed by one
+// pool of GOMAXPROCS goroutines, so -j doesn't multiply the memory used.
+//
+// <index>.blocks isn't signed. Block lists that don't hash to the tree hash in
+// the index are ignored, so they can't be used to hide anything.
+
+var chunkSize string // -chunk
+
+// SHA256-TREE-4194304 (taxi-01.csv) = 5f0e...
+var treeTagRe = regexp.MustCompile(`^([A-Za-z0-9/_-]+)-TREE-([0-9]+) \((.*)\) = ([0-9a-fA-F]+)$`)
+
+// parseTreeLine parses a tree hash line, ok is false if line isn't one
+func parseTreeLine(line string) (e sigEntry, rest string, ok bool, err error) {
+	m := treeTagRe.FindStringSubmatch(line)
+	if m == nil {
+		return sigEntry{}, "", false, nil
+	}
+
+	alg, err := digest.ByName(m[1])
+	if err != nil {
+		return sigEntry{}, "", true, errAlgorithm
+	}
+	chunk, err := strconv.ParseInt(m[2], 10, 64)
+	if err != nil || chunk <= 0 {
+		return sigEntry{}, "", true, errBlockSize
+	}
+	sig := strings.ToLower(m[4])
+	if len(sig) != alg.HexLen() {
+		return sigEntry{}, "", true, errDigestLength
+	}
+	return sigEntry{signature: sig, alg: alg, binary: true, chunk: chunk}, m[3], true, nil
+}
+
+// treeLine formats a tree hash line, name is escaped
+func treeLine(name, sig string, alg digest.Algorithm, chunk int64) string {
+	return fmt.Sprintf("%s-TREE-%d (%s) = %s\n", alg.Tag, chunk, name, sig)
+}
+
+const blocksVersion = 1
+
+// blockIndex is the content of <index>.blocks
+type blockIndex struct {
+	Version   int                  `json:"version"`
+	Algorithm string               `json:"algorithm"`
+	ChunkSize int64                `json:"chunk_size"`
+	Files     map[string]blockList `json:"files"` // key is the name in the index
+}
+
+type blockList struct {
+	Size   int64    `json:"size"` // decompressed
+	Blocks []string `json:"blocks"`
+}
+
+func blocksFileName(index string) string {
+	return index + ".blocks"
+}
+
+// parseSize parses sizes like 4096, 64k, 4MiB or 1G (units are powers of 2)
+func parseSize(s string) (int64, error) {
+	units := []struct {
+		suffix string
+		n      int64
+	}{
+		{"KiB", 1 << 10}, {"MiB", 1 << 20}, {"GiB", 1 << 30},
+		{"KB", 1 << 10}, {"MB", 1 << 20}, {"GB", 1 << 30},
+		{"k", 1 << 10}, {"K", 1 << 10}, {"M", 1 << 20}, {"G", 1 << 30},
+		{"B", 1},
+	}
+
+	mul := int64(1)
+	num := s
+	for _, u := range units {
+		if strings.HasSuffix(s, u.suffix) {
+			num, mul = strings.TrimSuffix(s, u.suffix), u.n
+			break
+		}
+	}
+
+	n, err := strconv.ParseInt(num, 10, 64)
+	if err != nil || n <= 0 {
+		return 0, fmt.Errorf("bad size: %q", s)
+	}
+	if n > math.MaxInt64/mul {
+		return 0, fmt.Errorf("size too large: %q", s)
+	}
+	return n * mul, nil
+}
+
+// chunkFlag returns the -chunk size, 0 if not set
+func chunkFlag() (int64, error) {
+	if chunkSize == "" {
+		return 0, nil
+	}
+	return parseSize(chunkSize)
+}
+
+// chunkSig hashes the decompressed content of path (as it is on disk if raw)
+// in blocks of chunk bytes. It returns the tree hash of the blocks, the block
+// digests and the number of bytes hashed.
+func chunkSig(ctx context.Context, path string, alg digest.Algorithm, chunk int64, raw bool) (string, []string, int64, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", nil, 0, err
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return "", nil, 0, err
+	}
+
+	fm := meter.startFile(filepath.Base(path), info.Size())
+	defer fm.done()
+
+	var leaves [][]byte
+	var n int64
+	if raw || !isCompressed(file, info.Size()) {
+		n = info.Size()
+		leaves, err = hashBlocksAt(ctx, fm.readerAt(fm.file(file), true), n, alg, chunk)
+	} else {
+		var dr io.ReadCloser
+		dr, err = decompress.NewFileReader(fm.file(file), info.Size())
+		if err != nil {
+			return "", nil, 0, &os.PathError{Op: "decompress", Path: path, Err: err}
+		}
+		defer dr.Close()
+		cr := &ctxReader{ctx: ctx, r: fm.reader(dr, true)}
+		leaves, err = hashBlocks(ctx, cr, alg, chunk)
+		n = cr.n
+	}
+	if err != nil {
+		return "", nil, 0, err
+	}
+
+	blocks := make([]string, len(leaves))
+	for i, leaf := range leaves {
+		blocks[i] = hex.EncodeToString(leaf)
+	}
+	return hex.EncodeToString(merkle.Root(alg, leaves)), blocks, n, nil
+}
+
+// isCompressed returns true if file has a known compression header
+func isCompressed(file *os.File, size int64) bool {
+	header := make([]byte, decompress.HeaderSize)
+	if size < int64(len(header)) {
+		header = header[:size]
+	}
+	if _, err := file.ReadAt(header, 0); err != nil {
+		return false
+	}
+	_, ok := decompress.Detect(header)
+	return ok
+}
+
+// blockPool hashes the blocks of all the files
+var blockPool struct {
+	once  sync.Once
+	tasks chan func()
+}
+
+// hashInPool runs task in the block pool, it blocks until a worker is free
+func hashInPool(task func()) {
+	blockPool.once.Do(func() {
+		blockPool.tasks = make(chan func())
+		for i := 0; i < runtime.GOMAXPROCS(0); i++ {
+			go func() {
+				for task := range blockPool.tasks {
+					task()
+				}
+			}()
+		}
+	})
+	blockPool.tasks <- task
+}
+
+// hashBlocksAt hashes the size bytes of ra in blocks, each worker reads its
+// own blocks
+func hashBlocksAt(ctx context.Context, ra io.ReaderAt, size int64, alg digest.Algorithm, chunk int64) ([][]byte, error) {
+	leaves := make([][]byte, (size+chunk-1)/chunk)
+	var errs errOnce
+
+	var wg sync.WaitGroup
+	for i := range leaves {
+		if errs.get() != nil || ctx.Err() != nil {
+			break
+		}
+
+		wg.Add(1)
+		i := i
+		hashInPool(func() {
+			defer wg.Done()
+			off := int64(i) * chunk
+			n := chunk
+			if size-off < n {
+				n = size - off
+			}
+			r := &ctxReader{ctx: ctx, r: io.NewSectionReader(ra, off, n)}
+			leaf, err := sumBlock(alg, r)
+			if err != nil {
+				errs.set(err)
+				return
+			}
+			leaves[i] = leaf
+		})
+	}
+	wg.Wait()
+
+	if err := errs.get(); err != nil {
+		return nil, err
+	}
+	return leaves, ctx.Err()
+}
+
+// hashBlocks reads r sequentially and hashes the blocks in parallel. A block
+// is read only when a pool worker is free to hash it, so a file holds at most
+// one block that isn't being hashed.
+func hashBlocks(ctx context.Context, r io.Reader, alg digest.Algorithm, chunk int64) ([][]byte, error) {
+	var errs errOnce
+	var mu sync.Mutex
+	var leaves [][]byte
+
+	var wg sync.WaitGroup
+	var readErr error
+	for i := 0; errs.get() == nil; i++ {
+		data := make([]byte, chunk)
+		n, err := io.ReadFull(r, data)
+		if n > 0 {
+			mu.Lock()
+			leaves = append(leaves, nil)
+			mu.Unlock()
+
+			wg.Add(1)
+			i, data := i, data[:n]
+			hashInPool(func() {
+				defer wg.Done()
+				leaf, err := sumBlock(alg, bytes.NewReader(data))
+				if err != nil {
+					errs.set(err)
+					return
+				}
+				mu.Lock()
+				leaves[i] = leaf
+				mu.Unlock()
+			})
+		}
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			break
+		}
+		if err != nil {
+			readErr = err
+			break
+		}
+	}
+	wg.Wait()
+
+	if readErr != nil {
+		return nil, readErr
+	}
+	return leaves, errs.get()
+}
+
+func sumBlock(alg digest.Algorithm, r io.Reader) ([]byte, error) {
+	sig, err := digest.Sum(alg, r)
+	if err != nil {
+		return nil, err
+	}
+	return hex.DecodeString(sig)
+}
+
+// errOnce keeps the first error
+type errOnce struct {
+	mu  sync.Mutex
+	err error
+}
+
+func (e *errOnce) set(err error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.err == nil {
+		e.err = err
+	}
+}
+
+func (e *errOnce) get() error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.err
+}
+
+// byteRange is a range of corrupted blocks
+type byteRange struct {
+	FirstBlock int   `json:"first_block"`
+	LastBlock  int   `json:"last_block"`
+	Start      int64 `json:"start"`
+	End        int64 `json:"end"` // exclusive
+}
+
+func (b byteRange) String() string {
+	if b.FirstBlock == b.LastBlock {
+		return fmt.Sprintf("block %d (bytes %d-%d) differs", b.FirstBlock, b.Start, b.End-1)
+	}
+	return fmt.Sprintf("blocks %d-%d (bytes %d-%d) differ", b.FirstBlock, b.LastBlock, b.Start, b.End-1)
+}
+
+// badRanges compares the expected and actual block digests, size is the
+// larger of the expected and actual sizes
+func badRanges(expected, actual []string, chunk, size int64) []byteRange {
+	n := len(expected)
+	if len(actual) > n {
+		n = len(actual)
+	}
+
+	var ranges []byteRange
+	for i := 0; i < n; i++ {
+		if i < len(expected) && i < len(actual) && expected[i] == actual[i] {
+			continue
+		}
+
+		start, end := int64(i)*chunk, int64(i+1)*chunk
+		if end > size {
+			end = size
+		}
+		if last := len(ranges) - 1; last >= 0 && ranges[last].LastBlock == i-1 {
+			ranges[last].LastBlock, ranges[last].End = i, end
+			continue
+		}
+		ranges = append(ranges, byteRange{i, i, start, end})
+	}
+	return ranges
+}
+
+// loadBlocks sets the expected block digests of the tree hash lines in sigs
+// from <index>.blocks, if there's one
+func loadBlocks(index string, sigs []sigEntry) error {
+	data, err := os.ReadFile(blocksFileName(index))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	var bi blockIndex
+	if err := json.Unmarshal(data, &bi); err != nil {
+		return fmt.Errorf("%s: %w", blocksFileName(index), err)
+	}
+	if bi.Version != blocksVersion {
+		return fmt.Errorf("%s: unknown version %d", blocksFileName(index), bi.Version)
+	}
+	if bi.ChunkSize <= 0 {
+		return fmt.Errorf("%s: bad chunk size %d", blocksFileName(index), bi.ChunkSize)
+	}
+
+	for i := range sigs {
+		e := &sigs[i]
+		if e.chunk != bi.ChunkSize {
+			continue
+		}
+		bl, ok := bi.Files[e.name]
+		if !ok || e.alg.Name != bi.Algorithm || blocksRoot(e.alg, bl.Blocks) != e.signature {
+			continue
+		}
+		e.blocks, e.size = bl.Blocks, bl.Size
+	}
+	return nil
+}
+
+// blocksRoot returns the tree hash of hex block digests, "" if one is bad
+func blocksRoot(alg digest.Algorithm, blocks []string) string {
+	leaves := make([][]byte, len(blocks))
+	for i, b := range blocks {
+		leaf, err := hex.DecodeString(b)
+		if err != nil || len(leaf) != alg.Size {
+			return ""
+		}
+		leaves[i] = leaf
+	}
+	return hex.EncodeToString(merkle.Root(alg, leaves))
+}
+
+// writeBlocks writes <index>.blocks for the generated index
+func writeBlocks(index string, alg digest.Algorithm, chunk int64, files []genFile, results []result) error {
+	bi := blockIndex{
+		Version:   blocksVersion,
+		Algorithm: alg.Name,
+		ChunkSize: chunk,
+		Files:     make(map[string]blockList),
+	}
+	for i, f := range files {
+		if results[i].err != nil {
+			continue
+		}
+		bi.Files[f.name] = blockList{results[i].bytesRead, results[i].blocks}
+	}
+
+	return cli.WriteFile(blocksFileName(index), func(w io.Writer) error {
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(bi)
+	})
+}
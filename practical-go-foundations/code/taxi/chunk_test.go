@@ -0,0 +1,146 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"math"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"day1/digest"
+)
+
+func TestTreeLine(t *testing.T) {
+	line := strings.TrimSuffix(treeLine("taxi-01.csv", emptySHA256, digest.SHA256, 4<<20), "\n")
+	if want := "SHA256-TREE-4194304 (taxi-01.csv) = " + emptySHA256; line != want {
+		t.Fatalf("got %q, want %q", line, want)
+	}
+
+	e, err := parseSigLine(line, digest.Algorithm{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e.name != "taxi-01.csv" || e.alg.Name != "sha256" || e.chunk != 4<<20 || e.signature != emptySHA256 {
+		t.Errorf("got %+v", e)
+	}
+
+	// A plain tagged line isn't a tree hash
+	e, err = parseSigLine("SHA256 (taxi-01.csv) = "+emptySHA256, digest.Algorithm{})
+	if err != nil || e.chunk != 0 {
+		t.Errorf("tagged line: chunk %d, error %v", e.chunk, err)
+	}
+}
+
+func TestParseTreeLineErrors(t *testing.T) {
+	cases := []struct {
+		line string
+		err  error
+	}{
+		{"SHA256-TREE-0 (a) = " + emptySHA256, errBlockSize},
+		{"SHA256-TREE-99999999999999999999 (a) = " + emptySHA256, errBlockSize},
+		{"NOPE-TREE-1024 (a) = " + emptySHA256, errAlgorithm},
+		{"SHA256-TREE-1024 (a) = " + emptyMD5, errDigestLength},
+	}
+	for _, tc := range cases {
+		if _, err := parseSigLine(tc.line, digest.Algorithm{}); !errors.Is(err, tc.err) {
+			t.Errorf("%q: got error %v, want %v", tc.line, err, tc.err)
+		}
+	}
+}
+
+func TestParseSize(t *testing.T) {
+	cases := map[string]int64{
+		"4096": 4096,
+		"64k":  64 << 10,
+		"4M":   4 << 20,
+		"4MiB": 4 << 20,
+		"1GB":  1 << 30,
+		"10B":  10,
+
+		"9223372036854775807": math.MaxInt64,
+		"8589934591G":         8589934591 << 30,
+	}
+	for s, want := range cases {
+		if got, err := parseSize(s); err != nil || got != want {
+			t.Errorf("parseSize(%q) = %d, %v; want %d", s, got, err, want)
+		}
+	}
+	for _, s := range []string{"", "0", "-1M", "M", "4X", "8589934592G", "9223372036854775807k", "9223372036854775808"} {
+		if _, err := parseSize(s); err == nil {
+			t.Errorf("parseSize(%q): no error", s)
+		}
+	}
+}
+
+// chunkSig of a file and of its gzip must be the same, the first uses ReadAt
+// and the second streams
+func TestChunkSigCompressed(t *testing.T) {
+	dir := t.TempDir()
+	data := make([]byte, 10*1024+100)
+	rand.New(rand.NewSource(1)).Read(data)
+
+	plain := filepath.Join(dir, "data.bin")
+	if err := os.WriteFile(plain, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	w := gzip.NewWriter(&buf)
+	w.Write(data)
+	w.Close()
+	compressed := filepath.Join(dir, "data.bin.gz")
+	if err := os.WriteFile(compressed, buf.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	const chunk = 4096
+	ctx := context.Background()
+	sig, blocks, n, err := chunkSig(ctx, plain, digest.SHA256, chunk, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != int64(len(data)) || len(blocks) != 3 {
+		t.Fatalf("got %d bytes in %d blocks, want %d in 3", n, len(blocks), len(data))
+	}
+	if root := blocksRoot(digest.SHA256, blocks); root != sig {
+		t.Errorf("tree hash %s, root of blocks %s", sig, root)
+	}
+
+	zsig, zblocks, zn, err := chunkSig(ctx, compressed, digest.SHA256, chunk, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if zsig != sig || zn != n || !reflect.DeepEqual(zblocks, blocks) {
+		t.Errorf("gzip: got %s (%d bytes), want %s (%d bytes)", zsig, zn, sig, n)
+	}
+
+	// raw hashes the gzip bytes
+	rsig, _, rn, err := chunkSig(ctx, compressed, digest.SHA256, chunk, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rsig == sig || rn != int64(buf.Len()) {
+		t.Errorf("raw: got %s (%d bytes), want the tree hash of the %d gzip bytes", rsig, rn, buf.Len())
+	}
+}
+
+func TestBadRanges(t *testing.T) {
+	expected := []string{"a", "b", "c", "d", "e"}
+	actual := []string{"a", "x", "x", "d", "x", "x"}
+	got := badRanges(expected, actual, 10, 55)
+	want := []byteRange{
+		{FirstBlock: 1, LastBlock: 2, Start: 10, End: 30},
+		{FirstBlock: 4, LastBlock: 5, Start: 40, End: 55},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	if s := got[0].String(); s != "blocks 1-2 (bytes 10-29) differ" {
+		t.Errorf("got %q", s)
+	}
+}
@@ -0,0 +1,277 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"day1/digest"
+	"day1/internal/cli"
+)
+
+var (
+	recursive bool   // -r
+	output    string // -o, - is stdout
+	bsdTag    bool   // -tag
+	includes  cli.GlobList
+	excludes  cli.GlobList
+)
+
+// genFile is a file to hash
+type genFile struct {
+	path string // on disk
+	name string // in the index
+	raw  bool   // hash as it is on disk, see listFiles
+}
+
+// listFiles returns files under root, sorted by index name. The output file
+// out ("" if none), its sidecars and our temporary files next to it are
+// skipped. Sub directories are walked if recursive is true.
+// Unless -raw is set, compression extensions are removed from index names
+// (taxi-01.csv.bz2 -> taxi-01.csv) and we hash the decompressed content,
+// check finds the compressed file for the name and decompresses it too. Other
+// files are hashed as they are on disk, like sha256sum does.
+func listFiles(root string, out string, recursive bool) ([]genFile, error) {
+	var skip []string
+	if out != "" {
+		skip = []string{out, cacheFileName(out), sigFileName(out), blocksFileName(out)}
+	}
+
+	var files []genFile
+	byName := make(map[string]string) // name -> path
+	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if d.IsDir() {
+			if path != root && !recursive {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !d.Type().IsRegular() || isOutput(path, skip) {
+			return nil
+		}
+
+		rel, err := filepath.Rel(root, path)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		if len(includes) > 0 && !includes.Match(rel) {
+			return nil
+		}
+		if excludes.Match(rel) {
+			return nil
+		}
+
+		name := rel
+		if !raw {
+			name = cli.TrimCompressExt(name)
+		}
+		if other, ok := byName[name]; ok {
+			return fmt.Errorf("%s and %s have the same index name %q", other, path, name)
+		}
+		byName[name] = path
+		files = append(files, genFile{path: path, name: name, raw: name == rel})
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Slice(files, func(i, j int) bool {
+		return files[i].name < files[j].name
+	})
+	return files, nil
+}
+
+// isOutput returns true if path is one of the output files in skip, or a
+// temporary file (cli.WriteFile, sigCache.save) in their directory
+func isOutput(path string, skip []string) bool {
+	if len(skip) == 0 {
+		return false
+	}
+	for _, out := range skip {
+		if sameFile(path, out) {
+			return true
+		}
+	}
+
+	base := filepath.Base(path)
+	if strings.HasPrefix(base, ".tmp-") || strings.HasPrefix(base, ".cache-") {
+		return sameFile(filepath.Dir(path), filepath.Dir(skip[0]))
+	}
+	return false
+}
+
+// sameFile returns true if path and other are the same file on disk
+func sameFile(path, other string) bool {
+	if other == "" {
+		return false
+	}
+	fi1, err := os.Stat(path)
+	if err != nil {
+		return false
+	}
+	fi2, err := os.Stat(other)
+	if err != nil {
+		return false
+	}
+	return os.SameFile(fi1, fi2)
+}
+
+// sigLine formats an index line that parseSigLine can read, chunk is the
+// block size of tree hashes (0 for a plain digest)
+func sigLine(name, sig string, alg digest.Algorithm, tag bool, chunk int64) string {
+	name, escaped := escapeName(name)
+	prefix := ""
+	if escaped {
+		prefix = `\`
+	}
+	if chunk > 0 {
+		return prefix + treeLine(name, sig, alg, chunk)
+	}
+	if tag {
+		return fmt.Sprintf("%s%s (%s) = %s\n", prefix, alg.Tag, name, sig)
+	}
+	return fmt.Sprintf("%s%s  %s\n", prefix, sig, name)
+}
+
+// hashFiles hashes files with the worker pool (in blocks of chunk bytes if
+// chunk > 0) and returns the results in files order. Files that can't be read
+// are printed to stderr, have an error and ok is false. cache can be nil.
+func hashFiles(ctx context.Context, files []genFile, alg digest.Algorithm, chunk int64, cache *sigCache) ([]result, bool) {
+	paths := make([]string, len(files))
+	for i, f := range files {
+		paths[i] = f.path
+	}
+	stopProgress := startProgress(paths)
+
+	jobs := make(chan job)
+	ch := make(chan result, workers)
+	for i := 0; i < workers; i++ {
+		go sigWorker(ctx, jobs, ch, cache)
+	}
+	go func() {
+		defer close(jobs)
+		for i, f := range files {
+			jobs <- job{id: i, fileName: f.path, entry: sigEntry{name: f.name, alg: alg, chunk: chunk, raw: f.raw}}
+		}
+	}()
+
+	results := make([]result, len(files))
+	ok := true
+	for range files {
+		r := <-ch
+		results[r.id] = r
+		if r.err != nil {
+			if !isCanceled(r.err) {
+				fmt.Fprintf(stderr, "%s: %s: %s\n", prog, r.fileName, errCause(r.err))
+			}
+			ok = false
+		}
+	}
+	stopProgress()
+
+	if cache != nil {
+		if err := cache.save(); err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %s\n", prog, err)
+		}
+	}
+
+	return results, ok
+}
+
+// generate writes a signature index for the files in dir, returns the exit code
+func generate(ctx context.Context) int {
+	alg := digest.SHA256
+	if algo != "auto" {
+		var err error
+		if alg, err = digest.ByName(algo); err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %s\n", prog, err)
+			return 1
+		}
+	}
+
+	root := dataDir
+	if root == "" {
+		root = "."
+	}
+
+	skip := ""
+	if output != "-" {
+		skip = output
+	}
+	files, err := listFiles(root, skip, recursive)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %s\n", prog, err)
+		return 1
+	}
+
+	chunk, err := chunkFlag()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %s\n", prog, err)
+		return 1
+	}
+	if chunk > 0 && output == "-" {
+		fmt.Fprintf(os.Stderr, "%s: -chunk needs -o\n", prog)
+		return 1
+	}
+
+	var cache *sigCache
+	if useCache {
+		if output == "-" {
+			fmt.Fprintf(os.Stderr, "%s: -cache needs -o\n", prog)
+			return 1
+		}
+		cache = loadCache(cacheFileName(output))
+	}
+
+	results, ok := hashFiles(ctx, files, alg, chunk, cache)
+	code := 0
+	if !ok {
+		code = 1
+	}
+
+	if ctx.Err() != nil {
+		fmt.Fprintf(os.Stderr, "%s: interrupted, index not written\n", prog)
+		return 130
+	}
+
+	written := 0
+	err = cli.WriteFile(output, func(out io.Writer) error {
+		w := bufio.NewWriter(out)
+		for i, f := range files {
+			if results[i].err != nil {
+				continue
+			}
+			w.WriteString(sigLine(f.name, results[i].signature, alg, bsdTag, chunk))
+			written++
+		}
+		return w.Flush()
+	})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %s\n", prog, err)
+		return 1
+	}
+
+	if chunk > 0 {
+		if err := writeBlocks(output, alg, chunk, files, results); err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %s\n", prog, err)
+			return 1
+		}
+	}
+
+	if verbose {
+		fmt.Fprintf(os.Stderr, "generated %d of %d signatures\n", written, len(files))
+	}
+	return code
+}
@@ -0,0 +1,10 @@
+//go:build !unix
+
+package main
+
+import "os"
+
+// inode is not available, we rely on size and mtime
+func inode(info os.FileInfo) uint64 {
+	return 0
+}
@@ -0,0 +1,335 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"day1/digest"
+	"day1/internal/cli"
+	"day1/merkle"
+)
+
+// A manifest lists every file in a directory tree with its digest, and the
+// Merkle root hash over all of them (see the merkle package).
+//
+//	go run ./taxi manifest -dir taxi/taxi-sha256 -include '*.bz2' -o manifest.json
+//	go run ./taxi verify-manifest -manifest manifest.json -include '*.bz2'
+//	go run ./taxi prove -manifest manifest.json -file taxi-01.csv -o proof.json
+//	go run ./taxi verify-proof -proof proof.json -root <hex> -file taxi/taxi-sha256/taxi-01.csv.bz2
+
+var (
+	manifestFile string // -manifest
+	proofFile    string // -proof
+	proveFile    string // -file, a path in the manifest for prove, a file on disk for verify-proof
+	rootHash     string // -root
+)
+
+const manifestVersion = 1
+
+type manifest struct {
+	Version   int             `json:"version"`
+	Algorithm string          `json:"algorithm"`
+	Root      string          `json:"root"`
+	Files     []manifestEntry `json:"files"`
+
+	tree *merkle.Tree
+}
+
+type manifestEntry struct {
+	Path   string `json:"path"`
+	Digest string `json:"digest"`
+	Size   int64  `json:"size"` // decompressed
+}
+
+// newManifest builds the manifest, results are from hashFiles
+func newManifest(alg digest.Algorithm, files []genFile, results []result) (*manifest, error) {
+	m := &manifest{Version: manifestVersion, Algorithm: alg.Name}
+	digests := make(map[string][]byte)
+	for i, f := range files {
+		r := results[i]
+		d, err := hex.DecodeString(r.signature)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", f.name, err)
+		}
+		digests[f.name] = d
+		m.Files = append(m.Files, manifestEntry{f.name, r.signature, r.bytesRead})
+	}
+
+	tree, err := merkle.Build(alg, digests)
+	if err != nil {
+		return nil, err
+	}
+	m.tree = tree
+	m.Root = hex.EncodeToString(tree.Root())
+	return m, nil
+}
+
+// loadManifest loads a manifest and checks its root hash matches its files
+func loadManifest(path string) (*manifest, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var m manifest
+	if err := json.Unmarshal(data, &m); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	if m.Version != manifestVersion {
+		return nil, fmt.Errorf("%s: unknown manifest version %d", path, m.Version)
+	}
+	alg, err := digest.ByName(m.Algorithm)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	digests := make(map[string][]byte)
+	for _, e := range m.Files {
+		d, err := hex.DecodeString(e.Digest)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %s: %w", path, e.Path, err)
+		}
+		if _, ok := digests[e.Path]; ok {
+			return nil, fmt.Errorf("%s: duplicate path %q", path, e.Path)
+		}
+		digests[e.Path] = d
+	}
+
+	if m.tree, err = merkle.Build(alg, digests); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	if root := hex.EncodeToString(m.tree.Root()); root != m.Root {
+		return nil, fmt.Errorf("%s: root hash %s doesn't match files (%s)", path, m.Root, root)
+	}
+	return &m, nil
+}
+
+// hashTree hashes all the files under root and returns the manifest
+func hashTree(ctx context.Context, root, skip string, alg digest.Algorithm) (*manifest, error) {
+	files, err := listFiles(root, skip, true)
+	if err != nil {
+		return nil, err
+	}
+
+	results, ok := hashFiles(ctx, files, alg, 0, nil)
+	if ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
+	if !ok {
+		return nil, fmt.Errorf("some files could not be read")
+	}
+
+	return newManifest(alg, files, results)
+}
+
+// buildManifest writes a manifest for -dir
+func buildManifest(ctx context.Context) int {
+	alg := digest.SHA256
+	if algo != "auto" {
+		var err error
+		if alg, err = digest.ByName(algo); err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %s\n", prog, err)
+			return 1
+		}
+	}
+
+	root := dataDir
+	if root == "" {
+		root = "."
+	}
+
+	skip := ""
+	if output != "-" {
+		skip = output
+	}
+	m, err := hashTree(ctx, root, skip, alg)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %s\n", prog, err)
+		if ctx.Err() != nil {
+			return 130
+		}
+		return 1
+	}
+
+	err = cli.WriteFile(output, func(w io.Writer) error {
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(m)
+	})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %s\n", prog, err)
+		return 1
+	}
+
+	if verbose {
+		fmt.Fprintf(os.Stderr, "%d files, root %s\n", len(m.Files), m.Root)
+	}
+	return 0
+}
+
+// verifyManifest hashes -dir and reports which subtrees diverged from the
+// manifest
+func verifyManifest(ctx context.Context) int {
+	expected, err := loadManifest(manifestFile)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %s\n", prog, err)
+		return 1
+	}
+
+	root := dataDir
+	if root == "" {
+		root = filepath.Dir(manifestFile)
+	}
+
+	actual, err := hashTree(ctx, root, manifestFile, expected.tree.Alg)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %s\n", prog, err)
+		if ctx.Err() != nil {
+			return 130
+		}
+		return 1
+	}
+
+	changes := merkle.Diff(expected.tree, actual.tree)
+	if len(changes) == 0 {
+		if !status && !quiet {
+			fmt.Printf("root %s: OK\n", expected.Root)
+		}
+		return 0
+	}
+
+	if !status {
+		fmt.Printf("root %s: FAILED (got %s)\n", expected.Root, actual.Root)
+		for _, c := range changes {
+			name := c.Path
+			if c.Dir {
+				name += "/"
+			}
+			switch {
+			case c.Dir && c.Kind == merkle.Modified:
+				if c.Path != "" { // root is reported above
+					fmt.Printf("%s: DIVERGED\n", name)
+				}
+			case c.Kind == merkle.Modified:
+				fmt.Printf("%s: FAILED\n", name)
+			case c.Kind == merkle.Removed:
+				fmt.Printf("%s: MISSING\n", name)
+			case c.Kind == merkle.Added:
+				fmt.Printf("%s: EXTRA\n", name)
+			}
+		}
+	}
+	return 1
+}
+
+// prove writes an inclusion proof for -file
+func prove(context.Context) int {
+	if proveFile == "" {
+		fmt.Fprintf(os.Stderr, "%s: missing -file\n", prog)
+		return 1
+	}
+
+	m, err := loadManifest(manifestFile)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %s\n", prog, err)
+		return 1
+	}
+
+	proof, err := m.tree.Prove(proveFile)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %s\n", prog, err)
+		return 1
+	}
+
+	err = cli.WriteFile(output, func(w io.Writer) error {
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(proof)
+	})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %s\n", prog, err)
+		return 1
+	}
+	return 0
+}
+
+// verifyProof checks an inclusion proof against a trusted root. If -file is
+// set, the digest is computed from the file on disk, otherwise the digest in
+// the proof is used.
+func verifyProof(ctx context.Context) int {
+	if proofFile == "" {
+		fmt.Fprintf(os.Stderr, "%s: missing -proof\n", prog)
+		return 1
+	}
+
+	data, err := os.ReadFile(proofFile)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %s\n", prog, err)
+		return 1
+	}
+	var proof merkle.Proof
+	if err := json.Unmarshal(data, &proof); err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %s: %s\n", prog, proofFile, err)
+		return 1
+	}
+
+	trusted := rootHash
+	if trusted == "" {
+		m, err := loadManifest(manifestFile)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %s\n", prog, err)
+			return 1
+		}
+		trusted = m.Root
+	}
+	want, err := hex.DecodeString(trusted)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s: bad root hash: %s\n", prog, err)
+		return 1
+	}
+
+	sig := proof.Digest
+	if proveFile != "" {
+		alg, err := digest.ByName(proof.Algorithm)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %s\n", prog, err)
+			return 1
+		}
+		// Like manifest, decompress files with a compression extension
+		isRaw := raw || cli.TrimCompressExt(proveFile) == proveFile
+		if sig, _, err = fileSig(ctx, proveFile, alg, isRaw); err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %s\n", prog, err)
+			return 1
+		}
+	}
+	d, err := hex.DecodeString(sig)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s: bad digest: %s\n", prog, err)
+		return 1
+	}
+
+	got, err := proof.ComputeRoot(d)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %s: %s\n", prog, proofFile, err)
+		return 1
+	}
+
+	// ComputeRoot checked proof.Path, but print what was proven
+	name := proof.FilePath()
+	if !bytes.Equal(got, want) {
+		if !status {
+			fmt.Printf("%s: FAILED\n", name)
+		}
+		return 1
+	}
+	if !status && !quiet {
+		fmt.Printf("%s: OK\n", name)
+	}
+	return 0
+}
@@ -0,0 +1,311 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"day1/internal/cli"
+)
+
+var (
+	showProgress     bool          // -progress
+	progressInterval time.Duration // -progress-interval
+)
+
+// meter tracks hashing progress, nil when -progress is off. All methods are
+// nil safe.
+var meter *progressMeter
+
+// stdout and stderr go through the meter, so results don't get mixed with
+// the live progress line
+var (
+	stdout io.Writer = meterWriter{os.Stdout}
+	stderr io.Writer = meterWriter{os.Stderr}
+)
+
+// meterWriter writes to f, clearing the live progress line first
+type meterWriter struct {
+	f *os.File
+}
+
+func (w meterWriter) Write(p []byte) (int, error) {
+	return meter.write(w.f, p)
+}
+
+// progressMeter has aggregate and per file byte counts. Compressed bytes are
+// read from disk, decompressed bytes go into the hash.
+type progressMeter struct {
+	start      time.Time
+	totalFiles int
+	totalBytes int64 // compressed, from file sizes
+
+	compressed   int64 // atomic
+	decompressed int64 // atomic
+	doneFiles    int64 // atomic
+
+	log io.Writer // per file lines when not live, can be nil
+
+	mu     sync.Mutex
+	active map[*fileMeter]bool
+
+	outMu sync.Mutex // guards the terminal while live
+	live  bool       // the progress line is drawn in place
+}
+
+// fileMeter is the progress of a single file
+type fileMeter struct {
+	m            *progressMeter
+	name         string
+	size         int64
+	start        time.Time
+	compressed   int64 // atomic
+	decompressed int64 // atomic
+}
+
+func newProgressMeter(files int, bytes int64) *progressMeter {
+	return &progressMeter{
+		start:      time.Now(),
+		totalFiles: files,
+		totalBytes: bytes,
+		active:     make(map[*fileMeter]bool),
+	}
+}
+
+// startFile starts tracking a file, size is the size on disk
+func (m *progressMeter) startFile(name string, size int64) *fileMeter {
+	if m == nil {
+		return nil
+	}
+
+	fm := &fileMeter{m: m, name: name, size: size, start: time.Now()}
+	m.mu.Lock()
+	m.active[fm] = true
+	m.mu.Unlock()
+	return fm
+}
+
+// skipFile marks a file we didn't need to read (e.g. cached) as done
+func (m *progressMeter) skipFile(size int64) {
+	if m == nil {
+		return
+	}
+	atomic.AddInt64(&m.compressed, size)
+	atomic.AddInt64(&m.doneFiles, 1)
+}
+
+// done marks the file as done and logs it in non live mode
+func (fm *fileMeter) done() {
+	if fm == nil {
+		return
+	}
+
+	m := fm.m
+	m.mu.Lock()
+	delete(m.active, fm)
+	m.mu.Unlock()
+	atomic.AddInt64(&m.doneFiles, 1)
+
+	// Files that failed midway still count as done for the ETA
+	if rest := fm.size - atomic.LoadInt64(&fm.compressed); rest > 0 {
+		atomic.AddInt64(&m.compressed, rest)
+	}
+
+	if m.log != nil {
+		d := time.Since(fm.start)
+		fmt.Fprintf(m.log, "%s: %s (%s on disk) in %v, %s/s\n",
+			fm.name, cli.Size(atomic.LoadInt64(&fm.decompressed)), cli.Size(fm.size),
+			d.Round(time.Millisecond), cli.Size(rate(atomic.LoadInt64(&fm.decompressed), d)))
+	}
+}
+
+// write writes p to f, the progress line is cleared first and redrawn on the
+// next tick
+func (m *progressMeter) write(f *os.File, p []byte) (int, error) {
+	if m == nil {
+		return f.Write(p)
+	}
+
+	m.outMu.Lock()
+	defer m.outMu.Unlock()
+	if m.live {
+		fmt.Fprint(os.Stderr, "\r\033[K")
+	}
+	return f.Write(p)
+}
+
+// reader counts bytes read from r, decompressed is true for the stream going
+// into the hash
+func (fm *fileMeter) reader(r io.Reader, decompressed bool) io.Reader {
+	if fm == nil {
+		return r
+	}
+	return &countingReader{r: r, fm: fm, decompressed: decompressed}
+}
+
+// file counts bytes read from disk, zip uses ReadAt
+func (fm *fileMeter) file(f *os.File) *countingReader {
+	return &countingReader{r: f, ra: f, fm: fm}
+}
+
+// readerAt counts bytes read with ReadAt from ra
+func (fm *fileMeter) readerAt(ra io.ReaderAt, decompressed bool) io.ReaderAt {
+	if fm == nil {
+		return ra
+	}
+	return &countingReader{ra: ra, fm: fm, decompressed: decompressed}
+}
+
+type countingReader struct {
+	r            io.Reader
+	ra           io.ReaderAt
+	fm           *fileMeter // can be nil
+	decompressed bool
+}
+
+func (c *countingReader) add(n int) {
+	if c.fm == nil || n == 0 {
+		return
+	}
+	if c.decompressed {
+		atomic.AddInt64(&c.fm.decompressed, int64(n))
+		atomic.AddInt64(&c.fm.m.decompressed, int64(n))
+		return
+	}
+	atomic.AddInt64(&c.fm.compressed, int64(n))
+	atomic.AddInt64(&c.fm.m.compressed, int64(n))
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.add(n)
+	return n, err
+}
+
+func (c *countingReader) ReadAt(p []byte, off int64) (int, error) {
+	n, err := c.ra.ReadAt(p, off)
+	c.add(n)
+	return n, err
+}
+
+// line returns the aggregate progress and files in progress
+//
+//	[3/10] 52.9MB read, 5.8MB/19.3MB on disk, 12.3MB/s (1.4MB/s on disk) ETA 10s taxi-04.csv.bz2 45%
+func (m *progressMeter) line() string {
+	elapsed := time.Since(m.start)
+	compressed := atomic.LoadInt64(&m.compressed)
+	decompressed := atomic.LoadInt64(&m.decompressed)
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "[%d/%d] %s read, %s/%s on disk, %s/s (%s/s on disk)",
+		atomic.LoadInt64(&m.doneFiles), m.totalFiles,
+		cli.Size(decompressed), cli.Size(compressed), cli.Size(m.totalBytes),
+		cli.Size(rate(decompressed, elapsed)), cli.Size(rate(compressed, elapsed)))
+
+	if compressed > 0 && compressed < m.totalBytes {
+		left := time.Duration(float64(elapsed) * float64(m.totalBytes-compressed) / float64(compressed))
+		fmt.Fprintf(&b, " ETA %v", left.Round(time.Second))
+	}
+
+	m.mu.Lock()
+	var files []string
+	for fm := range m.active {
+		pct := 0.0
+		if fm.size > 0 {
+			pct = 100 * float64(atomic.LoadInt64(&fm.compressed)) / float64(fm.size)
+		}
+		files = append(files, fmt.Sprintf("%s %.0f%%", fm.name, pct))
+	}
+	m.mu.Unlock()
+	sort.Strings(files)
+	if len(files) > 0 {
+		fmt.Fprintf(&b, " %s", strings.Join(files, ", "))
+	}
+
+	return b.String()
+}
+
+// run renders progress until done is closed. On a terminal the line is
+// redrawn in place, otherwise a log line is printed every interval.
+func (m *progressMeter) run(w io.Writer, interval time.Duration, done <-chan struct{}) {
+	if m.live {
+		interval = 200 * time.Millisecond
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-done:
+			m.outMu.Lock()
+			if m.live {
+				fmt.Fprint(w, "\r\033[K") // clear line
+				m.live = false
+			}
+			m.outMu.Unlock()
+			return
+		case <-ticker.C:
+			line := m.line()
+			m.outMu.Lock()
+			if m.live {
+				fmt.Fprintf(w, "\r\033[K%s", line)
+			} else {
+				fmt.Fprintln(w, line)
+			}
+			m.outMu.Unlock()
+		}
+	}
+}
+
+// startProgress starts showing progress for hashing paths (if -progress is
+// set and not -status), call the returned function when done
+func startProgress(paths []string) func() {
+	if !showProgress || status {
+		return func() {}
+	}
+
+	var total int64
+	for _, path := range paths {
+		if info, err := os.Stat(path); err == nil {
+			total += info.Size()
+		}
+	}
+
+	meter = newProgressMeter(len(paths), total)
+	meter.live = isTerminal(os.Stderr)
+	if !meter.live {
+		meter.log = os.Stderr
+	}
+
+	done := make(chan struct{})
+	finished := make(chan struct{})
+	go func() {
+		defer close(finished)
+		meter.run(os.Stderr, progressInterval, done)
+	}()
+
+	return func() {
+		close(done)
+		<-finished
+	}
+}
+
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	if err != nil {
+		return false
+	}
+	return info.Mode()&os.ModeCharDevice != 0
+}
+
+func rate(n int64, d time.Duration) int64 {
+	if d <= 0 {
+		return 0
+	}
+	return int64(float64(n) / d.Seconds())
+}
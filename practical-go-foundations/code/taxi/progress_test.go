@@ -0,0 +1,86 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestProgressLine(t *testing.T) {
+	m := newProgressMeter(2, 2000)
+	fm := m.startFile("taxi-01.csv.bz2", 1000)
+	// 500 bytes on disk, the same going into the hash
+	disk := &countingReader{r: strings.NewReader(strings.Repeat("x", 500)), fm: fm}
+	if _, err := io.Copy(io.Discard, fm.reader(disk, true)); err != nil {
+		t.Fatal(err)
+	}
+
+	line := m.line()
+	for _, want := range []string{"[0/2]", "500B read", "500B/2.0kB on disk", "ETA", "taxi-01.csv.bz2 50%"} {
+		if !strings.Contains(line, want) {
+			t.Errorf("%q doesn't have %q", line, want)
+		}
+	}
+
+	fm.done()
+	m.skipFile(1000) // cached
+	line = m.line()
+	if !strings.HasPrefix(line, "[2/2]") || strings.Contains(line, "ETA") || strings.Contains(line, "taxi-01") {
+		t.Errorf("done: %q", line)
+	}
+}
+
+// When stderr isn't a terminal, progress is log lines, no escape codes
+func TestProgressLog(t *testing.T) {
+	m := newProgressMeter(1, 100)
+	var buf bytes.Buffer
+	done := make(chan struct{})
+	finished := make(chan struct{})
+	go func() {
+		defer close(finished)
+		m.run(&buf, time.Millisecond, done)
+	}()
+	time.Sleep(20 * time.Millisecond)
+	close(done)
+	<-finished
+
+	lines := strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n")
+	if len(lines) < 2 {
+		t.Fatalf("got %d lines: %q", len(lines), buf.String())
+	}
+	for _, line := range lines {
+		if !strings.HasPrefix(line, "[0/1] ") || strings.ContainsAny(line, "\r\033") {
+			t.Errorf("bad line %q", line)
+		}
+	}
+}
+
+// check -progress logs a line per file to stderr (a file here), the results
+// on stdout are the same
+func TestCheckProgress(t *testing.T) {
+	dir := t.TempDir()
+	data := []byte(strings.Repeat("trip\n", 200))
+	writeFiles(t, dir, map[string][]byte{
+		"taxi-01.csv":    data,
+		"taxi-02.csv.gz": gzipBytes(t, data),
+		"SUMS":           []byte(sha256Hex(data) + "  taxi-01.csv\n" + sha256Hex(data) + "  taxi-02.csv\n"),
+	})
+	defer func() { meter = nil }()
+
+	index := filepath.Join(dir, "SUMS")
+	code, out, errOut := runCommand(t, "check", "-index", index, "-progress", "-progress-interval", "1ms")
+	if code != 0 || out != "taxi-01.csv: OK\ntaxi-02.csv: OK\n" {
+		t.Errorf("exit code %d\n%s", code, out)
+	}
+	for _, want := range []string{"taxi-01.csv: 1.0kB (1.0kB on disk) in ", "taxi-02.csv.gz: 1.0kB ("} {
+		if !strings.Contains(errOut, want) {
+			t.Errorf("stderr doesn't have %q:\n%s", want, errOut)
+		}
+	}
+	if strings.ContainsAny(errOut, "\r\033") {
+		t.Errorf("escape codes in stderr: %q", errOut)
+	}
+}
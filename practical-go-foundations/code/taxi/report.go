@@ -0,0 +1,229 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"day1/internal/cli"
+)
+
+// File status in reports
+const (
+	statusOK         = "OK"
+	statusFailed     = "FAILED"
+	statusUnreadable = "UNREADABLE"
+	statusIgnored    = "IGNORED" // missing with -ignore-missing
+	statusSkipped    = "SKIPPED" // cancelled before it was checked
+)
+
+// status returns the report status of r
+func (r *result) status() string {
+	switch {
+	case isCanceled(r.err):
+		return statusSkipped
+	case r.err != nil && os.IsNotExist(r.err) && ignoreMissing:
+		return statusIgnored
+	case r.err != nil:
+		return statusUnreadable
+	case !r.match:
+		return statusFailed
+	}
+	return statusOK
+}
+
+// fileRecord is the JSON report for a single file
+type fileRecord struct {
+	Type           string      `json:"type"` // always "file"
+	Name           string      `json:"name"` // as in the index
+	Path           string      `json:"path"`
+	Status         string      `json:"status"`
+	Algorithm      string      `json:"algorithm"`
+	Expected       string      `json:"expected"`
+	Actual         string      `json:"actual,omitempty"`
+	BytesRead      int64       `json:"bytes_read"`
+	CompressedSize int64       `json:"compressed_size"`
+	DurationMS     float64     `json:"duration_ms"`
+	Cached         bool        `json:"cached"`
+	BadRanges      []byteRange `json:"bad_ranges,omitempty"` // chunked mode
+	Error          string      `json:"error,omitempty"`
+}
+
+func newFileRecord(e sigEntry, r *result) fileRecord {
+	rec := fileRecord{
+		Type:           "file",
+		Name:           e.name,
+		Path:           r.fileName,
+		Status:         r.status(),
+		Algorithm:      e.alg.Name,
+		Expected:       e.signature,
+		Actual:         r.signature,
+		BytesRead:      r.bytesRead,
+		CompressedSize: r.size,
+		DurationMS:     ms(r.duration),
+		Cached:         r.cached,
+		BadRanges:      r.badRanges,
+	}
+	if r.err != nil {
+		rec.Error = r.err.Error()
+	}
+	return rec
+}
+
+// summary is the totals of a run, also the last JSON record
+type summary struct {
+	Type        string  `json:"type"` // always "summary"
+	Files       int     `json:"files"`
+	OK          int     `json:"ok"`
+	Failed      int     `json:"failed"`
+	Unreadable  int     `json:"unreadable"`
+	Ignored     int     `json:"ignored"`
+	Skipped     int     `json:"skipped"`
+	BadLines    int     `json:"bad_lines"`
+	BytesRead   int64   `json:"bytes_read"`
+	DurationMS  float64 `json:"duration_ms"`
+	Interrupted bool    `json:"interrupted"`
+
+	duration time.Duration
+}
+
+func (s *summary) add(r *result) {
+	s.BytesRead += r.bytesRead
+	switch r.status() {
+	case statusOK:
+		s.OK++
+	case statusFailed:
+		s.Failed++
+	case statusUnreadable:
+		s.Unreadable++
+	case statusIgnored:
+		s.Ignored++
+	case statusSkipped:
+		s.Skipped++
+	}
+}
+
+func ms(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
+
+// reporter outputs check results, file is called in index order
+type reporter interface {
+	file(e sigEntry, r *result)
+	summary(s summary)
+}
+
+func newReporter(format string) (reporter, error) {
+	if status {
+		return nopReporter{}, nil
+	}
+
+	switch format {
+	case "text":
+		return textReporter{stdout, stderr}, nil
+	case "json":
+		return &jsonReporter{w: stdout}, nil
+	case "ndjson":
+		return ndjsonReporter{json.NewEncoder(stdout)}, nil
+	}
+	return nil, fmt.Errorf("unknown report format: %q", format)
+}
+
+// nopReporter is used with -status
+type nopReporter struct{}
+
+func (nopReporter) file(sigEntry, *result) {}
+func (nopReporter) summary(summary)        {}
+
+// textReporter prints like sha256sum -c
+type textReporter struct {
+	out io.Writer
+	err io.Writer
+}
+
+func (t textReporter) file(e sigEntry, r *result) {
+	name, escaped := escapeName(e.name)
+	if escaped {
+		name = `\` + name
+	}
+
+	switch r.status() {
+	case statusUnreadable:
+		fmt.Fprintf(t.err, "%s: %s: %s\n", prog, e.name, errCause(r.err))
+		fmt.Fprintf(t.out, "%s: FAILED open or read\n", name)
+	case statusFailed:
+		fmt.Fprintf(t.out, "%s: FAILED\n", name)
+		for _, b := range r.badRanges {
+			fmt.Fprintf(t.err, "%s: %s: %s\n", prog, e.name, b)
+		}
+	case statusOK:
+		if !quiet {
+			fmt.Fprintf(t.out, "%s: OK\n", name)
+		}
+	}
+}
+
+func (t textReporter) summary(s summary) {
+	if verbose {
+		fmt.Fprintf(t.err, "processed %d files in %v\n", s.Files-s.Skipped, s.duration)
+	}
+
+	switch {
+	case s.Interrupted:
+		fmt.Fprintf(t.err, "%s: interrupted, %d of %d files not checked\n", prog, s.Skipped, s.Files)
+	case s.Skipped > 0:
+		fmt.Fprintf(t.err, "%s: stopped on first failure, %d of %d files not checked\n", prog, s.Skipped, s.Files)
+	}
+
+	if s.BadLines > 0 {
+		fmt.Fprintf(t.err, "%s: WARNING: %s improperly formatted\n", prog, cli.Plural(s.BadLines, "line is", "lines are"))
+	}
+	if s.Unreadable > 0 {
+		fmt.Fprintf(t.err, "%s: WARNING: %s could not be read\n", prog, cli.Plural(s.Unreadable, "listed file", "listed files"))
+	}
+	if s.Failed > 0 {
+		fmt.Fprintf(t.err, "%s: WARNING: %s did NOT match\n", prog, cli.Plural(s.Failed, "computed checksum", "computed checksums"))
+	}
+}
+
+// ndjsonReporter emits one JSON object per line, files as they are done and
+// the summary last
+type ndjsonReporter struct {
+	enc *json.Encoder
+}
+
+func (n ndjsonReporter) file(e sigEntry, r *result) {
+	n.enc.Encode(newFileRecord(e, r))
+}
+
+func (n ndjsonReporter) summary(s summary) {
+	n.enc.Encode(s)
+}
+
+// jsonReporter emits a single JSON document at the end
+//
+//	{"files": [...], "summary": {...}}
+type jsonReporter struct {
+	w     io.Writer
+	files []fileRecord
+}
+
+func (j *jsonReporter) file(e sigEntry, r *result) {
+	j.files = append(j.files, newFileRecord(e, r))
+}
+
+func (j *jsonReporter) summary(s summary) {
+	doc := struct {
+		Files   []fileRecord `json:"files"`
+		Summary summary      `json:"summary"`
+	}{j.files, s}
+	if doc.Files == nil {
+		doc.Files = []fileRecord{}
+	}
+
+	enc := json.NewEncoder(j.w)
+	enc.SetIndent("", "  ")
+	enc.Encode(doc)
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// reportDir has an index with a good, a changed and a missing file, and a
+// bad line
+func reportDir(t *testing.T) string {
+	t.Helper()
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string][]byte{
+		"good.txt":    []byte("good"),
+		"changed.txt": []byte("changed"),
+		"SUMS": []byte(strings.Join([]string{
+			sha256Hex([]byte("good")) + "  good.txt",
+			sha256Hex([]byte("original")) + "  changed.txt",
+			"not a checksum line",
+			sha256Hex([]byte("missing")) + "  missing.txt",
+			"",
+		}, "\n")),
+	})
+	return filepath.Join(dir, "SUMS")
+}
+
+// keys returns the sorted keys of a JSON object
+func keys(obj map[string]interface{}) []string {
+	var ks []string
+	for k := range obj {
+		ks = append(ks, k)
+	}
+	sort.Strings(ks)
+	return ks
+}
+
+var (
+	fileKeys    = []string{"algorithm", "bytes_read", "cached", "compressed_size", "duration_ms", "expected", "name", "path", "status", "type"}
+	summaryKeys = []string{"bad_lines", "bytes_read", "duration_ms", "failed", "files", "ignored", "interrupted", "ok", "skipped", "type", "unreadable"}
+)
+
+// checkRecords checks the file records and the summary of reportDir
+func checkRecords(t *testing.T, files []map[string]interface{}, sum map[string]interface{}) {
+	t.Helper()
+	want := []struct {
+		name   string
+		status string
+		extra  []string // keys besides fileKeys
+	}{
+		{"good.txt", "OK", []string{"actual"}},
+		{"changed.txt", "FAILED", []string{"actual"}},
+		{"missing.txt", "UNREADABLE", []string{"error"}},
+	}
+	if len(files) != len(want) {
+		t.Fatalf("got %d file records, want %d", len(files), len(want))
+	}
+	for i, w := range want {
+		f := files[i]
+		if f["type"] != "file" || f["name"] != w.name || f["status"] != w.status || f["algorithm"] != "sha256" {
+			t.Errorf("file %d: got %v, want %s %s", i, f, w.name, w.status)
+		}
+		wantKeys := append(append([]string(nil), fileKeys...), w.extra...)
+		sort.Strings(wantKeys)
+		if got := keys(f); !reflect.DeepEqual(got, wantKeys) {
+			t.Errorf("%s: keys %v, want %v", w.name, got, wantKeys)
+		}
+	}
+	if files[0]["actual"] != files[0]["expected"] || files[1]["actual"] == files[1]["expected"] {
+		t.Errorf("digests: %v, %v", files[0], files[1])
+	}
+
+	if got := keys(sum); !reflect.DeepEqual(got, summaryKeys) {
+		t.Errorf("summary keys %v, want %v", got, summaryKeys)
+	}
+	// JSON numbers are float64
+	counts := map[string]float64{"files": 3, "ok": 1, "failed": 1, "unreadable": 1, "bad_lines": 1, "bytes_read": 11}
+	for k, n := range counts {
+		if sum[k] != n {
+			t.Errorf("summary %s: got %v, want %v", k, sum[k], n)
+		}
+	}
+	if sum["type"] != "summary" || sum["interrupted"] != false {
+		t.Errorf("summary: %v", sum)
+	}
+}
+
+func TestReportJSON(t *testing.T) {
+	code, out, errOut := runCommand(t, "check", "-index", reportDir(t), "-format", "json")
+	if code != 1 {
+		t.Errorf("exit code %d, want 1\n%s", code, errOut)
+	}
+
+	var doc map[string]interface{}
+	if err := json.Unmarshal([]byte(out), &doc); err != nil {
+		t.Fatalf("%s\n%s", err, out)
+	}
+	if got := keys(doc); !reflect.DeepEqual(got, []string{"files", "summary"}) {
+		t.Fatalf("keys %v", got)
+	}
+	var files []map[string]interface{}
+	for _, f := range doc["files"].([]interface{}) {
+		files = append(files, f.(map[string]interface{}))
+	}
+	checkRecords(t, files, doc["summary"].(map[string]interface{}))
+}
+
+// NDJSON is a record per line, the summary last
+func TestReportNDJSON(t *testing.T) {
+	code, out, _ := runCommand(t, "check", "-index", reportDir(t), "-format", "ndjson")
+	if code != 1 {
+		t.Errorf("exit code %d, want 1", code)
+	}
+
+	var records []map[string]interface{}
+	s := bufio.NewScanner(strings.NewReader(out))
+	for s.Scan() {
+		var rec map[string]interface{}
+		if err := json.Unmarshal(s.Bytes(), &rec); err != nil {
+			t.Fatalf("%s: %q", err, s.Text())
+		}
+		records = append(records, rec)
+	}
+	if len(records) != 4 {
+		t.Fatalf("got %d records, want 4\n%s", len(records), out)
+	}
+	checkRecords(t, records[:3], records[3])
+}
+
+// With -status there's no output at all
+func TestReportStatus(t *testing.T) {
+	for _, format := range []string{"text", "json", "ndjson"} {
+		code, out, errOut := runCommand(t, "check", "-index", reportDir(t), "-format", format, "-status")
+		if code != 1 || out != "" || errOut != "" {
+			t.Errorf("%s: exit code %d, output %q %q", format, code, out, errOut)
+		}
+	}
+}
@@ -0,0 +1,222 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"day1/digest"
+)
+
+// Keys are PEM encoded PKCS #8 (private) and PKIX (public), the same format
+// "openssl genpkey -algorithm ed25519" uses. The signature of an index is
+// base64 encoded in <index>.sig.
+
+var (
+	keyFile    string // -key
+	pubKeyFile string // -pubkey
+)
+
+var errBadSignature = errors.New("index signature doesn't match public key")
+
+func sigFileName(index string) string {
+	return index + ".sig"
+}
+
+// keygen creates a new key pair
+func keygen(context.Context) int {
+	if keyFile == "" {
+		fmt.Fprintf(os.Stderr, "%s: missing -key\n", prog)
+		return 1
+	}
+
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %s\n", prog, err)
+		return 1
+	}
+
+	privDER, err := x509.MarshalPKCS8PrivateKey(priv)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %s\n", prog, err)
+		return 1
+	}
+	pubDER, err := x509.MarshalPKIXPublicKey(pub)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %s\n", prog, err)
+		return 1
+	}
+
+	// Don't overwrite existing keys, O_EXCL
+	if err := writeNew(keyFile, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: privDER}), 0600); err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %s\n", prog, err)
+		return 1
+	}
+	if err := writeNew(keyFile+".pub", pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: pubDER}), 0644); err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %s\n", prog, err)
+		return 1
+	}
+
+	if verbose {
+		fmt.Fprintf(os.Stderr, "wrote %s and %s.pub\n", keyFile, keyFile)
+	}
+	return 0
+}
+
+func writeNew(path string, data []byte, perm os.FileMode) error {
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, perm)
+	if err != nil {
+		return err
+	}
+	if _, err := file.Write(data); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+func readPEM(path, typ string) ([]byte, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(data)
+	if block == nil || block.Type != typ {
+		return nil, fmt.Errorf("%s: no %s PEM block", path, typ)
+	}
+	return block.Bytes, nil
+}
+
+func loadPrivateKey(path string) (ed25519.PrivateKey, error) {
+	der, err := readPEM(path, "PRIVATE KEY")
+	if err != nil {
+		return nil, err
+	}
+	key, err := x509.ParsePKCS8PrivateKey(der)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	priv, ok := key.(ed25519.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("%s: not an Ed25519 key", path)
+	}
+	return priv, nil
+}
+
+func loadPublicKey(path string) (ed25519.PublicKey, error) {
+	der, err := readPEM(path, "PUBLIC KEY")
+	if err != nil {
+		return nil, err
+	}
+	key, err := x509.ParsePKIXPublicKey(der)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	pub, ok := key.(ed25519.PublicKey)
+	if !ok {
+		return nil, fmt.Errorf("%s: not an Ed25519 key", path)
+	}
+	return pub, nil
+}
+
+// sign writes <index>.sig
+func sign(context.Context) int {
+	if keyFile == "" {
+		fmt.Fprintf(os.Stderr, "%s: missing -key\n", prog)
+		return 1
+	}
+
+	priv, err := loadPrivateKey(keyFile)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %s\n", prog, err)
+		return 1
+	}
+
+	data, err := os.ReadFile(indexFile)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %s\n", prog, err)
+		return 1
+	}
+
+	// Don't sign garbage
+	if _, err := parseSigFile(bytes.NewReader(data), digest.Algorithm{}, false); err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %s: %s\n", prog, indexFile, err)
+		return 1
+	}
+
+	sig := ed25519.Sign(priv, data)
+	out := base64.StdEncoding.EncodeToString(sig) + "\n"
+	if err := os.WriteFile(sigFileName(indexFile), []byte(out), 0644); err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %s\n", prog, err)
+		return 1
+	}
+	return 0
+}
+
+// verifyIndex checks that data (the index content) matches the signature in
+// <index>.sig
+func verifyIndex(pub ed25519.PublicKey, index string, data []byte) error {
+	encoded, err := os.ReadFile(sigFileName(index))
+	if err != nil {
+		return err
+	}
+	sig, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(encoded)))
+	if err != nil || len(sig) != ed25519.SignatureSize {
+		return fmt.Errorf("%s: bad signature file", sigFileName(index))
+	}
+
+	if !ed25519.Verify(pub, data, sig) {
+		return errBadSignature
+	}
+	return nil
+}
+
+// readTrustedIndex returns the content of the index. If -pubkey is set, the
+// signature is verified first. We return the bytes we verified so the index
+// can't change between verifying and parsing.
+func readTrustedIndex() ([]byte, error) {
+	data, err := os.ReadFile(indexFile)
+	if err != nil {
+		return nil, err
+	}
+	if pubKeyFile == "" {
+		return data, nil
+	}
+
+	pub, err := loadPublicKey(pubKeyFile)
+	if err != nil {
+		return nil, err
+	}
+	if err := verifyIndex(pub, indexFile, data); err != nil {
+		return nil, fmt.Errorf("%s: %w", indexFile, err)
+	}
+	return data, nil
+}
+
+// verify checks the index signature
+func verify(context.Context) int {
+	if pubKeyFile == "" {
+		fmt.Fprintf(os.Stderr, "%s: missing -pubkey\n", prog)
+		return 1
+	}
+
+	if _, err := readTrustedIndex(); err != nil {
+		if !status {
+			fmt.Fprintf(os.Stderr, "%s: %s\n", prog, err)
+		}
+		return 1
+	}
+
+	if !status && !quiet {
+		fmt.Printf("%s: signature OK\n", indexFile)
+	}
+	return 0
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// signedIndex returns an index signed with a new key and the public key
+func signedIndex(t *testing.T, dir string) (index, pubKey string) {
+	t.Helper()
+	writeFiles(t, dir, map[string][]byte{
+		"a.txt": []byte("a"),
+		"SUMS":  []byte(sha256Hex([]byte("a")) + "  a.txt\n"),
+	})
+	index = filepath.Join(dir, "SUMS")
+	key := filepath.Join(dir, "release.key")
+	if code, _, errOut := runCommand(t, "keygen", "-key", key); code != 0 {
+		t.Fatalf("keygen: %s", errOut)
+	}
+	if code, _, errOut := runCommand(t, "sign", "-key", key, "-index", index); code != 0 {
+		t.Fatalf("sign: %s", errOut)
+	}
+	return index, key + ".pub"
+}
+
+func TestSignature(t *testing.T) {
+	dir := t.TempDir()
+	index, pubKey := signedIndex(t, dir)
+	if code, out, errOut := runCommand(t, "check", "-index", index, "-pubkey", pubKey); code != 0 || out != "a.txt: OK\n" {
+		t.Fatalf("signed index: exit code %d\n%s%s", code, out, errOut)
+	}
+
+	data, err := os.ReadFile(index)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sig, err := os.ReadFile(sigFileName(index))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A second key pair, its signatures don't match pubKey
+	otherKey := filepath.Join(dir, "other.key")
+	if code, _, errOut := runCommand(t, "keygen", "-key", otherKey); code != 0 {
+		t.Fatalf("keygen: %s", errOut)
+	}
+
+	cases := []struct {
+		name   string
+		change func()
+		err    error // nil for any error
+	}{
+		{
+			"tampered index",
+			func() {
+				tampered := strings.Replace(string(data), "a.txt", "b.txt", 1)
+				writeFiles(t, dir, map[string][]byte{"SUMS": []byte(tampered)})
+			},
+			errBadSignature,
+		},
+		{
+			"line added",
+			func() {
+				writeFiles(t, dir, map[string][]byte{"SUMS": append(data, []byte(sha256Hex(nil)+"  b.txt\n")...)})
+			},
+			errBadSignature,
+		},
+		{
+			"other key",
+			func() {
+				if code, _, errOut := runCommand(t, "sign", "-key", otherKey, "-index", index); code != 0 {
+					t.Fatalf("sign: %s", errOut)
+				}
+			},
+			errBadSignature,
+		},
+		{"missing signature", func() { os.Remove(sigFileName(index)) }, os.ErrNotExist},
+		{
+			"bad signature file",
+			func() { writeFiles(t, dir, map[string][]byte{"SUMS.sig": []byte("not base64!\n")}) },
+			nil,
+		},
+		{
+			"short signature",
+			func() { writeFiles(t, dir, map[string][]byte{"SUMS.sig": sig[:20]}) },
+			nil,
+		},
+	}
+	for _, tc := range cases {
+		writeFiles(t, dir, map[string][]byte{"SUMS": data, "SUMS.sig": sig})
+		tc.change()
+
+		indexFile, pubKeyFile = index, pubKey
+		_, err := readTrustedIndex()
+		if err == nil || (tc.err != nil && !errors.Is(err, tc.err)) {
+			t.Errorf("%s: got error %v, want %v", tc.name, err, tc.err)
+		}
+
+		// check refuses the index, nothing is hashed
+		code, out, errOut := runCommand(t, "check", "-index", index, "-pubkey", pubKey)
+		if code != 1 || out != "" || !strings.Contains(errOut, "SUMS") {
+			t.Errorf("%s: check exit code %d\n%s%s", tc.name, code, out, errOut)
+		}
+	}
+}
+
+// keygen doesn't overwrite keys, sign refuses a bad index
+func TestSignErrors(t *testing.T) {
+	dir := t.TempDir()
+	index, _ := signedIndex(t, dir)
+	key := filepath.Join(dir, "release.key")
+	if code, _, _ := runCommand(t, "keygen", "-key", key); code == 0 {
+		t.Errorf("keygen overwrote %s", key)
+	}
+
+	writeFiles(t, dir, map[string][]byte{"SUMS": []byte("not an index\n")})
+	if code, _, _ := runCommand(t, "sign", "-key", key, "-index", index); code == 0 {
+		t.Errorf("signed a bad index")
+	}
+	if code, _, _ := runCommand(t, "sign", "-key", key+".pub", "-index", index); code == 0 {
+		t.Errorf("signed with a public key")
+	}
+}
@@ -14,115 +14,741 @@ they math the ones in the index file.
     non-zero value
 
 Grab taxi-sha256.zip from the web site and open it. The index file is sha256sum.txt
+
+The checker behaves like "sha256sum -c", so it can be used in shell pipelines:
+
+	go run ./taxi -index taxi/taxi-sha256/sha256sum.txt
+	taxi-01.csv: OK
+	taxi-02.csv: OK
+	...
+
+To create an index (like sha256sum.txt) use the generate command:
+
+	go run ./taxi generate -dir taxi/taxi-sha256 -include '*.bz2' -o sha256sum.txt
+
+Index files can be signed, check refuses an index with a bad signature:
+
+	go run ./taxi keygen -key release.key
+	go run ./taxi sign -key release.key -index sha256sum.txt
+	go run ./taxi check -pubkey release.key.pub -index sha256sum.txt
+
+For a single root hash over a directory tree, see manifest.go. To hash huge
+files in parallel blocks and locate corrupted byte ranges, see chunk.go.
+Every command has its own options, see "go run ./taxi <command> -h". For
+statistics over the trips in the files, see the trips command.
 */
 package main
 
 import (
 	"bufio"
-	"compress/bzip2"
-	"crypto/sha256"
+	"bytes"
+	"context"
+	"errors"
+	"flag"
 	"fmt"
 	"io"
-	"log"
 	"os"
-	"path"
+	"path/filepath"
+	"runtime"
 	"strings"
 	"time"
+
+	"day1/decompress"
+	"day1/digest"
+	"day1/internal/cli"
 )
 
-func fileSig(path string) (string, error) {
+// fileSig returns the signature of the decompressed content of path (as it
+// is on disk if raw) and the number of bytes hashed, it stops early when ctx
+// is cancelled
+func fileSig(ctx context.Context, path string, alg digest.Algorithm, raw bool) (string, int64, error) {
 	file, err := os.Open(path)
 	if err != nil {
-		return "", err
+		return "", 0, err
 	}
 	defer file.Close()
 
-	hash := sha256.New()
-	_, err = io.Copy(hash, bzip2.NewReader(file))
+	info, err := file.Stat()
 	if err != nil {
-		return "", err
+		return "", 0, err
+	}
+
+	fm := meter.startFile(filepath.Base(path), info.Size())
+	defer fm.done()
+
+	cf := fm.file(file)
+	var r io.Reader = cf
+	if !raw {
+		dr, err := decompress.NewFileReader(cf, info.Size())
+		if err != nil {
+			return "", 0, &os.PathError{Op: "decompress", Path: path, Err: err}
+		}
+		defer dr.Close()
+		r = dr
+	}
+
+	cr := &ctxReader{ctx: ctx, r: fm.reader(r, true)}
+	sig, err := digest.Sum(alg, cr)
+	return sig, cr.n, err
+}
+
+// ctxReader fails reads once ctx is done, it also counts bytes
+type ctxReader struct {
+	ctx context.Context
+	r   io.Reader
+	n   int64
+}
+
+func (c *ctxReader) Read(p []byte) (int, error) {
+	if err := c.ctx.Err(); err != nil {
+		return 0, err
+	}
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// resolveName returns the path of name in dir. The index has the names of
+// the uncompressed files (taxi-01.csv), if it's not there we look for a
+// compressed version (taxi-01.csv.bz2).
+func resolveName(dir, name string) string {
+	path := filepath.Join(dir, name)
+	if suffix != "" {
+		return path + suffix
+	}
+	if raw {
+		return path
+	}
+
+	if _, err := os.Stat(path); err == nil {
+		return path
+	}
+	for _, ext := range decompress.Extensions() {
+		if _, err := os.Stat(path + ext); err == nil {
+			return path + ext
+		}
 	}
+	return path
+}
+
+// isRaw returns true if the file of name at path should be hashed as it is on
+// disk, like sha256sum does when the file named in the index is there (even
+// a .tgz or gzip data named .bin). We decompress only the compressed version
+// we found instead (taxi-01.csv.bz2 for taxi-01.csv), or with -decompress.
+func isRaw(dir, name, path string) bool {
+	if raw {
+		return true
+	}
+	return path == filepath.Join(dir, name) && !decompressAll
+}
+
+// sigEntry is a single line in a signature file
+type sigEntry struct {
+	name      string
+	signature string
+	alg       digest.Algorithm
+	binary    bool // "*name" marker, we hash text & binary the same way
+
+	// Chunked mode, see chunk.go. blocks and size are from <index>.blocks,
+	// nil if we don't know the expected block digests.
+	chunk  int64
+	blocks []string
+	size   int64
+
+	raw bool // hash the file as it is on disk, see isRaw
+}
+
+// Reasons for bad lines in a signature file
+var (
+	errFieldCount   = errors.New("wrong number of fields")
+	errNotHex       = errors.New("digest is not hex")
+	errDigestLength = errors.New("wrong digest length")
+	errAlgorithm    = errors.New("algorithm mismatch")
+	errBadEscape    = errors.New("bad escape in file name")
+	errBlockSize    = errors.New("bad block size")
+	errDuplicate    = errors.New("duplicate file name with conflicting digest")
+)
+
+// sigLineError is a bad line in a signature file
+type sigLineError struct {
+	Line int    // 1 based
+	Text string // the line
+	Err  error  // one of the err* reasons above
+}
+
+func (e *sigLineError) Error() string {
+	return fmt.Sprintf("line %d: %s: %q", e.Line, e.Err, e.Text)
+}
 
-	return fmt.Sprintf("%x", hash.Sum(nil)), nil
+func (e *sigLineError) Unwrap() error {
+	return e.Err
 }
 
-// Parse signature file. Return map of path->signature
-func parseSigFile(r io.Reader) (map[string]string, error) {
-	sigs := make(map[string]string)
+// sigFileError has all the bad lines in a signature file
+type sigFileError struct {
+	Lines []*sigLineError
+}
+
+func (e *sigFileError) Error() string {
+	const max = 3 // don't flood the terminal
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s improperly formatted", cli.Plural(len(e.Lines), "line is", "lines are"))
+	for i, le := range e.Lines {
+		if i == max {
+			fmt.Fprintf(&b, "; ... (%d more)", len(e.Lines)-max)
+			break
+		}
+		fmt.Fprintf(&b, "; %s", le)
+	}
+	return b.String()
+}
+
+// Parse signature file. Return entries in file order. Every bad line is
+// reported in a *sigFileError. In lenient mode the valid entries are returned
+// together with the error (which sha256sum -c does), otherwise entries is nil
+// if there are bad lines.
+// If alg is the zero Algorithm, it's detected from the digest length.
+func parseSigFile(r io.Reader, alg digest.Algorithm, lenient bool) ([]sigEntry, error) {
+	var entries []sigEntry
+	var bad []*sigLineError
+	seen := make(map[string]int) // name -> line number
+	byName := make(map[string]string)
 	scanner := bufio.NewScanner(r)
+	lnum := 0
 	for scanner.Scan() {
-		// Line example
+		lnum++
+		// Line examples
 		// 6c6427da7893932731901035edbb9214  nasa-00.log
-		fields := strings.Fields(scanner.Text())
-		if len(fields) != 2 {
-			// TODO: line number
-			return nil, fmt.Errorf("bad line: %q", scanner.Text())
+		// SHA256 (taxi-01.csv) = 0c4ccc63a912bbd6d45174251415c089522e5c0e75286794ab1f86cb8e2561fd
+		line := strings.TrimSuffix(scanner.Text(), "\r")
+		if line == "" || line[0] == '#' {
+			continue
+		}
+
+		e, err := parseSigLine(line, alg)
+		if err != nil {
+			bad = append(bad, &sigLineError{lnum, line, err})
+			continue
 		}
-		sigs[fields[1]] = fields[0]
+
+		if sig, ok := byName[e.name]; ok {
+			if sig != e.signature {
+				err := fmt.Errorf("%w (see line %d)", errDuplicate, seen[e.name])
+				bad = append(bad, &sigLineError{lnum, line, err})
+			}
+			continue
+		}
+		seen[e.name], byName[e.name] = lnum, e.signature
+		entries = append(entries, e)
 	}
 
 	if err := scanner.Err(); err != nil {
 		return nil, err
 	}
 
-	return sigs, nil
+	if len(bad) == 0 {
+		return entries, nil
+	}
+
+	if !lenient {
+		entries = nil
+	}
+	return entries, &sigFileError{bad}
+}
+
+// parseSigLine parses a line in GNU coreutils format:
+//
+//	<hex><space><space or *><name>
+//
+// or in BSD tagged format:
+//
+//	<ALGO> (<name>) = <hex>
+//
+// or a tree hash of blocks (see chunk.go):
+//
+//	<ALGO>-TREE-<block size> (<name>) = <hex>
+//
+// A leading backslash means the name is escaped (\\ and \n).
+func parseSigLine(line string, alg digest.Algorithm) (sigEntry, error) {
+	escaped := false
+	if strings.HasPrefix(line, `\`) {
+		escaped = true
+		line = line[1:]
+	}
+
+	var e sigEntry
+	var rest string
+	if te, name, ok, err := parseTreeLine(line); ok {
+		if err != nil {
+			return sigEntry{}, err
+		}
+		if alg.Name != "" && alg.Name != te.alg.Name {
+			return sigEntry{}, errAlgorithm
+		}
+		e, rest = te, name
+	} else if tagAlg, name, sig, err := digest.ParseTagged(line); err == nil {
+		if alg.Name != "" && alg.Name != tagAlg.Name {
+			return sigEntry{}, errAlgorithm
+		}
+		e = sigEntry{signature: sig, alg: tagAlg, binary: true}
+		rest = name
+	} else {
+		i := strings.IndexByte(line, ' ')
+		if i == -1 {
+			return sigEntry{}, errFieldCount
+		}
+		e = sigEntry{signature: strings.ToLower(line[:i]), alg: alg}
+		if !digest.IsHex(e.signature) {
+			return sigEntry{}, errNotHex
+		}
+		if e.alg.Name == "" {
+			if e.alg, err = digest.BySize(len(e.signature)); err != nil {
+				return sigEntry{}, errDigestLength
+			}
+		}
+		if len(e.signature) != e.alg.HexLen() {
+			return sigEntry{}, errDigestLength
+		}
+
+		rest = line[i+1:]
+		if strings.HasPrefix(rest, " ") || strings.HasPrefix(rest, "*") {
+			e.binary = rest[0] == '*'
+			rest = rest[1:]
+		}
+	}
+	if rest == "" {
+		return sigEntry{}, errFieldCount
+	}
+
+	if escaped {
+		name, ok := unescapeName(rest)
+		if !ok {
+			return sigEntry{}, errBadEscape
+		}
+		rest = name
+	}
+	e.name = rest
+
+	return e, nil
+}
+
+// unescapeName undoes coreutils escaping of file names with \ or newline
+func unescapeName(s string) (string, bool) {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] != '\\' {
+			b.WriteByte(s[i])
+			continue
+		}
+		i++
+		if i == len(s) {
+			return "", false
+		}
+		switch s[i] {
+		case '\\':
+			b.WriteByte('\\')
+		case 'n':
+			b.WriteByte('\n')
+		default:
+			return "", false
+		}
+	}
+	return b.String(), true
+}
+
+// escapeName is the reverse of unescapeName, used when printing names
+func escapeName(name string) (string, bool) {
+	if !strings.ContainsAny(name, "\\\n") {
+		return name, false
+	}
+	name = strings.ReplaceAll(name, `\`, `\\`)
+	name = strings.ReplaceAll(name, "\n", `\n`)
+	return name, true
+}
+
+var (
+	prog = filepath.Base(os.Args[0])
+
+	// Options of several commands, see the flags functions in commands
+	indexFile     string
+	dataDir       string
+	suffix        string
+	raw           bool
+	decompressAll bool
+	algo          string
+	quiet         bool
+	status        bool
+	strict        bool
+	ignoreMissing bool
+	warn          bool
+	verbose       bool
+	workers       int
+	failFast      bool
+	format        string
+	useCache      bool
+	rehash        bool
+)
+
+// commands, the first argument. Default is check.
+var commands = map[string]cli.Command{
+	"check": {
+		Run: run,
+		Flags: func(fs *flag.FlagSet) {
+			indexFlag(fs)
+			fs.StringVar(&dataDir, "dir", "", "data directory (default is the index file directory)")
+			fs.StringVar(&suffix, "suffix", "", "suffix to add to file names in the index (default is to look for compressed files)")
+			fs.BoolVar(&decompressAll, "decompress", false, "decompress the files named in the index too (default is to hash them as they are on disk, like sha256sum)")
+			algoFlag(fs, "auto detects from digest length")
+			hashFlags(fs)
+			cacheFlags(fs)
+			reportFlags(fs)
+			fs.StringVar(&pubKeyFile, "pubkey", "", "public key file, the index must have a valid signature")
+			fs.BoolVar(&strict, "strict", false, "exit non-zero for improperly formatted checksum lines")
+			fs.BoolVar(&ignoreMissing, "ignore-missing", false, "don't fail or report status for missing files")
+			fs.BoolVar(&warn, "warn", false, "warn about improperly formatted checksum lines")
+			fs.BoolVar(&failFast, "fail-fast", false, "stop on the first mismatch or read error")
+			fs.StringVar(&format, "format", "text", "report format: text, json or ndjson")
+			fs.BoolVar(&verbose, "v", false, "print number of processed files and time to stderr")
+		},
+		Help: "check the files in an index, like sha256sum -c",
+	},
+	"generate": {
+		Run: generate,
+		Flags: func(fs *flag.FlagSet) {
+			fs.StringVar(&dataDir, "dir", ".", "directory with the files to index")
+			walkFlags(fs)
+			fs.BoolVar(&recursive, "r", false, "walk sub directories")
+			fs.StringVar(&output, "o", "-", "index file to write, - is stdout")
+			fs.BoolVar(&bsdTag, "tag", false, "write BSD style lines (SHA256 (name) = hex)")
+			algoFlag(fs, "auto is sha256")
+			hashFlags(fs)
+			cacheFlags(fs)
+			fs.StringVar(&chunkSize, "chunk", "", "hash files in blocks of this size (e.g. 4MiB) in parallel, write tree hashes and the block digests to <index>.blocks")
+			fs.BoolVar(&verbose, "v", false, "print number of signatures to stderr")
+		},
+		Help: "create an index of the files in a directory",
+	},
+	"keygen": {
+		Run: keygen,
+		Flags: func(fs *flag.FlagSet) {
+			fs.StringVar(&keyFile, "key", "", "private key file to create, the public key is written to <key>.pub")
+			fs.BoolVar(&verbose, "v", false, "print the files written to stderr")
+		},
+		Help: "create an Ed25519 key pair",
+	},
+	"sign": {
+		Run: sign,
+		Flags: func(fs *flag.FlagSet) {
+			indexFlag(fs)
+			fs.StringVar(&keyFile, "key", "", "private key file")
+		},
+		Help: "sign an index, the signature is written to <index>.sig",
+	},
+	"verify": {
+		Run: verify,
+		Flags: func(fs *flag.FlagSet) {
+			indexFlag(fs)
+			fs.StringVar(&pubKeyFile, "pubkey", "", "public key file")
+			reportFlags(fs)
+		},
+		Help: "check the signature of an index",
+	},
+
+	"manifest": {
+		Run: buildManifest,
+		Flags: func(fs *flag.FlagSet) {
+			fs.StringVar(&dataDir, "dir", ".", "root of the directory tree")
+			walkFlags(fs)
+			fs.StringVar(&output, "o", "-", "manifest file to write, - is stdout")
+			algoFlag(fs, "auto is sha256")
+			hashFlags(fs)
+			fs.BoolVar(&verbose, "v", false, "print number of files and the root hash to stderr")
+		},
+		Help: "create a Merkle tree manifest of a directory tree",
+	},
+	"verify-manifest": {
+		Run: verifyManifest,
+		Flags: func(fs *flag.FlagSet) {
+			manifestFlag(fs)
+			fs.StringVar(&dataDir, "dir", "", "root of the directory tree (default is the manifest directory)")
+			walkFlags(fs)
+			hashFlags(fs)
+			reportFlags(fs)
+		},
+		Help: "report the files and directories that changed since the manifest",
+	},
+	"prove": {
+		Run: prove,
+		Flags: func(fs *flag.FlagSet) {
+			manifestFlag(fs)
+			fs.StringVar(&proveFile, "file", "", "path of the file in the manifest")
+			fs.StringVar(&output, "o", "-", "proof file to write, - is stdout")
+		},
+		Help: "write an inclusion proof of a file in a manifest",
+	},
+	"verify-proof": {
+		Run: verifyProof,
+		Flags: func(fs *flag.FlagSet) {
+			fs.StringVar(&proofFile, "proof", "", "inclusion proof file")
+			fs.StringVar(&rootHash, "root", "", "trusted root hash (default is the root in -manifest)")
+			manifestFlag(fs)
+			fs.StringVar(&proveFile, "file", "", "file on disk to hash (default is to trust the digest in the proof)")
+			fs.BoolVar(&raw, "raw", false, "hash a compressed file (taxi-01.csv.bz2) as it is on disk, don't decompress it")
+			reportFlags(fs)
+		},
+		Help: "check an inclusion proof against a trusted root hash",
+	},
+}
+
+func indexFlag(fs *flag.FlagSet) {
+	fs.StringVar(&indexFile, "index", "sha256sum.txt", "signature index file")
+}
+
+func manifestFlag(fs *flag.FlagSet) {
+	fs.StringVar(&manifestFile, "manifest", "manifest.json", "manifest file")
+}
+
+func algoFlag(fs *flag.FlagSet, auto string) {
+	fs.StringVar(&algo, "algo", "auto", "hash algorithm (md5, sha1, sha224, sha256, sha384, sha512, sha512/256), "+auto)
+}
+
+// hashFlags adds the options of commands hashing files
+func hashFlags(fs *flag.FlagSet) {
+	fs.BoolVar(&raw, "raw", false, "hash compressed files (taxi-01.csv.bz2) as they are on disk, don't decompress them")
+	fs.IntVar(&workers, "j", runtime.NumCPU(), "number of files to hash concurrently")
+	fs.BoolVar(&showProgress, "progress", isTerminal(os.Stdout), "show progress on stderr (live on a terminal, log lines otherwise), default is on when stdout is a terminal")
+	fs.DurationVar(&progressInterval, "progress-interval", 5*time.Second, "time between progress log lines when stderr is not a terminal")
+}
+
+func cacheFlags(fs *flag.FlagSet) {
+	fs.BoolVar(&useCache, "cache", false, "cache signatures in <index>.cache and skip unchanged files")
+	fs.BoolVar(&rehash, "rehash", false, "ignore cached signatures (the cache is still updated)")
+}
+
+// walkFlags adds the options of commands listing the files of a directory
+func walkFlags(fs *flag.FlagSet) {
+	fs.Var(&includes, "include", "only use files matching glob (can be repeated)")
+	fs.Var(&excludes, "exclude", "skip files matching glob (can be repeated)")
+}
+
+func reportFlags(fs *flag.FlagSet) {
+	fs.BoolVar(&quiet, "quiet", false, "don't print OK for each successfully verified file")
+	fs.BoolVar(&status, "status", false, "don't output anything, status code shows success")
 }
 
 func main() {
-	rootDir := "./taxi/taxi-sha256" // Change to where to unzipped taxi-sha256.zip
-	file, err := os.Open(path.Join(rootDir, "sha256sum.txt"))
+	cli.Main(commands, "check")
+}
+
+// run does the check and returns the exit code
+func run(sigCtx context.Context) int {
+	rep, err := newReporter(format)
 	if err != nil {
-		log.Fatalf("error: %s", err)
+		fmt.Fprintf(os.Stderr, "%s: %s\n", prog, err)
+		return 1
 	}
-	defer file.Close()
 
-	sigs, err := parseSigFile(file)
+	var alg digest.Algorithm
+	if algo != "auto" {
+		var err error
+		if alg, err = digest.ByName(algo); err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %s\n", prog, err)
+			return 1
+		}
+	}
+
+	data, err := readTrustedIndex()
 	if err != nil {
-		log.Fatalf("error: %s", err)
+		fmt.Fprintf(os.Stderr, "%s: %s\n", prog, err)
+		return 1
+	}
+
+	// Like sha256sum, bad lines are skipped
+	sigs, err := parseSigFile(bytes.NewReader(data), alg, true)
+	bad := 0
+	var fileErr *sigFileError
+	switch {
+	case errors.As(err, &fileErr):
+		bad = len(fileErr.Lines)
+		if warn && !status {
+			for _, le := range fileErr.Lines {
+				fmt.Fprintf(os.Stderr, "%s: %s: %d: improperly formatted checksum line: %s\n", prog, indexFile, le.Line, le.Err)
+			}
+		}
+	case err != nil:
+		fmt.Fprintf(os.Stderr, "%s: %s: %s\n", prog, indexFile, err)
+		return 1
+	}
+
+	if len(sigs) == 0 {
+		fmt.Fprintf(os.Stderr, "%s: %s: no properly formatted checksum lines found\n", prog, indexFile)
+		return 1
+	}
+
+	if err := loadBlocks(indexFile, sigs); err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %s\n", prog, err)
+		return 1
 	}
 
+	rootDir := dataDir
+	if rootDir == "" {
+		rootDir = filepath.Dir(indexFile)
+	}
+
+	ctx, cancel := context.WithCancel(sigCtx)
+	defer cancel()
+
+	var cache *sigCache
+	if useCache {
+		cache = loadCache(cacheFileName(indexFile))
+	}
+
+	paths := make([]string, len(sigs))
+	for i, e := range sigs {
+		paths[i] = resolveName(rootDir, e.name)
+		sigs[i].raw = isRaw(rootDir, e.name, paths[i])
+	}
+	stopProgress := startProgress(paths)
+
 	start := time.Now()
-	ok := true
-	ch := make(chan result)
-	for name, signature := range sigs {
-		fileName := path.Join(rootDir, name) + ".bz2"
-		// sig, err := fileSig(fileName)
-		go sigWorker(fileName, signature, ch)
+	jobs := make(chan job)
+	ch := make(chan result, workers)
+	for i := 0; i < workers; i++ {
+		go sigWorker(ctx, jobs, ch, cache)
 	}
+	go func() {
+		defer close(jobs)
+		for i, e := range sigs {
+			jobs <- job{id: i, fileName: paths[i], entry: e}
+		}
+	}()
+
+	// Workers finish in any order, print in index order like sha256sum
+	results := make([]*result, len(sigs))
+	next := 0
+	sum := summary{Type: "summary", Files: len(sigs), BadLines: bad}
 	for range sigs {
 		r := <-ch
-		if r.err != nil {
-			fmt.Fprintf(os.Stderr, "error: %s - %s\n", r.fileName, err)
-			ok = false
-			continue
+		results[r.id] = &r
+		if failFast && (r.err != nil || !r.match) && !isCanceled(r.err) {
+			cancel()
 		}
 
-		if !r.match {
-			ok = false
-			fmt.Printf("error: %s mismatch\n", r.fileName)
+		for ; next < len(results) && results[next] != nil; next++ {
+			sum.add(results[next])
+			rep.file(sigs[next], results[next])
 		}
 	}
 
-	duration := time.Since(start)
-	fmt.Printf("processed %d files in %v\n", len(sigs), duration)
-	if !ok {
-		os.Exit(1)
+	stopProgress()
+	sum.duration = time.Since(start)
+	sum.DurationMS = ms(sum.duration)
+	sum.Interrupted = sigCtx.Err() != nil
+	rep.summary(sum)
+
+	if cache != nil {
+		if err := cache.save(); err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %s\n", prog, err)
+		}
+	}
+
+	if sum.Interrupted {
+		return 130 // 128 + SIGINT, like the shell
+	}
+
+	if ignoreMissing && sum.OK+sum.Failed+sum.Unreadable+sum.Skipped == 0 {
+		fmt.Fprintf(os.Stderr, "%s: %s: no file was verified\n", prog, indexFile)
+		return 1
+	}
+
+	if sum.Failed > 0 || sum.Unreadable > 0 || (strict && bad > 0) {
+		return 1
 	}
+	return 0
 }
 
-func sigWorker(fileName, signature string, ch chan result) {
-	r := result{fileName: fileName}
-	sig, err := fileSig(fileName)
-	if err != nil {
-		r.err = err
-	} else {
-		r.match = sig == signature
+// errCause drops the "open <path>" part of *os.PathError, sha256sum prints
+// the name from the index instead
+func errCause(err error) error {
+	var pe *os.PathError
+	if errors.As(err, &pe) {
+		return pe.Err
 	}
-	ch <- r
+	return err
 }
 
-type result struct {
+func isCanceled(err error) bool {
+	return errors.Is(err, context.Canceled)
+}
+
+// job is a file to check
+type job struct {
+	id       int // position in the index
 	fileName string
-	err      error
-	match    bool
+	entry    sigEntry
+}
+
+// sigWorker checks files from jobs until jobs is closed. Once ctx is
+// cancelled, the remaining jobs are reported with a context.Canceled error.
+// cache can be nil.
+func sigWorker(ctx context.Context, jobs <-chan job, ch chan<- result, cache *sigCache) {
+	for j := range jobs {
+		r := result{id: j.id, fileName: j.fileName}
+		if err := ctx.Err(); err != nil {
+			r.err = err
+			ch <- r
+			continue
+		}
+
+		start := time.Now()
+		info, statErr := os.Stat(j.fileName)
+		if statErr == nil {
+			r.size = info.Size()
+		}
+
+		cached := false
+		if cache != nil && statErr == nil {
+			if e, ok := cache.lookup(j.fileName, info, j.entry); ok {
+				meter.skipFile(info.Size())
+				r.signature, r.blocks, r.bytesRead, r.cached = e.Digest, e.Blocks, e.BytesRead, true
+				cached = true
+			}
+		}
+
+		if !cached {
+			if j.entry.chunk > 0 {
+				r.signature, r.blocks, r.bytesRead, r.err = chunkSig(ctx, j.fileName, j.entry.alg, j.entry.chunk, j.entry.raw)
+			} else {
+				r.signature, r.bytesRead, r.err = fileSig(ctx, j.fileName, j.entry.alg, j.entry.raw)
+			}
+			if cache != nil && statErr == nil && r.err == nil {
+				cache.add(j.fileName, info, j.entry, &r, start)
+			}
+		}
+
+		r.match = r.err == nil && r.signature == j.entry.signature
+		if !r.match && r.err == nil && j.entry.blocks != nil && r.blocks != nil {
+			size := j.entry.size
+			if r.bytesRead > size {
+				size = r.bytesRead
+			}
+			r.badRanges = badRanges(j.entry.blocks, r.blocks, j.entry.chunk, size)
+		}
+		r.duration = time.Since(start)
+		ch <- r
+	}
+}
+
+type result struct {
+	id        int // position in the index
+	fileName  string
+	err       error
+	match     bool
+	signature string        // actual signature
+	bytesRead int64         // decompressed bytes
+	size      int64         // file size on disk
+	duration  time.Duration // time to hash
+	cached    bool          // signature from cache
+	blocks    []string      // block digests in chunked mode
+	badRanges []byteRange   // blocks that don't match <index>.blocks
 }
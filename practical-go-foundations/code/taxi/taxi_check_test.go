@@ -0,0 +1,315 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"day1/digest"
+)
+
+const (
+	emptySHA256 = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+	emptyMD5    = "d41d8cd98f00b204e9800998ecf8427e"
+)
+
+func TestParseSigLine(t *testing.T) {
+	cases := []struct {
+		line   string
+		name   string
+		alg    string
+		binary bool
+	}{
+		{emptySHA256 + "  taxi-01.csv", "taxi-01.csv", "sha256", false},
+		{emptySHA256 + " *taxi-01.csv", "taxi-01.csv", "sha256", true},
+		{strings.ToUpper(emptySHA256) + "  taxi-01.csv", "taxi-01.csv", "sha256", false},
+		{emptyMD5 + "  nasa-00.log", "nasa-00.log", "md5", false},
+		{emptySHA256 + "  name with  spaces", "name with  spaces", "sha256", false},
+		{"SHA256 (taxi-01.csv) = " + emptySHA256, "taxi-01.csv", "sha256", true},
+		{"MD5 (a (1).txt) = " + emptyMD5, "a (1).txt", "md5", true},
+		{`\` + emptySHA256 + `  a\\b\nc`, "a\\b\nc", "sha256", false},
+	}
+	for _, tc := range cases {
+		e, err := parseSigLine(tc.line, digest.Algorithm{})
+		if err != nil {
+			t.Errorf("%q: %s", tc.line, err)
+			continue
+		}
+		if e.name != tc.name || e.alg.Name != tc.alg || e.binary != tc.binary {
+			t.Errorf("%q: got name %q, alg %s, binary %v; want %q, %s, %v", tc.line, e.name, e.alg.Name, e.binary, tc.name, tc.alg, tc.binary)
+		}
+		if e.signature != strings.ToLower(e.signature) {
+			t.Errorf("%q: signature not lower case: %s", tc.line, e.signature)
+		}
+	}
+}
+
+func TestParseSigLineErrors(t *testing.T) {
+	cases := []struct {
+		line string
+		alg  string // "" to detect
+		err  error
+	}{
+		{emptySHA256, "", errFieldCount},
+		{emptySHA256 + " ", "", errFieldCount},
+		{"xyz  taxi-01.csv", "", errNotHex},
+		{emptySHA256[:60] + "  taxi-01.csv", "", errDigestLength},
+		{emptyMD5 + "  taxi-01.csv", "sha256", errDigestLength},
+		{"MD5 (taxi-01.csv) = " + emptyMD5, "sha256", errAlgorithm},
+		{`\` + emptySHA256 + `  a\tb`, "", errBadEscape},
+		{`\` + emptySHA256 + `  a\`, "", errBadEscape},
+	}
+	for _, tc := range cases {
+		var alg digest.Algorithm
+		if tc.alg != "" {
+			var err error
+			if alg, err = digest.ByName(tc.alg); err != nil {
+				t.Fatal(err)
+			}
+		}
+		_, err := parseSigLine(tc.line, alg)
+		if !errors.Is(err, tc.err) {
+			t.Errorf("%q: got error %v, want %v", tc.line, err, tc.err)
+		}
+	}
+}
+
+func TestEscapeName(t *testing.T) {
+	for _, name := range []string{"taxi-01.csv", `a\b`, "a\nb", `\\n`} {
+		escaped, ok := escapeName(name)
+		if ok != strings.ContainsAny(name, "\\\n") {
+			t.Errorf("escapeName(%q): escaped is %v", name, ok)
+		}
+		if !ok {
+			continue
+		}
+		got, ok := unescapeName(escaped)
+		if !ok || got != name {
+			t.Errorf("unescapeName(%q) = %q, %v; want %q", escaped, got, ok, name)
+		}
+	}
+}
+
+func TestParseSigFile(t *testing.T) {
+	index := strings.Join([]string{
+		"# comment",
+		emptySHA256 + "  a.csv",
+		"not-a-line",
+		"",
+		emptySHA256 + "  b.csv\r",
+		emptySHA256 + "  a.csv", // same digest, ignored
+		emptyMD5 + "  a.csv",
+	}, "\n")
+
+	entries, err := parseSigFile(strings.NewReader(index), digest.Algorithm{}, true)
+	var fe *sigFileError
+	if !errors.As(err, &fe) {
+		t.Fatalf("got error %v, want *sigFileError", err)
+	}
+	if len(entries) != 2 || entries[0].name != "a.csv" || entries[1].name != "b.csv" {
+		t.Errorf("lenient entries: %+v", entries)
+	}
+
+	want := []struct {
+		line int
+		err  error
+	}{
+		{3, errFieldCount},
+		{7, errDuplicate},
+	}
+	if len(fe.Lines) != len(want) {
+		t.Fatalf("got %d bad lines, want %d: %s", len(fe.Lines), len(want), err)
+	}
+	for i, w := range want {
+		le := fe.Lines[i]
+		if le.Line != w.line || !errors.Is(le, w.err) {
+			t.Errorf("bad line %d: got line %d (%v), want line %d (%v)", i, le.Line, le.Err, w.line, w.err)
+		}
+	}
+	if !strings.Contains(fe.Lines[1].Error(), "see line 2") {
+		t.Errorf("duplicate doesn't point to the first line: %s", fe.Lines[1])
+	}
+
+	entries, err = parseSigFile(strings.NewReader(index), digest.Algorithm{}, false)
+	if err == nil || entries != nil {
+		t.Errorf("strict: got %d entries and error %v, want no entries and an error", len(entries), err)
+	}
+}
+
+// runCommand runs the command name with args like main does, and returns
+// its exit code and output
+func runCommand(t *testing.T, name string, args ...string) (code int, out, errOut string) {
+	t.Helper()
+	cmd := commands[name]
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	cmd.Flags(fs)
+	if err := fs.Parse(args); err != nil {
+		t.Fatal(err)
+	}
+
+	// Commands write to os.Stdout and os.Stderr, some through the progress
+	// meter (stdout and stderr)
+	dir := t.TempDir()
+	outFile, err := os.Create(filepath.Join(dir, "stdout"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer outFile.Close()
+	errFile, err := os.Create(filepath.Join(dir, "stderr"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer errFile.Close()
+
+	oldOut, oldErr := os.Stdout, os.Stderr
+	os.Stdout, os.Stderr = outFile, errFile
+	stdout, stderr = meterWriter{outFile}, meterWriter{errFile}
+	code = cmd.Run(context.Background())
+	os.Stdout, os.Stderr = oldOut, oldErr
+	stdout, stderr = meterWriter{oldOut}, meterWriter{oldErr}
+
+	o, _ := os.ReadFile(outFile.Name())
+	e, _ := os.ReadFile(errFile.Name())
+	return code, string(o), string(e)
+}
+
+// writeFiles writes files (name -> content) to dir
+func writeFiles(t *testing.T, dir string, files map[string][]byte) {
+	t.Helper()
+	for name, data := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), data, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func gzipBytes(t *testing.T, data []byte) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	w := gzip.NewWriter(&buf)
+	w.Write(data)
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// Files in archive formats are hashed as they are on disk, like sha256sum
+// does, even if they are gzip or zip inside
+func TestCheckArchives(t *testing.T) {
+	text := []byte("hello\n")
+	var zbuf bytes.Buffer
+	zw := zip.NewWriter(&zbuf)
+	w, _ := zw.Create("word/document.xml")
+	w.Write(text)
+	zw.Close()
+
+	files := map[string][]byte{
+		"a.txt":      text,
+		"bundle.tgz": gzipBytes(t, text),
+		"lib.jar":    zbuf.Bytes(),
+		"one.docx":   zbuf.Bytes(),
+		"a.bin":      gzipBytes(t, text),
+		"data.gz":    gzipBytes(t, text),
+	}
+	dir := t.TempDir()
+	writeFiles(t, dir, files)
+
+	var index bytes.Buffer
+	var names []string
+	for name, data := range files {
+		fmt.Fprintf(&index, "%s  %s\n", sha256Hex(data), name)
+		names = append(names, name)
+	}
+	indexPath := filepath.Join(dir, "SUMS")
+	writeFiles(t, dir, map[string][]byte{"SUMS": index.Bytes()})
+
+	code, out, errOut := runCommand(t, "check", "-index", indexPath)
+	if code != 0 {
+		t.Fatalf("exit code %d\n%s%s", code, out, errOut)
+	}
+	for _, name := range names {
+		if !strings.Contains(out, name+": OK\n") {
+			t.Errorf("%s not OK:\n%s", name, out)
+		}
+	}
+
+	// -decompress hashes the content
+	code, out, _ = runCommand(t, "check", "-index", indexPath, "-decompress")
+	if code != 1 || !strings.Contains(out, "a.txt: OK\n") || !strings.Contains(out, "a.bin: FAILED\n") {
+		t.Errorf("-decompress: exit code %d\n%s", code, out)
+	}
+}
+
+// The index has the name of the content (taxi-01.csv), we find and
+// decompress taxi-01.csv.gz
+func TestCheckCompressedFallback(t *testing.T) {
+	text := []byte("VendorID,fare_amount\n1,12.5\n")
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string][]byte{
+		"taxi-01.csv.gz": gzipBytes(t, text),
+		"SUMS":           []byte(sha256Hex(text) + "  taxi-01.csv\n"),
+	})
+
+	indexPath := filepath.Join(dir, "SUMS")
+	code, out, errOut := runCommand(t, "check", "-index", indexPath)
+	if code != 0 || out != "taxi-01.csv: OK\n" {
+		t.Errorf("exit code %d\n%s%s", code, out, errOut)
+	}
+
+	// -raw hashes the file named in the index, there's none
+	code, out, _ = runCommand(t, "check", "-index", indexPath, "-raw")
+	if code != 1 || out != "taxi-01.csv: FAILED open or read\n" {
+		t.Errorf("-raw: exit code %d\n%s", code, out)
+	}
+}
+
+// With -fail-fast, files after the first mismatch aren't checked
+func TestCheckFailFast(t *testing.T) {
+	dir := t.TempDir()
+	var index bytes.Buffer
+	for i := 0; i < 10; i++ {
+		name := fmt.Sprintf("f%d.txt", i)
+		data := []byte(name)
+		writeFiles(t, dir, map[string][]byte{name: data})
+		if i == 0 {
+			data = []byte("something else")
+		}
+		fmt.Fprintf(&index, "%s  %s\n", sha256Hex(data), name)
+	}
+	indexPath := filepath.Join(dir, "SUMS")
+	writeFiles(t, dir, map[string][]byte{"SUMS": index.Bytes()})
+
+	code, out, errOut := runCommand(t, "check", "-index", indexPath)
+	if code != 1 || strings.Count(out, ": OK\n") != 9 {
+		t.Fatalf("without -fail-fast: exit code %d\n%s%s", code, out, errOut)
+	}
+
+	// With one worker and a result buffer of one, the worker can be at most
+	// two files ahead when we see the first mismatch
+	code, out, errOut = runCommand(t, "check", "-index", indexPath, "-fail-fast", "-j", "1")
+	if code != 1 || !strings.HasPrefix(out, "f0.txt: FAILED\n") {
+		t.Errorf("exit code %d\n%s", code, out)
+	}
+	if n := strings.Count(out, "\n"); n > 3 {
+		t.Errorf("%d files reported after the failure\n%s", n-1, out)
+	}
+	if !strings.Contains(errOut, "stopped on first failure") || !strings.Contains(errOut, "of 10 files not checked") {
+		t.Errorf("stderr: %s", errOut)
+	}
+}
@@ -0,0 +1,149 @@
+package topk
+
+import (
+	"container/heap"
+	"fmt"
+	"hash/fnv"
+	"math"
+)
+
+// CountMin is a Count-Min sketch (Cormode & Muthukrishnan) with a heap of the
+// k keys with the highest estimated counts. Estimates are never too low, with
+// width w they are at most e*N/w too high (N is the total of all counts) with
+// probability 1 - e^-depth.
+//
+// Unlike SpaceSaving, the sketch can estimate the count of any key (Count),
+// not only the ones in the top k. Top sets the Error of items to the e*N/w
+// bound.
+type CountMin struct {
+	width, depth int
+	rows         [][]int64
+	total        int64 // N
+	k            int
+	h            minHeap // candidates, by estimated count
+}
+
+// NewCountMin returns a sketch of depth rows of width counters that keeps
+// the top k keys
+func NewCountMin(width, depth, k int) *CountMin {
+	if width < 1 {
+		width = 1
+	}
+	if depth < 1 {
+		depth = 1
+	}
+	rows := make([][]int64, depth)
+	for i := range rows {
+		rows[i] = make([]int64, width)
+	}
+	return &CountMin{width: width, depth: depth, rows: rows, k: k, h: minHeap{index: make(map[string]int)}}
+}
+
+// hashes returns the two hashes used to build the row hashes (Kirsch &
+// Mitzenmacher double hashing)
+func hashes(key string) (uint32, uint32) {
+	h := fnv.New64a()
+	h.Write([]byte(key))
+	sum := h.Sum64()
+	return uint32(sum), uint32(sum>>32) | 1
+}
+
+func (c *CountMin) add(key string, n int64) int64 {
+	c.total += n
+	h1, h2 := hashes(key)
+	est := int64(-1)
+	for i, row := range c.rows {
+		j := (h1 + uint32(i)*h2) % uint32(c.width)
+		row[j] += n
+		if est < 0 || row[j] < est {
+			est = row[j]
+		}
+	}
+	return est
+}
+
+// Count returns the estimated count of key
+func (c *CountMin) Count(key string) int64 {
+	h1, h2 := hashes(key)
+	est := int64(-1)
+	for i, row := range c.rows {
+		j := (h1 + uint32(i)*h2) % uint32(c.width)
+		if est < 0 || row[j] < est {
+			est = row[j]
+		}
+	}
+	return est
+}
+
+// Add adds n to the count of key
+func (c *CountMin) Add(key string, n int64) {
+	c.offer(key, c.add(key, n))
+}
+
+// offer updates the top k with the estimate of key
+func (c *CountMin) offer(key string, est int64) {
+	it := Item{Key: key, Count: est, Score: float64(est)}
+	if i, ok := c.h.index[key]; ok {
+		c.h.items[i] = it
+		heap.Fix(&c.h, i)
+		return
+	}
+	if c.h.Len() < c.k {
+		heap.Push(&c.h, it)
+		return
+	}
+	if c.k > 0 && less(c.h.items[0], it) {
+		delete(c.h.index, c.h.items[0].Key)
+		c.h.index[key] = 0
+		c.h.items[0] = it
+		heap.Fix(&c.h, 0)
+	}
+}
+
+// Top returns the k keys with the highest estimated counts, k is at most
+// the k of NewCountMin
+func (c *CountMin) Top(k int) []Item {
+	// An estimate can't be too high by more than itself
+	maxErr := int64(math.Ceil(math.E * float64(c.total) / float64(c.width)))
+	items := append([]Item(nil), c.h.items...)
+	for i := range items {
+		items[i].Error = maxErr
+		if items[i].Count < maxErr {
+			items[i].Error = items[i].Count
+		}
+	}
+	sortItems(items)
+	if k < len(items) {
+		items = items[:k]
+	}
+	return items
+}
+
+// Merge adds the counts of o, which must be a *CountMin of the same size
+func (c *CountMin) Merge(o Sketch) error {
+	other, ok := o.(*CountMin)
+	if !ok || other.width != c.width || other.depth != c.depth {
+		return fmt.Errorf("can't merge %T to count-min sketch of %dx%d", o, c.depth, c.width)
+	}
+
+	for i, row := range other.rows {
+		for j, n := range row {
+			c.rows[i][j] += n
+		}
+	}
+	c.total += other.total
+
+	// Candidates of both, with the merged estimates
+	keys := make([]string, 0, c.h.Len()+other.h.Len())
+	for _, it := range c.h.items {
+		keys = append(keys, it.Key)
+	}
+	for _, it := range other.h.items {
+		keys = append(keys, it.Key)
+	}
+	c.h = minHeap{index: make(map[string]int)}
+	for _, key := range keys {
+		c.offer(key, c.Count(key))
+	}
+	return nil
+}
@@ -0,0 +1,110 @@
+package topk
+
+import (
+	"container/heap"
+	"fmt"
+)
+
+// SpaceSaving is the Space-Saving heavy hitter algorithm (Metwally et al.)
+// with a fixed number of counters. A new key takes over the counter of the
+// smallest count and inherits it as its error, so counts are never too low
+// and are at most N/counters too high (N is the total of all counts). Every
+// key with a count above N/counters is in the counters.
+type SpaceSaving struct {
+	size int
+	h    minHeap // by count
+}
+
+// NewSpaceSaving returns a counter with size counters
+func NewSpaceSaving(size int) *SpaceSaving {
+	if size < 1 {
+		size = 1
+	}
+	return &SpaceSaving{size: size, h: minHeap{index: make(map[string]int, size)}}
+}
+
+// Add adds n to the count of key
+func (s *SpaceSaving) Add(key string, n int64) {
+	if i, ok := s.h.index[key]; ok {
+		it := &s.h.items[i]
+		it.Count += n
+		it.Score = float64(it.Count)
+		heap.Fix(&s.h, i)
+		return
+	}
+
+	if s.h.Len() < s.size {
+		heap.Push(&s.h, Item{Key: key, Count: n, Score: float64(n)})
+		return
+	}
+
+	// Replace the smallest
+	min := s.h.items[0]
+	delete(s.h.index, min.Key)
+	s.h.index[key] = 0
+	s.h.items[0] = Item{Key: key, Count: min.Count + n, Score: float64(min.Count + n), Error: min.Count}
+	heap.Fix(&s.h, 0)
+}
+
+// Top returns the k keys with the highest guaranteed counts (Count - Error),
+// a key that took over a big counter late would rank high on Count alone
+func (s *SpaceSaving) Top(k int) []Item {
+	items := append([]Item(nil), s.h.items...)
+	for i := range items {
+		items[i].Score = float64(items[i].Count - items[i].Error)
+	}
+	sortItems(items)
+	if k < len(items) {
+		items = items[:k]
+	}
+	return items
+}
+
+// min returns the smallest count if all the counters are used, a key that
+// isn't counted can have up to that
+func (s *SpaceSaving) min() int64 {
+	if s.h.Len() < s.size {
+		return 0
+	}
+	return s.h.items[0].Count
+}
+
+// Merge adds the counts of o, which must be a *SpaceSaving of the same size.
+// A key missing in one counter is counted as its smallest count (Agarwal et
+// al., "Mergeable summaries"), so the bounds hold for the merged stream.
+func (s *SpaceSaving) Merge(o Sketch) error {
+	other, ok := o.(*SpaceSaving)
+	if !ok || other.size != s.size {
+		return fmt.Errorf("can't merge %T to space saving counter of size %d", o, s.size)
+	}
+
+	min1, min2 := s.min(), other.min()
+	merged := make(map[string]Item, s.h.Len()+other.h.Len())
+	for _, it := range s.h.items {
+		it.Count += min2
+		it.Error += min2
+		merged[it.Key] = it
+	}
+	for _, it := range other.h.items {
+		if m, ok := merged[it.Key]; ok {
+			m.Count += it.Count - min2
+			m.Error += it.Error - min2
+			merged[it.Key] = m
+			continue
+		}
+		it.Count += min1
+		it.Error += min1
+		merged[it.Key] = it
+	}
+
+	t := NewHeap(s.size)
+	for _, it := range merged {
+		t.Push(it.Key, it.Count)
+	}
+	s.h = minHeap{index: make(map[string]int, s.size)}
+	for _, it := range t.Items() {
+		it.Error = merged[it.Key].Error
+		heap.Push(&s.h, it)
+	}
+	return nil
+}
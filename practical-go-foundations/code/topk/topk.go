@@ -0,0 +1,133 @@
+// Package topk finds the most frequent keys (heavy hitters) of a stream.
+//
+// Heap is exact, it keeps the k best of all the keys it's given. For streams
+// with too many distinct keys to count in a map, SpaceSaving and CountMin use
+// bounded memory and give approximate counts. Both can be merged, so every
+// goroutine can count its part of the stream.
+//
+// Items are sorted by score (the count unless given) from high to low, ties
+// by key so results are stable. Asking for more items than there are keys
+// returns all the keys.
+package topk
+
+import (
+	"container/heap"
+	"sort"
+)
+
+// Item is a key and its count
+type Item struct {
+	Key   string
+	Count int64
+	Score float64 // what items are ranked by, the count unless set
+	Error int64   // the count can be up to Error too high (with high probability for CountMin), 0 for exact counts
+}
+
+// less returns true if a ranks lower than b
+func less(a, b Item) bool {
+	if a.Score != b.Score {
+		return a.Score < b.Score
+	}
+	return a.Key > b.Key
+}
+
+// sortItems sorts items from best to worst
+func sortItems(items []Item) {
+	sort.Slice(items, func(i, j int) bool { return less(items[j], items[i]) })
+}
+
+// minHeap is a heap of items, the worst at the top. index is key -> index
+// in items, if not nil.
+type minHeap struct {
+	items []Item
+	index map[string]int
+}
+
+func (h *minHeap) Len() int           { return len(h.items) }
+func (h *minHeap) Less(i, j int) bool { return less(h.items[i], h.items[j]) }
+
+func (h *minHeap) Swap(i, j int) {
+	h.items[i], h.items[j] = h.items[j], h.items[i]
+	if h.index != nil {
+		h.index[h.items[i].Key] = i
+		h.index[h.items[j].Key] = j
+	}
+}
+
+func (h *minHeap) Push(x any) {
+	it := x.(Item)
+	if h.index != nil {
+		h.index[it.Key] = len(h.items)
+	}
+	h.items = append(h.items, it)
+}
+
+func (h *minHeap) Pop() any {
+	n := len(h.items)
+	it := h.items[n-1]
+	h.items = h.items[:n-1]
+	if h.index != nil {
+		delete(h.index, it.Key)
+	}
+	return it
+}
+
+// Heap keeps the k items with the highest scores out of all pushed, in
+// O(log k) per item and O(k) memory. Keys should be pushed once.
+type Heap struct {
+	k int
+	h minHeap
+}
+
+// NewHeap returns a heap of the top k items
+func NewHeap(k int) *Heap {
+	return &Heap{k: k}
+}
+
+// Push adds a key with its count, ranked by count
+func (t *Heap) Push(key string, count int64) {
+	t.PushScore(key, count, float64(count))
+}
+
+// PushScore adds a key with its count, ranked by score
+func (t *Heap) PushScore(key string, count int64, score float64) {
+	if t.k <= 0 {
+		return
+	}
+	it := Item{Key: key, Count: count, Score: score}
+	if t.h.Len() < t.k {
+		heap.Push(&t.h, it)
+		return
+	}
+	if less(t.h.items[0], it) {
+		t.h.items[0] = it
+		heap.Fix(&t.h, 0)
+	}
+}
+
+// Items returns the top items, best first. There are less than k if less
+// than k were pushed.
+func (t *Heap) Items() []Item {
+	items := append([]Item(nil), t.h.items...)
+	sortItems(items)
+	return items
+}
+
+// Top returns the k most common keys in counts
+func Top(counts map[string]int64, k int) []Item {
+	t := NewHeap(k)
+	for key, n := range counts {
+		t.Push(key, n)
+	}
+	return t.Items()
+}
+
+// Sketch is an approximate top-k counter
+type Sketch interface {
+	// Add adds n to the count of key
+	Add(key string, n int64)
+	// Top returns the k keys with the highest counts, best first
+	Top(k int) []Item
+	// Merge adds the counts of another sketch of the same type and size
+	Merge(o Sketch) error
+}
@@ -0,0 +1,228 @@
+package topk
+
+import (
+	"math"
+	"math/rand"
+	"reflect"
+	"strconv"
+	"testing"
+)
+
+// zipfStream returns n keys with Zipf frequencies, like words in a text, and
+// the exact counts
+func zipfStream(n int, seed int64) ([]string, map[string]int64) {
+	rnd := rand.New(rand.NewSource(seed))
+	z := rand.NewZipf(rnd, 1.2, 1, 100000)
+	keys := make([]string, n)
+	counts := make(map[string]int64)
+	for i := range keys {
+		keys[i] = "k" + strconv.FormatUint(z.Uint64(), 10)
+		counts[keys[i]]++
+	}
+	return keys, counts
+}
+
+func TestHeap(t *testing.T) {
+	counts := map[string]int64{"a": 5, "b": 3, "c": 5, "d": 1, "e": 4}
+	want := []Item{
+		{Key: "a", Count: 5, Score: 5},
+		{Key: "c", Count: 5, Score: 5},
+		{Key: "e", Count: 4, Score: 4},
+	}
+	if got := Top(counts, 3); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	if got := Top(counts, 10); len(got) != 5 {
+		t.Errorf("asked for 10 of 5 keys, got %d", len(got))
+	}
+	if got := Top(counts, 0); len(got) != 0 {
+		t.Errorf("asked for 0, got %v", got)
+	}
+
+	h := NewHeap(2)
+	h.PushScore("x", 1, 10)
+	h.PushScore("y", 100, 1)
+	h.PushScore("z", 5, 5)
+	if got := h.Items(); got[0].Key != "x" || got[1].Key != "z" {
+		t.Errorf("by score: got %v", got)
+	}
+}
+
+// checkBounds checks the guarantees of a sketch: counts are never too low and
+// are at most maxErr too high, and every key with more than maxErr is found
+func checkBounds(t *testing.T, name string, top []Item, exact map[string]int64, maxErr int64) {
+	t.Helper()
+	for _, it := range top {
+		n := exact[it.Key]
+		if it.Count < n || it.Count > n+maxErr {
+			t.Errorf("%s: %s counted %d, exact %d, max error %d", name, it.Key, it.Count, n, maxErr)
+		}
+		if it.Count-it.Error > n {
+			t.Errorf("%s: %s guaranteed %d, exact %d", name, it.Key, it.Count-it.Error, n)
+		}
+	}
+
+	found := make(map[string]bool)
+	for _, it := range top {
+		found[it.Key] = true
+	}
+	for key, n := range exact {
+		if n > maxErr && !found[key] {
+			t.Errorf("%s: %s with %d is missing", name, key, n)
+		}
+	}
+}
+
+func TestSpaceSaving(t *testing.T) {
+	const size = 200
+	keys, exact := zipfStream(100000, 1)
+	s := NewSpaceSaving(size)
+	for _, k := range keys {
+		s.Add(k, 1)
+	}
+	checkBounds(t, "space saving", s.Top(size), exact, int64(len(keys)/size))
+
+	// Top ranks by the guaranteed count
+	top := s.Top(size)
+	for i := 1; i < len(top); i++ {
+		if top[i-1].Count-top[i-1].Error < top[i].Count-top[i].Error {
+			t.Fatalf("%v ranks above %v", top[i-1], top[i])
+		}
+	}
+}
+
+// A key that takes over a big counter late must not rank first
+func TestSpaceSavingGuaranteed(t *testing.T) {
+	s := NewSpaceSaving(2)
+	s.Add("a", 10)
+	s.Add("b", 8)
+	s.Add("c", 1) // takes over b: count 9, error 8
+	top := s.Top(2)
+	if top[0].Key != "a" || top[1].Key != "c" || top[1].Count != 9 || top[1].Error != 8 {
+		t.Errorf("got %v", top)
+	}
+
+	s.Add("d", 2) // takes over c: count 11, error 9
+	if top := s.Top(1); top[0].Key != "a" {
+		t.Errorf("got %v, want a first", top)
+	}
+}
+
+func TestSpaceSavingMerge(t *testing.T) {
+	const size = 200
+	keys1, exact := zipfStream(50000, 1)
+	keys2, exact2 := zipfStream(50000, 2)
+	for k, n := range exact2 {
+		exact[k] += n
+	}
+
+	s1, s2 := NewSpaceSaving(size), NewSpaceSaving(size)
+	for _, k := range keys1 {
+		s1.Add(k, 1)
+	}
+	for _, k := range keys2 {
+		s2.Add(k, 1)
+	}
+	if err := s1.Merge(s2); err != nil {
+		t.Fatal(err)
+	}
+	checkBounds(t, "merged space saving", s1.Top(size), exact, int64((len(keys1)+len(keys2))/size))
+
+	if err := s1.Merge(NewSpaceSaving(size + 1)); err == nil {
+		t.Error("merged counters of different sizes")
+	}
+	if err := s1.Merge(NewCountMin(10, 2, 5)); err == nil {
+		t.Error("merged a count-min sketch")
+	}
+}
+
+func TestCountMin(t *testing.T) {
+	const width, k = 2000, 20
+	keys, exact := zipfStream(100000, 1)
+	half := len(keys) / 2
+	c1, c2 := NewCountMin(width, 4, k), NewCountMin(width, 4, k)
+	for _, key := range keys[:half] {
+		c1.Add(key, 1)
+	}
+	for _, key := range keys[half:] {
+		c2.Add(key, 1)
+	}
+	if err := c1.Merge(c2); err != nil {
+		t.Fatal(err)
+	}
+
+	// Estimates are never too low, and with probability 1 - e^-4 at most
+	// e*N/width too high
+	maxErr := int64(2.72 * float64(len(keys)) / width)
+	for key, n := range exact {
+		if est := c1.Count(key); est < n {
+			t.Fatalf("%s: estimate %d, exact %d", key, est, n)
+		}
+	}
+
+	exactTop := Top(exact, k)
+	got := c1.Top(k)
+	if len(got) != k {
+		t.Fatalf("got %d items, want %d", len(got), k)
+	}
+	found := make(map[string]bool)
+	for _, it := range got {
+		found[it.Key] = true
+		if n := exact[it.Key]; it.Count > n+maxErr {
+			t.Errorf("%s: estimate %d, exact %d", it.Key, it.Count, n)
+		}
+	}
+	// The clear heavy hitters are found
+	for _, it := range exactTop[:k/2] {
+		if !found[it.Key] {
+			t.Errorf("%s with %d is missing", it.Key, it.Count)
+		}
+	}
+
+	if err := c1.Merge(NewCountMin(width+1, 4, k)); err == nil {
+		t.Error("merged sketches of different widths")
+	}
+}
+
+// Count-min estimates are approximate, Top flags them with the e*N/width
+// bound
+func TestCountMinError(t *testing.T) {
+	// Everything collides in a single counter
+	c := NewCountMin(1, 1, 2)
+	c.Add("a", 3)
+	c.Add("b", 1)
+	for _, it := range c.Top(2) {
+		if it.Error != it.Count {
+			t.Errorf("width 1: got %+v, want the count as error", it)
+		}
+	}
+
+	const width = 100
+	keys, exact := zipfStream(10000, 1)
+	c = NewCountMin(width, 4, 10)
+	for _, key := range keys {
+		c.Add(key, 1)
+	}
+	maxErr := int64(math.Ceil(math.E * float64(len(keys)) / width))
+	for _, it := range c.Top(10) {
+		if it.Error <= 0 || it.Error > maxErr || it.Error > it.Count {
+			t.Errorf("%s: error %d, want 1-%d and at most the count %d", it.Key, it.Error, maxErr, it.Count)
+		}
+		if n := exact[it.Key]; it.Count-it.Error > n {
+			t.Errorf("%s: estimate %d-%d, exact %d", it.Key, it.Count, it.Error, n)
+		}
+	}
+
+	// Merged sketches have the bound of the total
+	c2 := NewCountMin(width, 4, 10)
+	for _, key := range keys {
+		c2.Add(key, 1)
+	}
+	if err := c.Merge(c2); err != nil {
+		t.Fatal(err)
+	}
+	maxErr = int64(math.Ceil(math.E * float64(2*len(keys)) / width))
+	if it := c.Top(1)[0]; it.Error != maxErr {
+		t.Errorf("merged: error %d, want %d", it.Error, maxErr)
+	}
+}
@@ -0,0 +1,524 @@
+// Package trip parses NYC yellow taxi trip records, the taxi-*.csv files
+// checked by the taxi tool.
+//
+// The files have a header line followed by a blank line, then one trip per
+// line:
+//
+//	VendorID,tpep_pickup_datetime,tpep_dropoff_datetime,passenger_count,...
+//
+//	1,2018-05-01 00:13:56,2018-05-01 00:22:46,1,1.60,1,N,230,50,1,8,0.5,0.5,1.85,0,0.3,11.15
+//
+// The header is optional (taxi-02.csv and on are parts of the same data set
+// and don't have one), without it the columns are in the Columns order.
+//
+// Reader streams trips, it doesn't load the file to memory. A bad row is
+// reported as a *ParseError and reading can go on with the next row.
+package trip
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"day1/decompress"
+)
+
+// TimeLayout is the layout of pickup and dropoff times
+const TimeLayout = "2006-01-02 15:04:05"
+
+// Cents is an amount of money in cents
+type Cents int64
+
+func (c Cents) String() string {
+	sign := ""
+	if c < 0 {
+		sign, c = "-", -c
+	}
+	return fmt.Sprintf("%s%d.%02d", sign, c/100, c%100)
+}
+
+// Dollars returns c in dollars
+func (c Cents) Dollars() float64 {
+	return float64(c) / 100
+}
+
+// ParseCents parses a dollar amount (e.g. "11.15", "-0.5", "8"), sub cent
+// digits are rounded half away from zero
+func ParseCents(s string) (Cents, error) {
+	neg := false
+	num := s
+	switch {
+	case strings.HasPrefix(num, "-"):
+		neg, num = true, num[1:]
+	case strings.HasPrefix(num, "+"):
+		num = num[1:]
+	}
+
+	whole, frac, _ := strings.Cut(num, ".")
+	if whole == "" && frac == "" {
+		return 0, fmt.Errorf("bad amount: %q", s)
+	}
+
+	var c int64
+	for _, r := range whole {
+		if r < '0' || r > '9' {
+			return 0, fmt.Errorf("bad amount: %q", s)
+		}
+		c = c*10 + int64(r-'0')
+		if c > 1<<53 {
+			return 0, fmt.Errorf("amount out of range: %q", s)
+		}
+	}
+	c *= 100
+
+	for i, r := range frac {
+		if r < '0' || r > '9' {
+			return 0, fmt.Errorf("bad amount: %q", s)
+		}
+		d := int64(r - '0')
+		switch {
+		case i == 0:
+			c += d * 10
+		case i == 1:
+			c += d
+		case i == 2 && d >= 5:
+			c++
+		}
+	}
+
+	if neg {
+		c = -c
+	}
+	return Cents(c), nil
+}
+
+// Vendor is the provider that sent the record
+type Vendor uint8
+
+const (
+	CreativeMobile Vendor = 1
+	VeriFone       Vendor = 2
+)
+
+func (v Vendor) String() string {
+	switch v {
+	case CreativeMobile:
+		return "Creative Mobile Technologies"
+	case VeriFone:
+		return "VeriFone"
+	}
+	return fmt.Sprintf("Vendor(%d)", v)
+}
+
+// PaymentType is how the passenger paid
+type PaymentType uint8
+
+const (
+	CreditCard PaymentType = 1
+	Cash       PaymentType = 2
+	NoCharge   PaymentType = 3
+	Dispute    PaymentType = 4
+	Unknown    PaymentType = 5
+	Voided     PaymentType = 6
+)
+
+var paymentNames = map[PaymentType]string{
+	CreditCard: "credit card",
+	Cash:       "cash",
+	NoCharge:   "no charge",
+	Dispute:    "dispute",
+	Unknown:    "unknown",
+	Voided:     "voided",
+}
+
+func (p PaymentType) String() string {
+	if name, ok := paymentNames[p]; ok {
+		return name
+	}
+	return fmt.Sprintf("PaymentType(%d)", p)
+}
+
+// Valid returns true if p is a code from the data dictionary
+func (p PaymentType) Valid() bool {
+	_, ok := paymentNames[p]
+	return ok
+}
+
+// RateCode is the rate in effect at the end of the trip
+type RateCode uint8
+
+const (
+	StandardRate      RateCode = 1
+	JFK               RateCode = 2
+	Newark            RateCode = 3
+	NassauWestchester RateCode = 4
+	NegotiatedFare    RateCode = 5
+	GroupRide         RateCode = 6
+)
+
+var rateNames = map[RateCode]string{
+	StandardRate:      "standard",
+	JFK:               "JFK",
+	Newark:            "Newark",
+	NassauWestchester: "Nassau or Westchester",
+	NegotiatedFare:    "negotiated fare",
+	GroupRide:         "group ride",
+}
+
+func (r RateCode) String() string {
+	if name, ok := rateNames[r]; ok {
+		return name
+	}
+	return fmt.Sprintf("RateCode(%d)", r)
+}
+
+// Valid returns true if r is a code from the data dictionary
+func (r RateCode) Valid() bool {
+	_, ok := rateNames[r]
+	return ok
+}
+
+// Trip is a single trip record. Times are local New York time (the files
+// don't have a time zone), in the Reader Location.
+type Trip struct {
+	Vendor          Vendor
+	Pickup          time.Time
+	Dropoff         time.Time
+	Passengers      int
+	Distance        float64 // miles
+	RateCode        RateCode
+	StoreAndForward bool // record was held in the vehicle before sending
+	PickupLocation  int  // TLC taxi zone
+	DropoffLocation int  // TLC taxi zone
+	PaymentType     PaymentType
+
+	Fare                 Cents
+	Extra                Cents
+	MTATax               Cents
+	Tip                  Cents // credit card tips only, cash tips aren't recorded
+	Tolls                Cents
+	ImprovementSurcharge Cents
+	Total                Cents // doesn't include cash tips
+}
+
+// Duration returns the trip duration
+func (t *Trip) Duration() time.Duration {
+	return t.Dropoff.Sub(t.Pickup)
+}
+
+// Column names in the header
+const (
+	colVendor          = "VendorID"
+	colPickup          = "tpep_pickup_datetime"
+	colDropoff         = "tpep_dropoff_datetime"
+	colPassengers      = "passenger_count"
+	colDistance        = "trip_distance"
+	colRateCode        = "RatecodeID"
+	colStoreAndForward = "store_and_fwd_flag"
+	colPickupLocation  = "PULocationID"
+	colDropoffLocation = "DOLocationID"
+	colPaymentType     = "payment_type"
+	colFare            = "fare_amount"
+	colExtra           = "extra"
+	colMTATax          = "mta_tax"
+	colTip             = "tip_amount"
+	colTolls           = "tolls_amount"
+	colImprovement     = "improvement_surcharge"
+	colTotal           = "total_amount"
+)
+
+// Columns are the columns a trip file must have. With a header they can be in
+// any order.
+var Columns = []string{
+	colVendor, colPickup, colDropoff, colPassengers, colDistance, colRateCode,
+	colStoreAndForward, colPickupLocation, colDropoffLocation, colPaymentType,
+	colFare, colExtra, colMTATax, colTip, colTolls, colImprovement, colTotal,
+}
+
+// ParseError is a bad row (or header)
+type ParseError struct {
+	File   string // "" if unknown
+	Line   int
+	Column string // "" if the whole row is bad
+	Err    error
+}
+
+func (e *ParseError) Error() string {
+	var b strings.Builder
+	if e.File != "" {
+		fmt.Fprintf(&b, "%s:", e.File)
+	}
+	fmt.Fprintf(&b, "%d: ", e.Line)
+	if e.Column != "" {
+		fmt.Fprintf(&b, "%s: ", e.Column)
+	}
+	b.WriteString(e.Err.Error())
+	return b.String()
+}
+
+func (e *ParseError) Unwrap() error {
+	return e.Err
+}
+
+var (
+	// ErrFieldCount is a row with the wrong number of fields
+	ErrFieldCount = errors.New("wrong number of fields")
+	// ErrHeader is a header with missing columns, the file can't be read
+	ErrHeader = errors.New("bad header")
+)
+
+// Reader reads trips from a CSV stream
+type Reader struct {
+	File     string         // used in errors
+	Location *time.Location // of pickup & dropoff times, default is UTC
+
+	csv       *csv.Reader
+	closer    io.Closer
+	cols      map[string]int // column name -> index
+	header    bool           // header was read
+	headerErr error
+	pending   []string // first row of a file without a header
+	record    []string // last record
+	line      int      // line of the last record
+}
+
+// NewReader returns a reader for the trips in r, file is used in errors
+func NewReader(r io.Reader, file string) *Reader {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1 // we check it, blank lines may have a single field
+	cr.ReuseRecord = true
+	return &Reader{File: file, csv: cr}
+}
+
+// Open opens a trip file, it can be compressed (e.g. taxi-01.csv.bz2)
+func Open(path string) (*Reader, error) {
+	rc, err := decompress.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	r := NewReader(rc, path)
+	r.closer = rc
+	return r, nil
+}
+
+// Close closes the file if the reader was created with Open
+func (r *Reader) Close() error {
+	if r.closer == nil {
+		return nil
+	}
+	return r.closer.Close()
+}
+
+// Line returns the line number of the last row read
+func (r *Reader) Line() int {
+	return r.line
+}
+
+// Record returns the fields of the last row read (nil if it had a CSV syntax
+// error), it's valid until the next call to Read
+func (r *Reader) Record() []string {
+	return r.record
+}
+
+// Read returns the next trip, io.EOF at the end. A bad row returns a
+// *ParseError, call Read again to continue with the next row. Other errors
+// (including ErrHeader) are final.
+func (r *Reader) Read() (Trip, error) {
+	if r.headerErr != nil {
+		return Trip{}, r.headerErr
+	}
+	if !r.header {
+		if err := r.readHeader(); err != nil {
+			return Trip{}, err
+		}
+	}
+
+	r.record = nil
+	record := r.pending
+	r.pending = nil
+	if record == nil {
+		var err error
+		if record, err = r.next(); err != nil {
+			return Trip{}, err
+		}
+	}
+	r.record = record
+	if len(record) != len(r.cols) {
+		return Trip{}, r.errorf("", "%w: %d instead of %d", ErrFieldCount, len(record), len(r.cols))
+	}
+	return r.parse(record)
+}
+
+// next returns the next non blank record
+func (r *Reader) next() ([]string, error) {
+	for {
+		record, err := r.csv.Read()
+		if err != nil {
+			var pe *csv.ParseError
+			if errors.As(err, &pe) {
+				r.line = pe.Line
+				return nil, &ParseError{File: r.File, Line: pe.Line, Err: pe.Err}
+			}
+			return nil, err
+		}
+		r.line, _ = r.csv.FieldPos(0)
+
+		// The line after the header is "\r\n", csv skips truly empty lines
+		if len(record) == 1 && strings.TrimSpace(record[0]) == "" {
+			continue
+		}
+		return record, nil
+	}
+}
+
+// readHeader reads the header, if the first row isn't a header it's kept in
+// pending and the columns are in the default order
+func (r *Reader) readHeader() error {
+	record, err := r.next()
+	if err != nil {
+		return err
+	}
+
+	cols := make(map[string]int)
+	known := 0
+	for i, name := range record {
+		name = strings.TrimPrefix(strings.TrimSpace(name), "\ufeff") // BOM
+		cols[name] = i
+	}
+	for _, name := range Columns {
+		if _, ok := cols[name]; ok {
+			known++
+		}
+	}
+
+	switch known {
+	case len(Columns):
+		r.cols = cols
+	case 0:
+		r.cols = make(map[string]int)
+		for i, name := range Columns {
+			r.cols[name] = i
+		}
+		r.pending = append([]string(nil), record...) // csv reuses record
+	default:
+		for _, name := range Columns {
+			if _, ok := cols[name]; !ok {
+				// Not a *ParseError, callers would try the next row
+				r.headerErr = fmt.Errorf("%s:%d: %w: missing column %q", r.File, r.line, ErrHeader, name)
+				return r.headerErr
+			}
+		}
+	}
+	r.header = true
+	return nil
+}
+
+func (r *Reader) errorf(column, format string, args ...any) *ParseError {
+	return &ParseError{File: r.File, Line: r.line, Column: column, Err: fmt.Errorf(format, args...)}
+}
+
+// parse converts a record to a Trip, the first bad field is reported
+func (r *Reader) parse(record []string) (Trip, error) {
+	p := fieldParser{r: r, record: record}
+	loc := r.Location
+	if loc == nil {
+		loc = time.UTC
+	}
+
+	t := Trip{
+		Vendor:          Vendor(p.uint8(colVendor)),
+		Pickup:          p.time(colPickup, loc),
+		Dropoff:         p.time(colDropoff, loc),
+		Passengers:      p.int(colPassengers),
+		Distance:        p.float(colDistance),
+		RateCode:        RateCode(p.uint8(colRateCode)),
+		StoreAndForward: p.flag(colStoreAndForward),
+		PickupLocation:  p.int(colPickupLocation),
+		DropoffLocation: p.int(colDropoffLocation),
+		PaymentType:     PaymentType(p.uint8(colPaymentType)),
+
+		Fare:                 p.cents(colFare),
+		Extra:                p.cents(colExtra),
+		MTATax:               p.cents(colMTATax),
+		Tip:                  p.cents(colTip),
+		Tolls:                p.cents(colTolls),
+		ImprovementSurcharge: p.cents(colImprovement),
+		Total:                p.cents(colTotal),
+	}
+	if p.err != nil {
+		return Trip{}, p.err
+	}
+	return t, nil
+}
+
+// fieldParser parses fields of a record, keeping the first error
+type fieldParser struct {
+	r      *Reader
+	record []string
+	err    *ParseError
+}
+
+func (p *fieldParser) field(col string) string {
+	return strings.TrimSpace(p.record[p.r.cols[col]])
+}
+
+func (p *fieldParser) fail(col string, err error) {
+	if p.err == nil {
+		p.err = p.r.errorf(col, "%w", err)
+	}
+}
+
+func (p *fieldParser) int(col string) int {
+	n, err := strconv.Atoi(p.field(col))
+	if err != nil {
+		p.fail(col, err)
+	}
+	return n
+}
+
+func (p *fieldParser) uint8(col string) uint8 {
+	n, err := strconv.ParseUint(p.field(col), 10, 8)
+	if err != nil {
+		p.fail(col, err)
+	}
+	return uint8(n)
+}
+
+func (p *fieldParser) float(col string) float64 {
+	f, err := strconv.ParseFloat(p.field(col), 64)
+	if err != nil {
+		p.fail(col, err)
+	}
+	return f
+}
+
+func (p *fieldParser) cents(col string) Cents {
+	c, err := ParseCents(p.field(col))
+	if err != nil {
+		p.fail(col, err)
+	}
+	return c
+}
+
+func (p *fieldParser) time(col string, loc *time.Location) time.Time {
+	t, err := time.ParseInLocation(TimeLayout, p.field(col), loc)
+	if err != nil {
+		p.fail(col, err)
+	}
+	return t
+}
+
+func (p *fieldParser) flag(col string) bool {
+	switch p.field(col) {
+	case "Y":
+		return true
+	case "N", "":
+		return false
+	}
+	p.fail(col, fmt.Errorf("bad flag: %q", p.field(col)))
+	return false
+}
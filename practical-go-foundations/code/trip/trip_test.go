@@ -0,0 +1,181 @@
+package trip
+
+import (
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"time"
+)
+
+const (
+	header = "VendorID,tpep_pickup_datetime,tpep_dropoff_datetime,passenger_count,trip_distance,RatecodeID,store_and_fwd_flag,PULocationID,DOLocationID,payment_type,fare_amount,extra,mta_tax,tip_amount,tolls_amount,improvement_surcharge,total_amount"
+	row    = "1,2018-05-01 00:13:56,2018-05-01 00:22:46,1,1.60,1,N,230,50,1,8,0.5,0.5,1.85,0,0.3,11.15"
+)
+
+func TestParseCents(t *testing.T) {
+	cases := map[string]Cents{
+		"11.15":  1115,
+		"8":      800,
+		"0.5":    50,
+		".5":     50,
+		"-0.5":   -50,
+		"+3.01":  301,
+		"1.005":  101,
+		"1.0049": 100,
+		"-1.005": -101,
+		"0":      0,
+	}
+	for s, want := range cases {
+		if got, err := ParseCents(s); err != nil || got != want {
+			t.Errorf("ParseCents(%q) = %d, %v; want %d", s, got, err, want)
+		}
+	}
+	for _, s := range []string{"", "-", ".", "1.2.3", "abc", "1e3", "99999999999999999999"} {
+		if _, err := ParseCents(s); err == nil {
+			t.Errorf("ParseCents(%q): no error", s)
+		}
+	}
+}
+
+func TestCentsString(t *testing.T) {
+	cases := map[Cents]string{1115: "11.15", 800: "8.00", 5: "0.05", -50: "-0.50", 0: "0.00"}
+	for c, want := range cases {
+		if got := c.String(); got != want {
+			t.Errorf("Cents(%d) = %q, want %q", int64(c), got, want)
+		}
+	}
+}
+
+func TestRead(t *testing.T) {
+	r := NewReader(strings.NewReader(header+"\r\n\r\n"+row+"\r\n"), "taxi-01.csv")
+	tr, err := r.Read()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := Trip{
+		Vendor:               1,
+		Pickup:               time.Date(2018, 5, 1, 0, 13, 56, 0, time.UTC),
+		Dropoff:              time.Date(2018, 5, 1, 0, 22, 46, 0, time.UTC),
+		Passengers:           1,
+		Distance:             1.6,
+		RateCode:             1,
+		PickupLocation:       230,
+		DropoffLocation:      50,
+		PaymentType:          1,
+		Fare:                 800,
+		Extra:                50,
+		MTATax:               50,
+		Tip:                  185,
+		ImprovementSurcharge: 30,
+		Total:                1115,
+	}
+	if tr != want {
+		t.Errorf("got %+v\nwant %+v", tr, want)
+	}
+	if d := tr.Duration(); d != 8*time.Minute+50*time.Second {
+		t.Errorf("duration %v", d)
+	}
+	if r.Line() != 3 {
+		t.Errorf("line %d, want 3", r.Line())
+	}
+
+	if _, err := r.Read(); err != io.EOF {
+		t.Errorf("got %v, want io.EOF", err)
+	}
+}
+
+func TestReadNoHeader(t *testing.T) {
+	r := NewReader(strings.NewReader(row+"\n"+row+"\n"), "taxi-02.csv")
+	n := 0
+	for {
+		_, err := r.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		n++
+	}
+	if n != 2 {
+		t.Errorf("read %d trips, want 2", n)
+	}
+}
+
+func TestReadReordered(t *testing.T) {
+	// Columns in another order, found by name
+	cols := strings.Split(header, ",")
+	vals := strings.Split(row, ",")
+	cols[0], cols[16] = cols[16], cols[0]
+	vals[0], vals[16] = vals[16], vals[0]
+
+	r := NewReader(strings.NewReader(strings.Join(cols, ",")+"\n"+strings.Join(vals, ",")+"\n"), "")
+	tr, err := r.Read()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tr.Vendor != 1 || tr.Total != 1115 {
+		t.Errorf("vendor %d, total %s", tr.Vendor, tr.Total)
+	}
+}
+
+func TestReadBadRows(t *testing.T) {
+	bad := strings.Replace(row, "11.15", "x", 1)
+	short := "1,2,3"
+	r := NewReader(strings.NewReader(header+"\n"+bad+"\n"+short+"\n"+row+"\n"), "f.csv")
+
+	_, err := r.Read()
+	var pe *ParseError
+	if !errors.As(err, &pe) || pe.Line != 2 || pe.Column != "total_amount" {
+		t.Fatalf("got %v, want a total_amount error on line 2", err)
+	}
+	if !strings.HasPrefix(err.Error(), "f.csv:2: total_amount: ") {
+		t.Errorf("error message: %s", err)
+	}
+	if got := strings.Join(r.Record(), ","); got != bad {
+		t.Errorf("record %q, want %q", got, bad)
+	}
+
+	_, err = r.Read()
+	if !errors.Is(err, ErrFieldCount) {
+		t.Fatalf("got %v, want ErrFieldCount", err)
+	}
+
+	// Reading goes on after bad rows
+	if _, err := r.Read(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestReadBadHeader(t *testing.T) {
+	h := strings.Replace(header, "tip_amount", "tip", 1)
+	r := NewReader(strings.NewReader(h+"\n"+row+"\n"), "f.csv")
+	for i := 0; i < 2; i++ {
+		_, err := r.Read()
+		if !errors.Is(err, ErrHeader) {
+			t.Fatalf("read %d: got %v, want ErrHeader", i, err)
+		}
+		var pe *ParseError
+		if errors.As(err, &pe) {
+			t.Fatalf("header error is a *ParseError, callers would go on")
+		}
+	}
+}
+
+func TestLocation(t *testing.T) {
+	ny, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Skip(err)
+	}
+	r := NewReader(strings.NewReader(row+"\n"), "")
+	r.Location = ny
+	tr, err := r.Read()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := time.Date(2018, 5, 1, 4, 13, 56, 0, time.UTC); !tr.Pickup.Equal(want) {
+		t.Errorf("pickup %v, want %v", tr.Pickup.UTC(), want)
+	}
+}
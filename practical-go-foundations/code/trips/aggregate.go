@@ -0,0 +1,423 @@
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"day1/internal/cli"
+	"day1/trip"
+)
+
+// aggregate parses the trip files and prints statistics grouped by hour of
+// day, day, pickup location or payment type. Files are parsed concurrently
+// (-j) and the partial results merged. Trips with implausible durations are
+// skipped, see durationRules.
+//
+//	go run ./trips aggregate -dir taxi/taxi-sha256 -by hour,payment
+//	go run ./trips aggregate -dir taxi/taxi-sha256 -by day -format csv
+
+var groupBy string // -by
+
+// grouping is a way to group trips, key must be sortable in output order
+type grouping struct {
+	name  string
+	key   func(t *trip.Trip) int64
+	label func(key int64) string
+}
+
+var groupings = []grouping{
+	{
+		name:  "hour",
+		key:   func(t *trip.Trip) int64 { return int64(t.Pickup.Hour()) },
+		label: func(key int64) string { return fmt.Sprintf("%02d", key) },
+	},
+	{
+		name: "day",
+		key: func(t *trip.Trip) int64 {
+			y, m, d := t.Pickup.Date()
+			return int64(y*10000 + int(m)*100 + d)
+		},
+		label: func(key int64) string {
+			return fmt.Sprintf("%04d-%02d-%02d", key/10000, key/100%100, key%100)
+		},
+	},
+	{
+		name:  "pickup",
+		key:   func(t *trip.Trip) int64 { return int64(t.PickupLocation) },
+		label: func(key int64) string { return strconv.FormatInt(key, 10) },
+	},
+	{
+		name:  "payment",
+		key:   func(t *trip.Trip) int64 { return int64(t.PaymentType) },
+		label: func(key int64) string { return trip.PaymentType(key).String() },
+	},
+}
+
+// rule is a data quality rule, check returns true for a violation
+type rule struct {
+	name  string
+	desc  string
+	check func(t *trip.Trip) bool
+}
+
+// maxDuration is the longest plausible trip, longer ones are meters left
+// running (taxi-02 has a dropoff in 1998)
+const maxDuration = 12 * time.Hour
+
+// durationRules are the validate rules for trips that would skew the
+// averages, aggregate skips them
+var durationRules = []rule{
+	{
+		name:  "dropoff_before_pickup",
+		desc:  "dropoff time is before pickup time",
+		check: func(t *trip.Trip) bool { return t.Dropoff.Before(t.Pickup) },
+	},
+	{
+		name:  "long_trip",
+		desc:  fmt.Sprintf("trip takes more than %.0f hours", maxDuration.Hours()),
+		check: func(t *trip.Trip) bool { return t.Duration() > maxDuration },
+	},
+}
+
+// parseGroupings parses -by
+func parseGroupings(s string) ([]grouping, error) {
+	var gs []grouping
+	for _, name := range strings.Split(s, ",") {
+		name = strings.TrimSpace(name)
+		found := false
+		for _, g := range groupings {
+			if g.name == name {
+				gs = append(gs, g)
+				found = true
+				break
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("unknown group: %q", name)
+		}
+	}
+	return gs, nil
+}
+
+// tripStats are the totals of a group of trips
+type tripStats struct {
+	Trips    int64
+	Fare     trip.Cents
+	Distance float64
+	Duration time.Duration
+
+	// Tips are recorded only for credit card trips, the tip percentage is
+	// computed from them
+	CardFare trip.Cents
+	CardTip  trip.Cents
+}
+
+func (s *tripStats) add(t *trip.Trip) {
+	s.Trips++
+	s.Fare += t.Fare
+	s.Distance += t.Distance
+	s.Duration += t.Duration()
+	if t.PaymentType == trip.CreditCard {
+		s.CardFare += t.Fare
+		s.CardTip += t.Tip
+	}
+}
+
+func (s *tripStats) merge(o *tripStats) {
+	s.Trips += o.Trips
+	s.Fare += o.Fare
+	s.Distance += o.Distance
+	s.Duration += o.Duration
+	s.CardFare += o.CardFare
+	s.CardTip += o.CardTip
+}
+
+// groupStats is the stats of a grouping, by key
+type groupStats map[int64]*tripStats
+
+func (g groupStats) add(key int64, t *trip.Trip) {
+	s, ok := g[key]
+	if !ok {
+		s = &tripStats{}
+		g[key] = s
+	}
+	s.add(t)
+}
+
+func (g groupStats) merge(o groupStats) {
+	for key, os := range o {
+		s, ok := g[key]
+		if !ok {
+			s = &tripStats{}
+			g[key] = s
+		}
+		s.merge(os)
+	}
+}
+
+// fileStats is the result of aggregating one file
+type fileStats struct {
+	path    string
+	trips   int64
+	badRows int
+	skipped []int        // trips violating durationRules, same order
+	groups  []groupStats // same order as the groupings
+	err     error
+}
+
+// aggregateFile parses path and computes the stats of each grouping
+func aggregateFile(ctx context.Context, path string, gs []grouping) fileStats {
+	fs := fileStats{path: path, skipped: make([]int, len(durationRules)), groups: make([]groupStats, len(gs))}
+	for i := range fs.groups {
+		fs.groups[i] = make(groupStats)
+	}
+
+	r, err := trip.Open(path)
+	if err != nil {
+		fs.err = err
+		return fs
+	}
+	defer r.Close()
+
+	for {
+		// Checking ctx on every row is slow
+		if fs.trips%1024 == 0 && ctx.Err() != nil {
+			fs.err = ctx.Err()
+			return fs
+		}
+
+		t, err := r.Read()
+		if err == io.EOF {
+			return fs
+		}
+		var pe *trip.ParseError
+		if errors.As(err, &pe) {
+			fs.badRows++
+			if warn {
+				fmt.Fprintf(os.Stderr, "%s: %s\n", prog, pe)
+			}
+			continue
+		}
+		if err != nil {
+			fs.err = err
+			return fs
+		}
+
+		if i := violation(&t); i >= 0 {
+			fs.skipped[i]++
+			continue
+		}
+		fs.trips++
+		for i, g := range gs {
+			fs.groups[i].add(g.key(&t), &t)
+		}
+	}
+}
+
+// violation returns the index of the first durationRule t violates, -1 if
+// none
+func violation(t *trip.Trip) int {
+	for i, r := range durationRules {
+		if r.check(t) {
+			return i
+		}
+	}
+	return -1
+}
+
+// aggRow is a row in the output
+type aggRow struct {
+	Group       string  `json:"group"`
+	Key         string  `json:"key"`
+	Trips       int64   `json:"trips"`
+	TotalFare   float64 `json:"total_fare"`
+	AvgFare     float64 `json:"avg_fare"`
+	TipPct      float64 `json:"tip_pct"`      // of credit card fares
+	AvgDistance float64 `json:"avg_distance"` // miles
+	AvgDuration float64 `json:"avg_duration_s"`
+}
+
+func newAggRow(g grouping, key int64, s *tripStats) aggRow {
+	row := aggRow{
+		Group:     g.name,
+		Key:       g.label(key),
+		Trips:     s.Trips,
+		TotalFare: s.Fare.Dollars(),
+	}
+	if s.Trips > 0 {
+		n := float64(s.Trips)
+		row.AvgFare = s.Fare.Dollars() / n
+		row.AvgDistance = s.Distance / n
+		row.AvgDuration = s.Duration.Seconds() / n
+	}
+	if s.CardFare != 0 {
+		row.TipPct = 100 * float64(s.CardTip) / float64(s.CardFare)
+	}
+	return row
+}
+
+// aggregate is the aggregate command
+func aggregate(ctx context.Context) int {
+	gs, err := parseGroupings(groupBy)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %s\n", prog, err)
+		return 1
+	}
+	switch format {
+	case "text", "csv", "json":
+	default:
+		fmt.Fprintf(os.Stderr, "%s: unknown aggregate format: %q\n", prog, format)
+		return 1
+	}
+
+	files, err := tripFiles()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %s\n", prog, err)
+		return 1
+	}
+
+	start := time.Now()
+	results := make([]fileStats, len(files))
+	forEachFile(files, func(i int, path string) {
+		results[i] = aggregateFile(ctx, path, gs)
+	})
+
+	if ctx.Err() != nil {
+		fmt.Fprintf(os.Stderr, "%s: interrupted\n", prog)
+		return 130
+	}
+
+	code := 0
+	total := make([]groupStats, len(gs))
+	for i := range total {
+		total[i] = make(groupStats)
+	}
+	var trips int64
+	badRows := 0
+	skipped := make([]int, len(durationRules))
+	for _, fs := range results {
+		if fs.err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %s\n", prog, fs.err)
+			code = 1
+			continue
+		}
+		trips += fs.trips
+		badRows += fs.badRows
+		for i, n := range fs.skipped {
+			skipped[i] += n
+		}
+		for i := range gs {
+			total[i].merge(fs.groups[i])
+		}
+	}
+
+	rows := make([][]aggRow, len(gs))
+	for i, g := range gs {
+		keys := make([]int64, 0, len(total[i]))
+		for key := range total[i] {
+			keys = append(keys, key)
+		}
+		sort.Slice(keys, func(a, b int) bool { return keys[a] < keys[b] })
+		for _, key := range keys {
+			rows[i] = append(rows[i], newAggRow(g, key, total[i][key]))
+		}
+	}
+
+	switch format {
+	case "text":
+		err = printAggTable(os.Stdout, gs, rows)
+	case "csv":
+		err = printAggCSV(os.Stdout, rows)
+	case "json":
+		err = printAggJSON(os.Stdout, gs, rows, trips, badRows, skipped)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %s\n", prog, err)
+		return 1
+	}
+
+	if verbose {
+		fmt.Fprintf(os.Stderr, "%d trips in %d files in %v\n", trips, len(files), time.Since(start))
+	}
+	for i, n := range skipped {
+		if n > 0 {
+			fmt.Fprintf(os.Stderr, "%s: WARNING: %s skipped, %s\n", prog, cli.Plural(n, "trip", "trips"), durationRules[i].desc)
+		}
+	}
+	if badRows > 0 {
+		fmt.Fprintf(os.Stderr, "%s: WARNING: %s skipped\n", prog, cli.Plural(badRows, "bad row", "bad rows"))
+		if strict {
+			code = 1
+		}
+	}
+	return code
+}
+
+func printAggTable(w io.Writer, gs []grouping, rows [][]aggRow) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', tabwriter.AlignRight)
+	for i, g := range gs {
+		if i > 0 {
+			fmt.Fprintln(tw, "\t\t\t\t\t\t\t")
+		}
+		fmt.Fprintf(tw, "%s\ttrips\ttotal fare\tavg fare\ttip %%\tavg distance\tavg duration\t\n", g.name)
+		for _, r := range rows[i] {
+			d := time.Duration(r.AvgDuration * float64(time.Second)).Round(time.Second)
+			fmt.Fprintf(tw, "%s\t%d\t%.2f\t%.2f\t%.1f\t%.2f\t%v\t\n",
+				r.Key, r.Trips, r.TotalFare, r.AvgFare, r.TipPct, r.AvgDistance, d)
+		}
+	}
+	return tw.Flush()
+}
+
+func printAggCSV(w io.Writer, rows [][]aggRow) error {
+	cw := csv.NewWriter(w)
+	cw.Write([]string{"group", "key", "trips", "total_fare", "avg_fare", "tip_pct", "avg_distance", "avg_duration_s"})
+	for _, group := range rows {
+		for _, r := range group {
+			cw.Write([]string{
+				r.Group,
+				r.Key,
+				strconv.FormatInt(r.Trips, 10),
+				strconv.FormatFloat(r.TotalFare, 'f', 2, 64),
+				strconv.FormatFloat(r.AvgFare, 'f', 4, 64),
+				strconv.FormatFloat(r.TipPct, 'f', 4, 64),
+				strconv.FormatFloat(r.AvgDistance, 'f', 4, 64),
+				strconv.FormatFloat(r.AvgDuration, 'f', 1, 64),
+			})
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+func printAggJSON(w io.Writer, gs []grouping, rows [][]aggRow, trips int64, badRows int, skipped []int) error {
+	doc := struct {
+		Trips   int64               `json:"trips"`
+		BadRows int                 `json:"bad_rows"`
+		Skipped map[string]int      `json:"skipped"` // by rule
+		Groups  map[string][]aggRow `json:"groups"`
+	}{trips, badRows, make(map[string]int), make(map[string][]aggRow)}
+	for i, r := range durationRules {
+		doc.Skipped[r.name] = skipped[i]
+	}
+	for i, g := range gs {
+		doc.Groups[g.name] = rows[i]
+		if rows[i] == nil {
+			doc.Groups[g.name] = []aggRow{}
+		}
+	}
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(doc)
+}
@@ -0,0 +1,262 @@
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"day1/columnar"
+	"day1/internal/cli"
+	"day1/trip"
+)
+
+// convert writes the trip files in the columnar format (see the columnar
+// package), scan reads them back. Only the chunks of the -columns are read,
+// and blocks that can't match -where are skipped.
+//
+//	go run ./trips convert -dir taxi/taxi-sha256 -o /tmp/trips
+//	go run ./trips scan -file /tmp/trips/taxi-01.col -columns fare_amount,tip_amount -where fare_amount=50..100
+
+var (
+	outDir      string // convert -o
+	scanFile    string // scan -file
+	scanColumns string // scan -columns
+	wheres      whereList
+)
+
+// whereList is a flag that can be repeated, -where fare_amount=10..20
+type whereList []string
+
+func (w *whereList) String() string {
+	return strings.Join(*w, ",")
+}
+
+// Set only keeps s, it's parsed by scan so a bad value doesn't print the usage
+func (w *whereList) Set(s string) error {
+	*w = append(*w, s)
+	return nil
+}
+
+// parseWhere parses column=min..max, values are as in the CSV files. A date
+// as max of a time column includes the whole day.
+func parseWhere(s string) (columnar.Range, error) {
+	name, bounds, ok := strings.Cut(s, "=")
+	lo, hi, ok2 := strings.Cut(bounds, "..")
+	if !ok || !ok2 {
+		return columnar.Range{}, fmt.Errorf("bad range %q, should be column=min..max", s)
+	}
+	c := columnar.ColumnByName(name)
+	if c == nil {
+		return columnar.Range{}, fmt.Errorf("unknown column: %q", name)
+	}
+
+	rg := columnar.Range{Column: c, Min: -1 << 63, Max: 1<<63 - 1}
+	var err error
+	if lo != "" {
+		if rg.Min, err = c.Parse(lo); err != nil {
+			return columnar.Range{}, fmt.Errorf("%s: %w", s, err)
+		}
+	}
+	if hi != "" {
+		if rg.Max, err = c.Parse(hi); err != nil {
+			return columnar.Range{}, fmt.Errorf("%s: %w", s, err)
+		}
+		if c.Kind == columnar.Time && len(hi) == len(columnar.DateLayout) {
+			rg.Max += 24*60*60 - 1
+		}
+	}
+	return rg, nil
+}
+
+// convertFile converts a trip file to path, returns the number of rows and
+// bad rows
+func convertFile(ctx context.Context, src, dest string) (int64, int, error) {
+	r, err := trip.Open(src)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer r.Close()
+
+	var rows int64
+	bad := 0
+	err = cli.WriteFile(dest, func(out io.Writer) error {
+		w := columnar.NewWriter(out)
+		for {
+			if rows%1024 == 0 && ctx.Err() != nil {
+				return ctx.Err()
+			}
+
+			t, err := r.Read()
+			if err == io.EOF {
+				break
+			}
+			var pe *trip.ParseError
+			if errors.As(err, &pe) {
+				bad++
+				if warn {
+					fmt.Fprintf(os.Stderr, "%s: %s\n", prog, pe)
+				}
+				continue
+			}
+			if err != nil {
+				return err
+			}
+
+			if err := w.Write(&t); err != nil {
+				return err
+			}
+			rows++
+		}
+		return w.Close()
+	})
+	return rows, bad, err
+}
+
+// convert is the convert command
+func convert(ctx context.Context) int {
+	files, err := tripFiles()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %s\n", prog, err)
+		return 1
+	}
+
+	dests := make([]string, len(files))
+	for i, f := range files {
+		name := strings.TrimSuffix(cli.TrimCompressExt(f.name), ".csv") + ".col"
+		if outDir == "" {
+			dests[i] = filepath.Join(filepath.Dir(f.path), filepath.Base(name))
+		} else {
+			dests[i] = filepath.Join(outDir, filepath.FromSlash(name))
+		}
+		if err := os.MkdirAll(filepath.Dir(dests[i]), 0755); err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %s\n", prog, err)
+			return 1
+		}
+	}
+
+	errs := make([]error, len(files))
+	forEachFile(files, func(i int, path string) {
+		rows, bad, err := convertFile(ctx, path, dests[i])
+		errs[i] = err
+		if err != nil {
+			return
+		}
+		if bad > 0 {
+			fmt.Fprintf(os.Stderr, "%s: %s: WARNING: %s skipped\n", prog, path, cli.Plural(bad, "bad row", "bad rows"))
+		}
+		if verbose {
+			var src, dest int64
+			if info, err := os.Stat(path); err == nil {
+				src = info.Size()
+			}
+			if info, err := os.Stat(dests[i]); err == nil {
+				dest = info.Size()
+			}
+			fmt.Fprintf(os.Stderr, "%s -> %s: %d rows, %s -> %s\n", path, dests[i], rows, cli.Size(src), cli.Size(dest))
+		}
+	})
+
+	if ctx.Err() != nil {
+		fmt.Fprintf(os.Stderr, "%s: interrupted\n", prog)
+		return 130
+	}
+	code := 0
+	for _, err := range errs {
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %s\n", prog, err)
+			code = 1
+		}
+	}
+	return code
+}
+
+// scan prints the rows of a columnar file (-file) as CSV
+func scan(ctx context.Context) int {
+	if scanFile == "" {
+		fmt.Fprintf(os.Stderr, "%s: missing -file\n", prog)
+		return 1
+	}
+
+	cols := columnar.Columns
+	if scanColumns != "" {
+		cols = nil
+		for _, name := range strings.Split(scanColumns, ",") {
+			c := columnar.ColumnByName(strings.TrimSpace(name))
+			if c == nil {
+				fmt.Fprintf(os.Stderr, "%s: unknown column: %q\n", prog, name)
+				return 1
+			}
+			cols = append(cols, c)
+		}
+	}
+
+	var where []columnar.Range
+	load := append([]*columnar.Column(nil), cols...) // where columns are loaded too
+	for _, s := range wheres {
+		rg, err := parseWhere(s)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s: -where: %s\n", prog, err)
+			return 1
+		}
+		where = append(where, rg)
+		load = append(load, rg.Column)
+	}
+
+	r, err := columnar.Open(scanFile)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %s\n", prog, err)
+		return 1
+	}
+	defer r.Close()
+
+	w := csv.NewWriter(os.Stdout)
+	header := make([]string, len(cols))
+	for i, c := range cols {
+		header[i] = c.Name
+	}
+	w.Write(header)
+
+	var rows int64
+	stats, err := r.Scan(load, where, func(b *columnar.Batch) error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		record := make([]string, len(cols))
+	next:
+		for i := 0; i < b.Rows; i++ {
+			for _, rg := range where {
+				if !rg.Match(b.Values(rg.Column)[i]) {
+					continue next
+				}
+			}
+			for j, c := range cols {
+				record[j] = c.Format(b.Values(c)[i])
+			}
+			w.Write(record)
+			rows++
+		}
+		return w.Error()
+	})
+	w.Flush()
+	if err == nil {
+		err = w.Error()
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %s\n", prog, err)
+		if ctx.Err() != nil {
+			return 130
+		}
+		return 1
+	}
+
+	if verbose {
+		fmt.Fprintf(os.Stderr, "%d of %d rows, read %d blocks, skipped %d\n", rows, r.Rows(), stats.Read, stats.Skipped)
+	}
+	return 0
+}
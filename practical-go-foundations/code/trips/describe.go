@@ -0,0 +1,280 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"day1/internal/cli"
+	"day1/stats"
+	"day1/trip"
+)
+
+// describe prints summary statistics of the trip values: mean, standard
+// deviation and quantiles, and the number of distinct pickup/dropoff pairs.
+// Quantiles and distinct counts are approximate (see the stats package) so
+// memory doesn't grow with the number of trips.
+//
+//	go run ./trips describe -dir taxi/taxi-sha256
+//	go run ./trips describe -dir taxi/taxi-sha256 -quantiles 0.01,0.5,0.999 -format json
+
+var quantiles string // -quantiles
+
+// measure is a trip value we compute statistics on
+type measure struct {
+	name  string
+	value func(t *trip.Trip) float64
+}
+
+var measures = []measure{
+	{"fare_amount", func(t *trip.Trip) float64 { return t.Fare.Dollars() }},
+	{"tip_amount", func(t *trip.Trip) float64 { return t.Tip.Dollars() }},
+	{"total_amount", func(t *trip.Trip) float64 { return t.Total.Dollars() }},
+	{"trip_distance", func(t *trip.Trip) float64 { return t.Distance }},
+	{"duration_min", func(t *trip.Trip) float64 { return t.Duration().Minutes() }},
+	{"passenger_count", func(t *trip.Trip) float64 { return float64(t.Passengers) }},
+}
+
+// sketches are the statistics of a file (or several after merge)
+type sketches struct {
+	moments []stats.Moments // same order as measures
+	digests []*stats.Digest
+	pairs   *stats.HLL // pickup/dropoff location pairs
+	badRows int
+	err     error
+}
+
+func newSketches() *sketches {
+	s := &sketches{
+		moments: make([]stats.Moments, len(measures)),
+		digests: make([]*stats.Digest, len(measures)),
+	}
+	for i := range s.digests {
+		s.digests[i] = stats.NewDigest(0)
+	}
+	s.pairs, _ = stats.NewHLL(0) // default precision can't fail
+	return s
+}
+
+func (s *sketches) add(t *trip.Trip) {
+	for i, m := range measures {
+		v := m.value(t)
+		s.moments[i].Add(v)
+		s.digests[i].Add(v)
+	}
+	s.pairs.AddUint64(uint64(t.PickupLocation)<<32 | uint64(uint32(t.DropoffLocation)))
+}
+
+func (s *sketches) merge(o *sketches) {
+	for i := range measures {
+		s.moments[i].Merge(&o.moments[i])
+		s.digests[i].Merge(o.digests[i])
+	}
+	s.pairs.Merge(o.pairs) // same precision
+	s.badRows += o.badRows
+}
+
+// describeFile computes the sketches of path
+func describeFile(ctx context.Context, path string) *sketches {
+	s := newSketches()
+	r, err := trip.Open(path)
+	if err != nil {
+		s.err = err
+		return s
+	}
+	defer r.Close()
+
+	for n := 0; ; n++ {
+		if n%1024 == 0 && ctx.Err() != nil {
+			s.err = ctx.Err()
+			return s
+		}
+
+		t, err := r.Read()
+		if err == io.EOF {
+			return s
+		}
+		var pe *trip.ParseError
+		if errors.As(err, &pe) {
+			s.badRows++
+			if warn {
+				fmt.Fprintf(os.Stderr, "%s: %s\n", prog, pe)
+			}
+			continue
+		}
+		if err != nil {
+			s.err = err
+			return s
+		}
+		s.add(&t)
+	}
+}
+
+// parseQuantiles parses -quantiles
+func parseQuantiles(s string) ([]float64, error) {
+	var qs []float64
+	for _, f := range strings.Split(s, ",") {
+		q, err := strconv.ParseFloat(strings.TrimSpace(f), 64)
+		if err != nil || q < 0 || q > 1 {
+			return nil, fmt.Errorf("bad quantile: %q (should be 0-1)", f)
+		}
+		qs = append(qs, q)
+	}
+	return qs, nil
+}
+
+// measureRow is a row in the output. Statistics are nil (null in JSON) when
+// there are too few trips, e.g. the standard deviation of a single trip.
+type measureRow struct {
+	Name      string              `json:"name"`
+	Count     int64               `json:"count"`
+	Mean      *float64            `json:"mean"`
+	StdDev    *float64            `json:"stddev"`
+	Min       *float64            `json:"min"`
+	Max       *float64            `json:"max"`
+	Quantiles map[string]*float64 `json:"quantiles"` // key is the quantile, e.g. "0.5"
+}
+
+// number returns v, nil if it's NaN (which JSON can't encode)
+func number(v float64) *float64 {
+	if math.IsNaN(v) || math.IsInf(v, 0) {
+		return nil
+	}
+	return &v
+}
+
+// formatNumber formats a statistic for the text table
+func formatNumber(v *float64) string {
+	if v == nil {
+		return "-"
+	}
+	return strconv.FormatFloat(*v, 'f', 2, 64)
+}
+
+// describe is the describe command
+func describe(ctx context.Context) int {
+	qs, err := parseQuantiles(quantiles)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %s\n", prog, err)
+		return 1
+	}
+	switch format {
+	case "text", "json":
+	default:
+		fmt.Fprintf(os.Stderr, "%s: unknown describe format: %q\n", prog, format)
+		return 1
+	}
+
+	files, err := tripFiles()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %s\n", prog, err)
+		return 1
+	}
+
+	start := time.Now()
+	results := make([]*sketches, len(files))
+	forEachFile(files, func(i int, path string) {
+		results[i] = describeFile(ctx, path)
+	})
+
+	if ctx.Err() != nil {
+		fmt.Fprintf(os.Stderr, "%s: interrupted\n", prog)
+		return 130
+	}
+
+	code := 0
+	total := newSketches()
+	for _, s := range results {
+		if s.err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %s\n", prog, s.err)
+			code = 1
+			continue
+		}
+		total.merge(s)
+	}
+
+	rows := make([]measureRow, len(measures))
+	for i, m := range measures {
+		mo := &total.moments[i]
+		rows[i] = measureRow{
+			Name:      m.name,
+			Count:     mo.Count(),
+			Mean:      number(mo.Mean()),
+			StdDev:    number(mo.StdDev()),
+			Min:       number(mo.Min()),
+			Max:       number(mo.Max()),
+			Quantiles: make(map[string]*float64),
+		}
+		for _, q := range qs {
+			rows[i].Quantiles[formatQuantile(q)] = number(total.digests[i].Quantile(q))
+		}
+	}
+	pairs := total.pairs.Count()
+
+	switch format {
+	case "text":
+		err = printDescribe(os.Stdout, rows, qs, pairs)
+	case "json":
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		err = enc.Encode(struct {
+			Measures      []measureRow `json:"measures"`
+			DistinctPairs uint64       `json:"distinct_pickup_dropoff_pairs"`
+			BadRows       int          `json:"bad_rows"`
+		}{rows, pairs, total.badRows})
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %s\n", prog, err)
+		return 1
+	}
+
+	if verbose {
+		fmt.Fprintf(os.Stderr, "%d trips in %d files in %v\n", rows[0].Count, len(files), time.Since(start))
+	}
+	if total.badRows > 0 {
+		fmt.Fprintf(os.Stderr, "%s: WARNING: %s skipped\n", prog, cli.Plural(total.badRows, "bad row", "bad rows"))
+		if strict {
+			code = 1
+		}
+	}
+	return code
+}
+
+func formatQuantile(q float64) string {
+	return strconv.FormatFloat(q, 'f', -1, 64)
+}
+
+// printDescribe prints a table of the measures
+//
+//	            count    mean  stddev  min    p50    p90    p99     max
+//	fare_amount  1999998  13.08   11.65  -200   9.50  25.00  52.00  2007.00
+func printDescribe(w io.Writer, rows []measureRow, qs []float64, pairs uint64) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprint(tw, "\tcount\tmean\tstddev\tmin\t")
+	for _, q := range qs {
+		fmt.Fprintf(tw, "p%s\t", strconv.FormatFloat(q*100, 'f', -1, 64))
+	}
+	fmt.Fprint(tw, "max\t\n")
+
+	for _, r := range rows {
+		fmt.Fprintf(tw, "%s\t%d\t%s\t%s\t%s\t", r.Name, r.Count, formatNumber(r.Mean), formatNumber(r.StdDev), formatNumber(r.Min))
+		for _, q := range qs {
+			fmt.Fprintf(tw, "%s\t", formatNumber(r.Quantiles[formatQuantile(q)]))
+		}
+		fmt.Fprintf(tw, "%s\t\n", formatNumber(r.Max))
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+
+	_, err := fmt.Fprintf(w, "\ndistinct pickup/dropoff pairs: ~%d\n", pairs)
+	return err
+}
@@ -0,0 +1,188 @@
+/*
+trips analyzes NYC taxi trip files (taxi-*.csv, can be compressed), the ones
+the taxi tool checks. Files are parsed with the trip package, several files
+are processed concurrently (-j).
+
+	go run ./trips aggregate -dir taxi/taxi-sha256 -by hour,payment
+	go run ./trips validate -dir taxi/taxi-sha256
+	go run ./trips describe -dir taxi/taxi-sha256 -format json
+	go run ./trips convert -dir taxi/taxi-sha256 -o /tmp/trips
+	go run ./trips scan -file /tmp/trips/taxi-01.col -where fare_amount=50..100
+
+Every command has its own options, see "go run ./trips <command> -h".
+*/
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+
+	"day1/internal/cli"
+)
+
+var (
+	prog = filepath.Base(os.Args[0])
+
+	// Options of several commands, see the flags functions in commands
+	dataDir   string
+	recursive bool
+	includes  cli.GlobList
+	excludes  cli.GlobList
+	workers   int
+	format    string
+	warn      bool
+	strict    bool
+	status    bool
+	verbose   bool
+)
+
+// commands, the first argument
+var commands = map[string]cli.Command{
+	"aggregate": {
+		Run: aggregate,
+		Flags: func(fs *flag.FlagSet) {
+			fileFlags(fs)
+			formatFlag(fs, "text, csv or json")
+			fs.StringVar(&groupBy, "by", "hour,day,pickup,payment", "comma separated groups: hour (of day), day, pickup (location) or payment (type)")
+			fs.BoolVar(&warn, "warn", false, "print rows that can't be parsed to stderr")
+			fs.BoolVar(&strict, "strict", false, "exit non-zero if there are rows that can't be parsed")
+		},
+		Help: "statistics grouped by hour, day, pickup location or payment type",
+	},
+	"validate": {
+		Run: validate,
+		Flags: func(fs *flag.FlagSet) {
+			fileFlags(fs)
+			formatFlag(fs, "text or json")
+			fs.IntVar(&samples, "samples", 3, "number of offending rows to show per rule and file")
+			fs.BoolVar(&status, "status", false, "don't output anything, status code shows success")
+		},
+		Help: "check the trips make sense",
+	},
+	"describe": {
+		Run: describe,
+		Flags: func(fs *flag.FlagSet) {
+			fileFlags(fs)
+			formatFlag(fs, "text or json")
+			fs.StringVar(&quantiles, "quantiles", "0.5,0.9,0.99", "comma separated quantiles to compute")
+			fs.BoolVar(&warn, "warn", false, "print rows that can't be parsed to stderr")
+			fs.BoolVar(&strict, "strict", false, "exit non-zero if there are rows that can't be parsed")
+		},
+		Help: "mean, standard deviation, quantiles and distinct counts",
+	},
+	"convert": {
+		Run: convert,
+		Flags: func(fs *flag.FlagSet) {
+			fileFlags(fs)
+			fs.StringVar(&outDir, "o", "", "output directory (default is next to the source files)")
+			fs.BoolVar(&warn, "warn", false, "print rows that can't be parsed to stderr")
+		},
+		Help: "convert to the columnar format",
+	},
+	"scan": {
+		Run: scan,
+		Flags: func(fs *flag.FlagSet) {
+			fs.StringVar(&scanFile, "file", "", "columnar file to read")
+			fs.StringVar(&scanColumns, "columns", "", "comma separated columns to output (default is all)")
+			fs.Var(&wheres, "where", "only rows with column values in a range, column=min..max (either can be empty), can be repeated")
+			fs.BoolVar(&verbose, "v", false, "print number of rows and blocks read to stderr")
+		},
+		Help: "print the rows of a columnar file as CSV",
+	},
+}
+
+// fileFlags adds the options of commands reading trip files
+func fileFlags(fs *flag.FlagSet) {
+	fs.StringVar(&dataDir, "dir", ".", "directory with the trip files")
+	fs.BoolVar(&recursive, "r", false, "walk sub directories")
+	fs.Var(&includes, "include", "only use files matching glob (can be repeated), default is *.csv (maybe compressed)")
+	fs.Var(&excludes, "exclude", "skip files matching glob (can be repeated)")
+	fs.IntVar(&workers, "j", runtime.NumCPU(), "number of files to process concurrently")
+	fs.BoolVar(&verbose, "v", false, "print number of trips and time to stderr")
+}
+
+func formatFlag(fs *flag.FlagSet, formats string) {
+	fs.StringVar(&format, "format", "text", "output format: "+formats)
+}
+
+func main() {
+	cli.Main(commands, "")
+}
+
+// tripFile is a file to process
+type tripFile struct {
+	path string // on disk
+	name string // relative to -dir, slash separated
+}
+
+// tripFiles returns the trip files under -dir, sorted by name. Without
+// -include, files named *.csv (maybe compressed) are used.
+func tripFiles() ([]tripFile, error) {
+	var files []tripFile
+	err := filepath.WalkDir(dataDir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if d.IsDir() {
+			if path != dataDir && !recursive {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+
+		rel, err := filepath.Rel(dataDir, path)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		switch {
+		case len(includes) == 0 && !strings.HasSuffix(cli.TrimCompressExt(rel), ".csv"):
+			return nil
+		case len(includes) > 0 && !includes.Match(rel):
+			return nil
+		case excludes.Match(rel):
+			return nil
+		}
+		files = append(files, tripFile{path: path, name: rel})
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if len(files) == 0 {
+		return nil, fmt.Errorf("%s: no trip files", dataDir)
+	}
+	sort.Slice(files, func(i, j int) bool {
+		return files[i].name < files[j].name
+	})
+	return files, nil
+}
+
+// forEachFile calls fn for every file, -j files at a time, and waits for
+// them to finish. i is the index in files.
+func forEachFile(files []tripFile, fn func(i int, path string)) {
+	sem := make(chan bool, workers)
+	var wg sync.WaitGroup
+	for i, f := range files {
+		wg.Add(1)
+		go func(i int, path string) {
+			defer wg.Done()
+			sem <- true
+			defer func() { <-sem }()
+			fn(i, path)
+		}(i, f.path)
+	}
+	wg.Wait()
+}
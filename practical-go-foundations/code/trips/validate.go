@@ -0,0 +1,261 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"day1/trip"
+)
+
+// validate checks the trips in the files make sense, a matching sha256 only
+// tells us the files didn't change since the index was created.
+//
+//	go run ./trips validate -dir taxi/taxi-sha256
+//	go run ./trips validate -dir taxi/taxi-sha256 -samples 10 -format json
+
+var samples int // -samples
+
+const (
+	maxSpeed    = 100 // mph, faster trips are implausible
+	maxLocation = 263 // taxi zones are 1-263, 264 & 265 are unknown
+)
+
+// parseRule counts rows that can't be parsed
+const parseRule = "parse_error"
+
+// rules are checked in order, durationRules (see aggregate) first
+var rules = append(durationRules, []rule{
+	{
+		name:  "negative_fare",
+		desc:  "fare_amount or total_amount is negative",
+		check: func(t *trip.Trip) bool { return t.Fare < 0 || t.Total < 0 },
+	},
+	{
+		name: "total_mismatch",
+		desc: "total_amount isn't the sum of its components",
+		check: func(t *trip.Trip) bool {
+			sum := t.Fare + t.Extra + t.MTATax + t.Tip + t.Tolls + t.ImprovementSurcharge
+			return sum != t.Total
+		},
+	},
+	{
+		name:  "zero_passengers",
+		desc:  "passenger_count is 0",
+		check: func(t *trip.Trip) bool { return t.Passengers == 0 },
+	},
+	{
+		name: "implausible_distance",
+		desc: fmt.Sprintf("distance implausible for the duration (over %d mph)", maxSpeed),
+		check: func(t *trip.Trip) bool {
+			d := t.Duration()
+			if t.Distance <= 0 || d < 0 { // negative durations are another rule
+				return false
+			}
+			return d == 0 || t.Distance/d.Hours() > maxSpeed
+		},
+	},
+	{
+		name: "unknown_location",
+		desc: fmt.Sprintf("PULocationID or DOLocationID isn't a taxi zone (1-%d)", maxLocation),
+		check: func(t *trip.Trip) bool {
+			return t.PickupLocation < 1 || t.PickupLocation > maxLocation ||
+				t.DropoffLocation < 1 || t.DropoffLocation > maxLocation
+		},
+	},
+	{
+		name:  "unknown_code",
+		desc:  "payment_type or RatecodeID isn't in the data dictionary",
+		check: func(t *trip.Trip) bool { return !t.PaymentType.Valid() || !t.RateCode.Valid() },
+	},
+}...)
+
+// sample is an offending row
+type sample struct {
+	Line  int    `json:"line"`
+	Row   string `json:"row"`
+	Error string `json:"error,omitempty"` // for parse errors
+}
+
+// ruleReport is the violations of a rule in a file
+type ruleReport struct {
+	Rule    string   `json:"rule"`
+	Count   int64    `json:"count"`
+	Samples []sample `json:"samples"`
+}
+
+func (r *ruleReport) add(s sample) {
+	r.Count++
+	if len(r.Samples) < samples {
+		r.Samples = append(r.Samples, s)
+	}
+}
+
+// fileReport is the validation result of a file
+type fileReport struct {
+	File       string        `json:"file"`
+	Rows       int64         `json:"rows"`
+	Violations int64         `json:"violations"` // rows with at least one violation
+	Rules      []*ruleReport `json:"rules"`      // same order as rules, parse errors last
+	Error      string        `json:"error,omitempty"`
+
+	err error
+}
+
+// validateFile checks every row in path
+func validateFile(ctx context.Context, path string) *fileReport {
+	fr := &fileReport{File: path}
+	for _, r := range rules {
+		fr.Rules = append(fr.Rules, &ruleReport{Rule: r.name, Samples: []sample{}})
+	}
+	parseErrors := &ruleReport{Rule: parseRule, Samples: []sample{}}
+	fr.Rules = append(fr.Rules, parseErrors)
+
+	tr, err := trip.Open(path)
+	if err != nil {
+		fr.err = err
+		return fr
+	}
+	defer tr.Close()
+
+	for {
+		if fr.Rows%1024 == 0 && ctx.Err() != nil {
+			fr.err = ctx.Err()
+			return fr
+		}
+
+		t, err := tr.Read()
+		if err == io.EOF {
+			return fr
+		}
+		var pe *trip.ParseError
+		if err != nil && !errors.As(err, &pe) {
+			fr.err = err
+			return fr
+		}
+
+		fr.Rows++
+		if pe != nil {
+			fr.Violations++
+			parseErrors.add(sample{Line: pe.Line, Row: strings.Join(tr.Record(), ","), Error: pe.Error()})
+			continue
+		}
+
+		bad := false
+		for i, r := range rules {
+			if r.check(&t) {
+				bad = true
+				fr.Rules[i].add(sample{Line: tr.Line(), Row: strings.Join(tr.Record(), ",")})
+			}
+		}
+		if bad {
+			fr.Violations++
+		}
+	}
+}
+
+// validate is the validate command
+func validate(ctx context.Context) int {
+	switch format {
+	case "text", "json":
+	default:
+		fmt.Fprintf(os.Stderr, "%s: unknown validate format: %q\n", prog, format)
+		return 1
+	}
+	if samples < 0 {
+		fmt.Fprintf(os.Stderr, "%s: -samples can't be negative\n", prog)
+		return 1
+	}
+
+	files, err := tripFiles()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %s\n", prog, err)
+		return 1
+	}
+
+	reports := make([]*fileReport, len(files))
+	forEachFile(files, func(i int, path string) {
+		reports[i] = validateFile(ctx, path)
+	})
+
+	if ctx.Err() != nil {
+		fmt.Fprintf(os.Stderr, "%s: interrupted\n", prog)
+		return 130
+	}
+
+	code := 0
+	for _, fr := range reports {
+		if fr.err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %s\n", prog, fr.err)
+			fr.Error = fr.err.Error()
+			code = 1
+		}
+		if fr.Violations > 0 {
+			code = 1
+		}
+	}
+
+	if status {
+		return code
+	}
+	switch format {
+	case "text":
+		err = printValidation(os.Stdout, reports)
+	case "json":
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		err = enc.Encode(struct {
+			Files []*fileReport `json:"files"`
+		}{reports})
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %s\n", prog, err)
+		return 1
+	}
+	return code
+}
+
+// printValidation prints the rules with violations and their samples
+//
+//	taxi-01.csv.bz2: 199998 rows, 1433 with violations
+//	  zero_passengers            1198  passenger_count is 0
+//	    line 1234: 1,2018-05-01 00:21:54,...
+func printValidation(w io.Writer, reports []*fileReport) error {
+	descs := map[string]string{parseRule: "row can't be parsed"}
+	for _, r := range rules {
+		descs[r.name] = r.desc
+	}
+
+	var rows, bad int64
+	for _, fr := range reports {
+		if fr.err != nil {
+			continue
+		}
+		rows += fr.Rows
+		bad += fr.Violations
+
+		fmt.Fprintf(w, "%s: %d rows, %d with violations\n", fr.File, fr.Rows, fr.Violations)
+		for _, rr := range fr.Rules {
+			if rr.Count == 0 {
+				continue
+			}
+			fmt.Fprintf(w, "  %-22s %8d  %s\n", rr.Rule, rr.Count, descs[rr.Rule])
+			for _, s := range rr.Samples {
+				if s.Error != "" {
+					fmt.Fprintf(w, "    %s\n", s.Error)
+					continue
+				}
+				fmt.Fprintf(w, "    line %d: %s\n", s.Line, s.Row)
+			}
+		}
+	}
+
+	if len(reports) > 1 {
+		fmt.Fprintf(w, "total: %d rows, %d with violations\n", rows, bad)
+	}
+	return nil
+}
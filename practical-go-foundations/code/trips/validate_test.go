@@ -0,0 +1,164 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"day1/trip"
+)
+
+const (
+	header = "VendorID,tpep_pickup_datetime,tpep_dropoff_datetime,passenger_count,trip_distance,RatecodeID,store_and_fwd_flag,PULocationID,DOLocationID,payment_type,fare_amount,extra,mta_tax,tip_amount,tolls_amount,improvement_surcharge,total_amount"
+	row    = "1,2018-05-01 00:13:56,2018-05-01 00:22:46,1,1.60,1,N,230,50,1,8,0.5,0.5,1.85,0,0.3,11.15"
+)
+
+// goodTrip is row
+func goodTrip() trip.Trip {
+	pickup := time.Date(2018, 5, 1, 0, 13, 56, 0, time.UTC)
+	return trip.Trip{
+		Vendor:               1,
+		Pickup:               pickup,
+		Dropoff:              pickup.Add(8*time.Minute + 50*time.Second),
+		Passengers:           1,
+		Distance:             1.6,
+		RateCode:             trip.StandardRate,
+		PickupLocation:       230,
+		DropoffLocation:      50,
+		PaymentType:          trip.CreditCard,
+		Fare:                 800,
+		Extra:                50,
+		MTATax:               50,
+		Tip:                  185,
+		ImprovementSurcharge: 30,
+		Total:                1115,
+	}
+}
+
+// violations returns the names of the rules t violates
+func violations(t *trip.Trip) []string {
+	var names []string
+	for _, r := range rules {
+		if r.check(t) {
+			names = append(names, r.name)
+		}
+	}
+	return names
+}
+
+func TestRules(t *testing.T) {
+	cases := []struct {
+		name string
+		edit func(t *trip.Trip)
+		want []string
+	}{
+		{"good", func(t *trip.Trip) {}, nil},
+		{
+			"dropoff before pickup",
+			func(t *trip.Trip) { t.Dropoff = t.Pickup.Add(-time.Minute) },
+			[]string{"dropoff_before_pickup"},
+		},
+		{
+			"dropoff in 1998", // taxi-02
+			func(t *trip.Trip) { t.Dropoff = time.Date(1998, 1, 1, 0, 0, 0, 0, time.UTC) },
+			[]string{"dropoff_before_pickup"},
+		},
+		{
+			"meter left running",
+			func(t *trip.Trip) { t.Dropoff = t.Pickup.Add(23 * time.Hour) },
+			[]string{"long_trip"},
+		},
+		{"12 hours", func(t *trip.Trip) { t.Dropoff = t.Pickup.Add(maxDuration) }, nil},
+		{
+			"negative fare",
+			func(t *trip.Trip) { t.Fare, t.Total = -800, -485 },
+			[]string{"negative_fare"},
+		},
+		{
+			"negative total", // a refund, the components are negative too
+			func(t *trip.Trip) {
+				t.Fare, t.Extra, t.MTATax, t.Tip, t.ImprovementSurcharge, t.Total = -800, -50, -50, -185, -30, -1115
+			},
+			[]string{"negative_fare"},
+		},
+		{"total mismatch", func(t *trip.Trip) { t.Total++ }, []string{"total_mismatch"}},
+		{"zero passengers", func(t *trip.Trip) { t.Passengers = 0 }, []string{"zero_passengers"}},
+		{"too fast", func(t *trip.Trip) { t.Distance = 20 }, []string{"implausible_distance"}},
+		{"zero duration", func(t *trip.Trip) { t.Dropoff = t.Pickup }, []string{"implausible_distance"}},
+		{"zero duration and distance", func(t *trip.Trip) { t.Dropoff, t.Distance = t.Pickup, 0 }, nil},
+		{
+			"too fast backwards", // only the duration rule
+			func(t *trip.Trip) { t.Dropoff, t.Distance = t.Pickup.Add(-time.Minute), 20 },
+			[]string{"dropoff_before_pickup"},
+		},
+		{"unknown pickup", func(t *trip.Trip) { t.PickupLocation = 264 }, []string{"unknown_location"}},
+		{"zero dropoff", func(t *trip.Trip) { t.DropoffLocation = 0 }, []string{"unknown_location"}},
+		{"unknown payment", func(t *trip.Trip) { t.PaymentType = 7 }, []string{"unknown_code"}},
+		{"unknown rate", func(t *trip.Trip) { t.RateCode = 99 }, []string{"unknown_code"}},
+		{
+			"several",
+			func(t *trip.Trip) { t.Passengers, t.Total = 0, 0 },
+			[]string{"total_mismatch", "zero_passengers"},
+		},
+	}
+	for _, tc := range cases {
+		tr := goodTrip()
+		tc.edit(&tr)
+		if got := violations(&tr); !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("%s: got %v, want %v", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestValidateFile(t *testing.T) {
+	backwards := strings.Replace(row, "2018-05-01 00:22:46", "2018-05-01 00:02:46", 1)
+	noPassengers := strings.Replace(row, ",1,1.60,", ",0,1.60,", 1)
+	data := strings.Join([]string{
+		header,
+		row,
+		backwards,
+		"1,not a date,2018-05-01 00:22:46,1,1.60,1,N,230,50,1,8,0.5,0.5,1.85,0,0.3,11.15",
+		noPassengers,
+		noPassengers,
+		"",
+	}, "\n")
+	path := filepath.Join(t.TempDir(), "taxi-01.csv")
+	if err := os.WriteFile(path, []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	samples = 1
+	fr := validateFile(context.Background(), path)
+	if fr.err != nil {
+		t.Fatal(fr.err)
+	}
+	if fr.Rows != 5 || fr.Violations != 4 {
+		t.Errorf("got %d rows, %d with violations; want 5, 4", fr.Rows, fr.Violations)
+	}
+
+	counts := make(map[string]int64)
+	for _, rr := range fr.Rules {
+		counts[rr.Rule] = rr.Count
+		if int64(len(rr.Samples)) > rr.Count || len(rr.Samples) > samples {
+			t.Errorf("%s: %d samples of %d", rr.Rule, len(rr.Samples), rr.Count)
+		}
+	}
+	want := map[string]int64{"dropoff_before_pickup": 1, "zero_passengers": 2, parseRule: 1}
+	for _, r := range append(rules, rule{name: parseRule}) {
+		if counts[r.name] != want[r.name] {
+			t.Errorf("%s: got %d, want %d", r.name, counts[r.name], want[r.name])
+		}
+	}
+
+	if s := fr.Rules[0].Samples[0]; s.Line != 3 || s.Row != backwards {
+		t.Errorf("dropoff_before_pickup sample: got line %d %q, want line 3 %q", s.Line, s.Row, backwards)
+	}
+	last := fr.Rules[len(fr.Rules)-1]
+	if last.Rule != parseRule || last.Samples[0].Line != 4 || last.Samples[0].Error == "" {
+		t.Errorf("parse error sample: %+v", last)
+	}
+}
@@ -0,0 +1,253 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"text/tabwriter"
+	"time"
+
+	"day1/accesslog"
+	"day1/internal/cli"
+)
+
+// report prints the top hosts, paths and 404 paths, the status codes, the
+// bytes served per hour and the busiest seconds. It's a single pass over the
+// log, memory is bounded by the number of distinct hosts, paths and seconds.
+
+// logStats are the counters of the report
+type logStats struct {
+	requests int64
+	bytes    int64
+	first    time.Time
+	last     time.Time
+
+	hosts     map[string]int64
+	paths     map[string]int64
+	notFound  map[string]int64 // 404 paths
+	statuses  map[int]int64
+	hourBytes map[int64]int64 // unix time of the hour -> bytes
+	seconds   map[int64]int64 // unix time -> requests
+	loc       *time.Location  // of the first record, to print times
+}
+
+func newLogStats() *logStats {
+	return &logStats{
+		hosts:     make(map[string]int64),
+		paths:     make(map[string]int64),
+		notFound:  make(map[string]int64),
+		statuses:  make(map[int]int64),
+		hourBytes: make(map[int64]int64),
+		seconds:   make(map[int64]int64),
+	}
+}
+
+func (s *logStats) add(rec *accesslog.Record) {
+	if s.requests == 0 {
+		s.first, s.last = rec.Time, rec.Time
+		s.loc = rec.Time.Location()
+	}
+	if rec.Time.Before(s.first) {
+		s.first = rec.Time
+	}
+	if rec.Time.After(s.last) {
+		s.last = rec.Time
+	}
+
+	s.requests++
+	s.hosts[rec.Host]++
+	s.paths[rec.Path]++
+	s.statuses[rec.Status]++
+	if rec.Status == 404 {
+		s.notFound[rec.Path]++
+	}
+	s.seconds[rec.Time.Unix()]++
+
+	// Every hour is in the output, even without bytes
+	hour := rec.Time.Truncate(time.Hour).Unix()
+	s.hourBytes[hour] += 0
+	if rec.Bytes > 0 {
+		s.bytes += rec.Bytes
+		s.hourBytes[hour] += rec.Bytes
+	}
+}
+
+// counted is a value and its count
+type counted struct {
+	Key   string `json:"key"`
+	Count int64  `json:"count"`
+}
+
+// top returns the n keys with the highest counts, ties are sorted by key so
+// the output is stable. n can be more than the number of keys.
+func top(counts map[string]int64, n int) []counted {
+	all := make([]counted, 0, len(counts))
+	for k, c := range counts {
+		all = append(all, counted{k, c})
+	}
+	sort.Slice(all, func(i, j int) bool {
+		if all[i].Count != all[j].Count {
+			return all[i].Count > all[j].Count
+		}
+		return all[i].Key < all[j].Key
+	})
+	if n < len(all) {
+		all = all[:n]
+	}
+	return all
+}
+
+// statusCount is a row in the status distribution
+type statusCount struct {
+	Status  int     `json:"status"`
+	Count   int64   `json:"count"`
+	Percent float64 `json:"percent"`
+}
+
+// hourBytes is a row in bytes per hour
+type hourBytes struct {
+	Hour  time.Time `json:"hour"`
+	Bytes int64     `json:"bytes"`
+}
+
+// secondCount is a row in the requests per second peaks
+type secondCount struct {
+	Time     time.Time `json:"time"`
+	Requests int64     `json:"requests"`
+}
+
+// logReport is the output of report
+type logReport struct {
+	File        string        `json:"file"`
+	Requests    int64         `json:"requests"`
+	Malformed   int           `json:"malformed"`
+	Bytes       int64         `json:"bytes"`
+	First       time.Time     `json:"first"`
+	Last        time.Time     `json:"last"`
+	Hosts       []counted     `json:"top_hosts"`
+	Paths       []counted     `json:"top_paths"`
+	NotFound    []counted     `json:"top_404_paths"`
+	Statuses    []statusCount `json:"statuses"`
+	HourBytes   []hourBytes   `json:"bytes_per_hour"`
+	PeakSeconds []secondCount `json:"peak_seconds"`
+}
+
+func newLogReport(s *logStats, malformed int) *logReport {
+	rep := &logReport{
+		File:        logFile,
+		Requests:    s.requests,
+		Malformed:   malformed,
+		Bytes:       s.bytes,
+		First:       s.first,
+		Last:        s.last,
+		Hosts:       top(s.hosts, topN),
+		Paths:       top(s.paths, topN),
+		NotFound:    top(s.notFound, topN),
+		Statuses:    []statusCount{},
+		HourBytes:   []hourBytes{},
+		PeakSeconds: []secondCount{},
+	}
+
+	for status, count := range s.statuses {
+		pct := 100 * float64(count) / float64(s.requests)
+		rep.Statuses = append(rep.Statuses, statusCount{status, count, pct})
+	}
+	sort.Slice(rep.Statuses, func(i, j int) bool { return rep.Statuses[i].Status < rep.Statuses[j].Status })
+
+	for hour, b := range s.hourBytes {
+		rep.HourBytes = append(rep.HourBytes, hourBytes{time.Unix(hour, 0).In(s.loc), b})
+	}
+	sort.Slice(rep.HourBytes, func(i, j int) bool { return rep.HourBytes[i].Hour.Before(rep.HourBytes[j].Hour) })
+
+	// Seconds as strings, to reuse top
+	secs := make(map[string]int64, len(s.seconds))
+	for sec, count := range s.seconds {
+		secs[strconv.FormatInt(sec, 10)] = count
+	}
+	for _, c := range top(secs, topN) {
+		sec, _ := strconv.ParseInt(c.Key, 10, 64)
+		rep.PeakSeconds = append(rep.PeakSeconds, secondCount{time.Unix(sec, 0).In(s.loc), c.Count})
+	}
+	return rep
+}
+
+// report is the report command
+func report(ctx context.Context) int {
+	if err := checkLogFlags(); err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %s\n", prog, err)
+		return 1
+	}
+
+	start := time.Now()
+	s := newLogStats()
+	malformed, err := readLog(ctx, s.add)
+	if ctx.Err() != nil {
+		fmt.Fprintf(os.Stderr, "%s: interrupted\n", prog)
+		return 130
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %s\n", prog, err)
+		return 1
+	}
+
+	rep := newLogReport(s, malformed)
+	switch format {
+	case "text":
+		err = printReport(os.Stdout, rep)
+	case "json":
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		err = enc.Encode(rep)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %s\n", prog, err)
+		return 1
+	}
+
+	if verbose {
+		fmt.Fprintf(os.Stderr, "%d requests in %v\n", s.requests, time.Since(start))
+	}
+	if malformed > 0 {
+		fmt.Fprintf(os.Stderr, "%s: WARNING: %d malformed lines skipped\n", prog, malformed)
+	}
+	return 0
+}
+
+// timeLayout is used to print times in the text report
+const timeLayout = "2006-01-02 15:04:05 -0700"
+
+func printReport(w io.Writer, rep *logReport) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(tw, "%s: %d requests, %s served, %s to %s\n",
+		rep.File, rep.Requests, cli.Size(rep.Bytes), rep.First.Format(timeLayout), rep.Last.Format(timeLayout))
+
+	printCounted := func(title string, cs []counted) {
+		fmt.Fprintf(tw, "\n%s\n", title)
+		for _, c := range cs {
+			fmt.Fprintf(tw, "  %d\t%s\n", c.Count, c.Key)
+		}
+	}
+	printCounted("top hosts", rep.Hosts)
+	printCounted("top paths", rep.Paths)
+	printCounted("top 404 paths", rep.NotFound)
+
+	fmt.Fprintf(tw, "\nstatus codes\n")
+	for _, s := range rep.Statuses {
+		fmt.Fprintf(tw, "  %d\t%d\t%.2f%%\n", s.Status, s.Count, s.Percent)
+	}
+
+	fmt.Fprintf(tw, "\npeak requests per second\n")
+	for _, s := range rep.PeakSeconds {
+		fmt.Fprintf(tw, "  %d\t%s\n", s.Requests, s.Time.Format(timeLayout))
+	}
+
+	fmt.Fprintf(tw, "\nbytes per hour\n")
+	for _, h := range rep.HourBytes {
+		fmt.Fprintf(tw, "  %s\t%s\n", h.Hour.Format("2006-01-02 15:00"), cli.Size(h.Bytes))
+	}
+	return tw.Flush()
+}
@@ -0,0 +1,403 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"day1/accesslog"
+	"day1/stats"
+)
+
+// sessions groups the requests of every host to visits: a session ends when
+// the host is inactive for -timeout. It reports the session length and pages
+// per session, the common entry and exit pages and navigation paths.
+//
+//	go run ./weblog sessions -timeout 15m -depth 4
+//
+// Images and other assets (-assets) are part of the session but aren't pages,
+// neither are failed requests. The log is read once, sessions idle for more
+// than -timeout are closed as we go so memory is bounded by the number of
+// active hosts.
+
+var (
+	timeout time.Duration // -timeout
+	depth   int           // -depth
+	assets  string        // -assets
+)
+
+// session is a visit of a host
+type session struct {
+	start time.Time
+	last  time.Time
+	pages []string // in order, reloads are counted once
+}
+
+// sessionStats are the counters of closed sessions
+type sessionStats struct {
+	sessions int64
+	noPages  int64 // sessions with only assets or errors
+
+	length      stats.Moments // seconds
+	lengthQ     *stats.Digest
+	pageCount   stats.Moments
+	pageCountQ  *stats.Digest
+	lengthHist  []int64 // same order as lengthBuckets
+	pagesHist   []int64 // same order as pageBuckets
+	entries     map[string]int64
+	exits       map[string]int64
+	navigations []map[string]int64 // by path length - 2
+}
+
+// lengthBuckets are the upper bounds of the session length histogram, the
+// last bucket is for the rest
+var lengthBuckets = []time.Duration{0, time.Minute, 5 * time.Minute, 15 * time.Minute, 30 * time.Minute, time.Hour, 2 * time.Hour}
+
+// pageBuckets are the upper bounds of the pages per session histogram
+var pageBuckets = []int{1, 2, 3, 5, 10, 20}
+
+func newSessionStats() *sessionStats {
+	s := &sessionStats{
+		lengthQ:     stats.NewDigest(0),
+		pageCountQ:  stats.NewDigest(0),
+		lengthHist:  make([]int64, len(lengthBuckets)+1),
+		pagesHist:   make([]int64, len(pageBuckets)+1),
+		entries:     make(map[string]int64),
+		exits:       make(map[string]int64),
+		navigations: make([]map[string]int64, depth-1),
+	}
+	for i := range s.navigations {
+		s.navigations[i] = make(map[string]int64)
+	}
+	return s
+}
+
+func (s *sessionStats) add(se *session) {
+	s.sessions++
+	d := se.last.Sub(se.start)
+	s.length.Add(d.Seconds())
+	s.lengthQ.Add(d.Seconds())
+	i := 0
+	for i < len(lengthBuckets) && d > lengthBuckets[i] {
+		i++
+	}
+	s.lengthHist[i]++
+
+	n := len(se.pages)
+	s.pageCount.Add(float64(n))
+	s.pageCountQ.Add(float64(n))
+	if n == 0 {
+		s.noPages++
+		return
+	}
+	i = 0
+	for i < len(pageBuckets) && n > pageBuckets[i] {
+		i++
+	}
+	s.pagesHist[i]++
+
+	s.entries[se.pages[0]]++
+	s.exits[se.pages[n-1]]++
+	for l := 2; l <= depth; l++ {
+		for j := 0; j+l <= n; j++ {
+			s.navigations[l-2][strings.Join(se.pages[j:j+l], " -> ")]++
+		}
+	}
+}
+
+// isPage returns true if rec is a successful request for a page
+func isPage(rec *accesslog.Record, assetExts map[string]bool) bool {
+	if rec.Status < 200 || rec.Status >= 400 {
+		return false
+	}
+	return !assetExts[strings.ToLower(path.Ext(rec.Path))]
+}
+
+// sessionizer groups records to sessions
+type sessionizer struct {
+	timeout   time.Duration
+	assetExts map[string]bool
+	open      map[string]*session // host -> session
+	now       time.Time           // latest time seen
+	swept     time.Time           // when we last closed idle sessions
+	stats     *sessionStats
+}
+
+func (z *sessionizer) add(rec *accesslog.Record) {
+	if rec.Time.After(z.now) {
+		z.now = rec.Time
+	}
+
+	se := z.open[rec.Host]
+	if se != nil && rec.Time.Sub(se.last) > z.timeout {
+		z.stats.add(se)
+		se = nil
+	}
+	if se == nil {
+		se = &session{start: rec.Time, last: rec.Time}
+		z.open[rec.Host] = se
+	}
+	// The log isn't strictly ordered, an earlier request is in the session
+	if rec.Time.After(se.last) {
+		se.last = rec.Time
+	}
+	if isPage(rec, z.assetExts) {
+		if n := len(se.pages); n == 0 || se.pages[n-1] != rec.Path {
+			se.pages = append(se.pages, rec.Path)
+		}
+	}
+
+	if z.now.Sub(z.swept) > z.timeout {
+		z.sweep(false)
+	}
+}
+
+// sweep closes the sessions that are idle for more than timeout, or all of
+// them
+func (z *sessionizer) sweep(all bool) {
+	for host, se := range z.open {
+		if all || z.now.Sub(se.last) > z.timeout {
+			z.stats.add(se)
+			delete(z.open, host)
+		}
+	}
+	z.swept = z.now
+}
+
+// sessionReport is the output of sessions
+type sessionReport struct {
+	File        string       `json:"file"`
+	Requests    int64        `json:"requests"`
+	Malformed   int          `json:"malformed"`
+	Timeout     string       `json:"timeout"`
+	Sessions    int64        `json:"sessions"`
+	NoPages     int64        `json:"sessions_without_pages"`
+	Length      distribution `json:"length_s"`
+	Pages       distribution `json:"pages"`
+	LengthHist  []bucket     `json:"length_histogram"`
+	PagesHist   []bucket     `json:"pages_histogram"` // sessions with pages
+	Entries     []counted    `json:"top_entry_pages"`
+	Exits       []counted    `json:"top_exit_pages"`
+	Navigations [][]counted  `json:"top_navigation_paths"` // by length, from 2
+}
+
+// distribution is the summary of a value over sessions, nil (null in JSON)
+// if there are no sessions
+type distribution struct {
+	Mean *float64 `json:"mean"`
+	P50  *float64 `json:"p50"`
+	P90  *float64 `json:"p90"`
+	P99  *float64 `json:"p99"`
+	Max  *float64 `json:"max"`
+}
+
+func newDistribution(m *stats.Moments, d *stats.Digest) distribution {
+	return distribution{number(m.Mean()), number(d.Quantile(0.5)), number(d.Quantile(0.9)), number(d.Quantile(0.99)), number(m.Max())}
+}
+
+// number returns v, nil if it's NaN (which JSON can't encode)
+func number(v float64) *float64 {
+	if math.IsNaN(v) || math.IsInf(v, 0) {
+		return nil
+	}
+	return &v
+}
+
+// bucket is a histogram bucket
+type bucket struct {
+	Label string `json:"label"`
+	Count int64  `json:"count"`
+}
+
+func newSessionReport(s *sessionStats, requests int64, malformed int) *sessionReport {
+	rep := &sessionReport{
+		File:      logFile,
+		Requests:  requests,
+		Malformed: malformed,
+		Timeout:   shortDuration(timeout),
+		Sessions:  s.sessions,
+		NoPages:   s.noPages,
+		Length:    newDistribution(&s.length, s.lengthQ),
+		Pages:     newDistribution(&s.pageCount, s.pageCountQ),
+		Entries:   top(s.entries, topN),
+		Exits:     top(s.exits, topN),
+	}
+
+	for i, c := range s.lengthHist {
+		var label string
+		switch {
+		case i == 0:
+			label = "0s"
+		case i == len(lengthBuckets):
+			label = fmt.Sprintf("> %v", shortDuration(lengthBuckets[i-1]))
+		default:
+			label = fmt.Sprintf("%v - %v", shortDuration(lengthBuckets[i-1]), shortDuration(lengthBuckets[i]))
+		}
+		rep.LengthHist = append(rep.LengthHist, bucket{label, c})
+	}
+
+	low := 1
+	for i, c := range s.pagesHist {
+		var label string
+		switch {
+		case i == len(pageBuckets):
+			label = fmt.Sprintf("> %d", pageBuckets[i-1])
+		case low == pageBuckets[i]:
+			label = fmt.Sprint(low)
+		default:
+			label = fmt.Sprintf("%d - %d", low, pageBuckets[i])
+		}
+		if i < len(pageBuckets) {
+			low = pageBuckets[i] + 1
+		}
+		rep.PagesHist = append(rep.PagesHist, bucket{label, c})
+	}
+
+	for _, nav := range s.navigations {
+		rep.Navigations = append(rep.Navigations, top(nav, topN))
+	}
+	return rep
+}
+
+// shortDuration prints 5m instead of 5m0s
+func shortDuration(d time.Duration) string {
+	s := d.String()
+	if strings.HasSuffix(s, "m0s") {
+		s = s[:len(s)-2]
+	}
+	if strings.HasSuffix(s, "h0m") {
+		s = s[:len(s)-2]
+	}
+	return s
+}
+
+// sessions is the sessions command
+func sessions(ctx context.Context) int {
+	if err := checkLogFlags(); err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %s\n", prog, err)
+		return 1
+	}
+	if timeout <= 0 {
+		fmt.Fprintf(os.Stderr, "%s: -timeout must be positive\n", prog)
+		return 1
+	}
+	if depth < 2 {
+		fmt.Fprintf(os.Stderr, "%s: -depth must be at least 2\n", prog)
+		return 1
+	}
+
+	z := &sessionizer{
+		timeout:   timeout,
+		assetExts: make(map[string]bool),
+		open:      make(map[string]*session),
+		stats:     newSessionStats(),
+	}
+	for _, ext := range strings.Split(assets, ",") {
+		ext = strings.ToLower(strings.TrimSpace(ext))
+		if ext == "" { // "" would make every path without extension an asset
+			continue
+		}
+		if !strings.HasPrefix(ext, ".") {
+			ext = "." + ext
+		}
+		z.assetExts[ext] = true
+	}
+
+	start := time.Now()
+	var requests int64
+	malformed, err := readLog(ctx, func(rec *accesslog.Record) {
+		requests++
+		z.add(rec)
+	})
+	if ctx.Err() != nil {
+		fmt.Fprintf(os.Stderr, "%s: interrupted\n", prog)
+		return 130
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %s\n", prog, err)
+		return 1
+	}
+	z.sweep(true)
+
+	rep := newSessionReport(z.stats, requests, malformed)
+	switch format {
+	case "text":
+		err = printSessions(os.Stdout, rep)
+	case "json":
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		err = enc.Encode(rep)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %s\n", prog, err)
+		return 1
+	}
+
+	if verbose {
+		fmt.Fprintf(os.Stderr, "%d requests, %d sessions in %v\n", requests, z.stats.sessions, time.Since(start))
+	}
+	if malformed > 0 {
+		fmt.Fprintf(os.Stderr, "%s: WARNING: %d malformed lines skipped\n", prog, malformed)
+	}
+	return 0
+}
+
+func printSessions(w io.Writer, rep *sessionReport) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(tw, "%s: %d requests, %d sessions (timeout %s), %d without pages\n",
+		rep.File, rep.Requests, rep.Sessions, rep.Timeout, rep.NoPages)
+
+	fmt.Fprintf(tw, "\n\tmean\tp50\tp90\tp99\tmax\n")
+	l := rep.Length
+	fmt.Fprintf(tw, "  length\t%s\t%s\t%s\t%s\t%s\n",
+		seconds(l.Mean), seconds(l.P50), seconds(l.P90), seconds(l.P99), seconds(l.Max))
+	p := rep.Pages
+	fmt.Fprintf(tw, "  pages\t%s\t%s\t%s\t%s\t%s\n",
+		decimal(p.Mean, 1), decimal(p.P50, 0), decimal(p.P90, 0), decimal(p.P99, 0), decimal(p.Max, 0))
+
+	printBuckets := func(title string, bs []bucket) {
+		fmt.Fprintf(tw, "\n%s\n", title)
+		for _, b := range bs {
+			fmt.Fprintf(tw, "  %s\t%d\n", b.Label, b.Count)
+		}
+	}
+	printBuckets("session length", rep.LengthHist)
+	printBuckets("pages per session", rep.PagesHist)
+
+	printCounted := func(title string, cs []counted) {
+		fmt.Fprintf(tw, "\n%s\n", title)
+		for _, c := range cs {
+			fmt.Fprintf(tw, "  %d\t%s\n", c.Count, c.Key)
+		}
+	}
+	printCounted("top entry pages", rep.Entries)
+	printCounted("top exit pages", rep.Exits)
+	for i, nav := range rep.Navigations {
+		printCounted(fmt.Sprintf("top navigation paths (%d pages)", i+2), nav)
+	}
+	return tw.Flush()
+}
+
+// seconds prints a number of seconds as a duration, - for nil
+func seconds(s *float64) string {
+	if s == nil {
+		return "-"
+	}
+	return time.Duration(*s * float64(time.Second)).Round(time.Second).String()
+}
+
+// decimal prints v with prec decimals, - for nil
+func decimal(v *float64, prec int) string {
+	if v == nil {
+		return "-"
+	}
+	return strconv.FormatFloat(*v, 'f', prec, 64)
+}
@@ -0,0 +1,117 @@
+/*
+weblog analyzes web server access logs, by default sha1/http.log.gz (the NASA
+Kennedy Space Center log from August 1995). Logs are parsed with the
+accesslog package, they can be compressed.
+
+	go run ./weblog report -n 5
+	go run ./weblog report -log access.log -format json
+	go run ./weblog sessions -timeout 15m
+
+Malformed lines are skipped and counted, -warn prints them. Every command has
+its own options, see "go run ./weblog <command> -h".
+*/
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	"day1/accesslog"
+	"day1/internal/cli"
+)
+
+var (
+	prog = filepath.Base(os.Args[0])
+
+	// Options of both commands, see logFlags
+	logFile string
+	topN    int
+	format  string
+	warn    bool
+	verbose bool
+)
+
+// commands, the first argument. Default is report.
+var commands = map[string]cli.Command{
+	"report": {
+		Run:   report,
+		Flags: logFlags,
+		Help:  "top hosts and paths, status codes, bytes per hour and busiest seconds",
+	},
+	"sessions": {
+		Run: sessions,
+		Flags: func(fs *flag.FlagSet) {
+			logFlags(fs)
+			fs.DurationVar(&timeout, "timeout", 30*time.Minute, "inactivity timeout that ends a session")
+			fs.IntVar(&depth, "depth", 3, "longest navigation path (in pages) to count")
+			fs.StringVar(&assets, "assets", ".gif,.jpg,.jpeg,.png,.xbm,.ico,.css,.js", "comma separated extensions of requests that aren't pages")
+		},
+		Help: "visitor sessions, their length, entry and exit pages and navigation paths",
+	},
+}
+
+// logFlags adds the options of commands reading the log
+func logFlags(fs *flag.FlagSet) {
+	fs.StringVar(&logFile, "log", "sha1/http.log.gz", "access log file (CLF or Combined, can be compressed)")
+	fs.IntVar(&topN, "n", 10, "number of top entries to show")
+	fs.StringVar(&format, "format", "text", "output format: text or json")
+	fs.BoolVar(&warn, "warn", false, "print malformed lines to stderr")
+	fs.BoolVar(&verbose, "v", false, "print number of requests and time to stderr")
+}
+
+func main() {
+	cli.Main(commands, "report")
+}
+
+// checkLogFlags returns an error if the options of logFlags are bad
+func checkLogFlags() error {
+	if topN < 1 {
+		return fmt.Errorf("-n must be positive")
+	}
+	switch format {
+	case "text", "json":
+	default:
+		return fmt.Errorf("unknown format: %q", format)
+	}
+	return nil
+}
+
+// readLog calls fn for every record in -log, it returns the number of
+// malformed lines
+func readLog(ctx context.Context, fn func(rec *accesslog.Record)) (int, error) {
+	r, err := accesslog.Open(logFile)
+	if err != nil {
+		return 0, err
+	}
+	defer r.Close()
+
+	for n := 0; ; n++ {
+		if n%1024 == 0 && ctx.Err() != nil {
+			return r.BadLines(), ctx.Err()
+		}
+
+		rec, err := r.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return r.BadLines(), err
+		}
+		fn(&rec)
+	}
+
+	if warn {
+		for _, pe := range r.Malformed() {
+			fmt.Fprintf(os.Stderr, "%s: %s: %s\n", prog, pe, pe.Text)
+		}
+		if kept := len(r.Malformed()); kept < r.BadLines() {
+			fmt.Fprintf(os.Stderr, "%s: ... and %d more malformed lines\n", prog, r.BadLines()-kept)
+		}
+	}
+	return r.BadLines(), nil
+}
@@ -0,0 +1,49 @@
+package words
+
+import "math"
+
+// Collocation scores of a bigram "w1 w2": n12 is the count of the bigram, n1
+// and n2 the counts of w1 and w2, n the number of words.
+
+// PMI returns the pointwise mutual information of a bigram in bits, how much
+// more often the words appear together than by chance. It favors rare words,
+// filter low counts before using it.
+func PMI(n12, n1, n2, n int64) float64 {
+	if n12 <= 0 || n1 <= 0 || n2 <= 0 {
+		return math.Inf(-1)
+	}
+	return math.Log2(float64(n12) * float64(n) / (float64(n1) * float64(n2)))
+}
+
+// LLR returns Dunning's log-likelihood ratio (G²) of a bigram, how unlikely
+// it is the words are independent. Unlike PMI it's reliable for low counts.
+func LLR(n12, n1, n2, n int64) float64 {
+	k11 := n12
+	k12 := nonNegative(n1 - n12) // w1 not followed by w2
+	k21 := nonNegative(n2 - n12) // w2 not after w1
+	k22 := nonNegative(n - k11 - k12 - k21)
+
+	rows := []int64{k11 + k12, k21 + k22}
+	cols := []int64{k11 + k21, k12 + k22}
+	total := float64(k11 + k12 + k21 + k22)
+	cells := [2][2]int64{{k11, k12}, {k21, k22}}
+
+	g2 := 0.0
+	for i := range cells {
+		for j, k := range cells[i] {
+			if k == 0 {
+				continue
+			}
+			expected := float64(rows[i]) * float64(cols[j]) / total
+			g2 += float64(k) * math.Log(float64(k)/expected)
+		}
+	}
+	return 2 * g2
+}
+
+func nonNegative(n int64) int64 {
+	if n < 0 {
+		return 0
+	}
+	return n
+}
@@ -0,0 +1,80 @@
+package words
+
+import (
+	"math"
+	"testing"
+)
+
+func near(a, b float64) bool {
+	return math.Abs(a-b) < 1e-9
+}
+
+func TestPMI(t *testing.T) {
+	cases := []struct {
+		name           string
+		n12, n1, n2, n int64
+		want           float64
+	}{
+		{"independent", 10, 100, 100, 1000, 0},
+		{"always together", 10, 10, 10, 1000, math.Log2(100)},
+		{"less than chance", 1, 100, 100, 1000, math.Log2(0.1)},
+		{"new companies", 8, 15828, 4675, 14307668, math.Log2(8 * 14307668 / (15828.0 * 4675))},
+	}
+	for _, tc := range cases {
+		if got := PMI(tc.n12, tc.n1, tc.n2, tc.n); !near(got, tc.want) {
+			t.Errorf("%s: got %f, want %f", tc.name, got, tc.want)
+		}
+	}
+
+	for _, counts := range [][4]int64{{0, 10, 10, 100}, {1, 0, 10, 100}, {1, 10, 0, 100}} {
+		if got := PMI(counts[0], counts[1], counts[2], counts[3]); !math.IsInf(got, -1) {
+			t.Errorf("PMI%v = %f, want -Inf", counts, got)
+		}
+	}
+}
+
+func TestLLR(t *testing.T) {
+	cases := []struct {
+		name           string
+		n12, n1, n2, n int64
+		want           float64
+	}{
+		// the table is [[10 0] [0 10]], G² = 2N ln 2
+		{"always together", 10, 10, 10, 20, 40 * math.Ln2},
+		{"independent", 10, 100, 100, 1000, 0},
+		// Manning & Schütze's "new companies" (5.3.3): not a collocation,
+		// below the 3.84 critical value like their χ² of 1.55
+		{"new companies", 8, 15828, 4675, 14307668, 1.3253893963471581},
+	}
+	for _, tc := range cases {
+		if got := LLR(tc.n12, tc.n1, tc.n2, tc.n); math.Abs(got-tc.want) > 1e-6 {
+			t.Errorf("%s: got %f, want %f", tc.name, got, tc.want)
+		}
+	}
+
+	// The score doesn't depend on which word is first
+	if a, b := LLR(8, 15828, 4675, 14307668), LLR(8, 4675, 15828, 14307668); !near(a, b) {
+		t.Errorf("not symmetric: %f, %f", a, b)
+	}
+}
+
+// Empty cells and inconsistent counts give a finite score, never NaN
+func TestLLRZeroCounts(t *testing.T) {
+	cases := [][4]int64{
+		{0, 10, 10, 100}, // never together
+		{0, 0, 0, 0},
+		{0, 0, 10, 10},
+		{5, 5, 5, 5},    // every word is w1 and w2
+		{10, 5, 5, 100}, // more bigrams than words
+		{1, 1, 1, 0},
+	}
+	for _, c := range cases {
+		got := LLR(c[0], c[1], c[2], c[3])
+		if math.IsNaN(got) || math.IsInf(got, 0) || got < -1e-9 {
+			t.Errorf("LLR%v = %f", c, got)
+		}
+	}
+	if got := LLR(0, 0, 0, 0); got != 0 {
+		t.Errorf("no words: got %f, want 0", got)
+	}
+}
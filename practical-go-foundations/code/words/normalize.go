@@ -0,0 +1,109 @@
+package words
+
+import (
+	"bufio"
+	"io"
+	"os"
+	"strings"
+)
+
+// Stage is a step in normalizing a word, it returns "" to drop the word.
+// Stem is a Stage, so is the Filter method of StopWords.
+type Stage func(word string) string
+
+// Normalizer applies stages to words in order, e.g. remove stop words and
+// then stem
+type Normalizer []Stage
+
+// Normalize returns the normalized word, "" if it was dropped
+func (n Normalizer) Normalize(word string) string {
+	for _, stage := range n {
+		if word = stage(word); word == "" {
+			return ""
+		}
+	}
+	return word
+}
+
+// StopWords is a set of words to ignore
+type StopWords map[string]bool
+
+// Filter returns "" if word is a stop word
+func (s StopWords) Filter(word string) string {
+	if s[word] {
+		return ""
+	}
+	return word
+}
+
+// NewStopWords returns a set of words, they are folded like Unicode does
+func NewStopWords(words ...string) StopWords {
+	s := make(StopWords, len(words))
+	for _, w := range words {
+		s[normalizeStopWord(w)] = true
+	}
+	return s
+}
+
+func normalizeStopWord(w string) string {
+	w = FoldString(strings.TrimSpace(w))
+	return strings.Map(func(r rune) rune {
+		if isApostrophe(r) {
+			return '\''
+		}
+		return r
+	}, w)
+}
+
+// ReadStopWords reads stop words, one per line. Text after | or # is a
+// comment (| is used in the Snowball lists).
+func ReadStopWords(r io.Reader) (StopWords, error) {
+	s := make(StopWords)
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if i := strings.IndexAny(line, "|#"); i >= 0 {
+			line = line[:i]
+		}
+		for _, w := range strings.Fields(line) {
+			s[normalizeStopWord(w)] = true
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// LoadStopWords reads stop words from a file, see ReadStopWords
+func LoadStopWords(path string) (StopWords, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	return ReadStopWords(file)
+}
+
+// English are English stop words (the Snowball list)
+var English = NewStopWords(
+	"i", "me", "my", "myself", "we", "our", "ours", "ourselves", "you", "your",
+	"yours", "yourself", "yourselves", "he", "him", "his", "himself", "she", "her",
+	"hers", "herself", "it", "its", "itself", "they", "them", "their", "theirs",
+	"themselves", "what", "which", "who", "whom", "this", "that", "these", "those",
+	"am", "is", "are", "was", "were", "be", "been", "being", "have", "has", "had",
+	"having", "do", "does", "did", "doing", "would", "should", "could", "ought",
+	"i'm", "you're", "he's", "she's", "it's", "we're", "they're", "i've", "you've",
+	"we've", "they've", "i'd", "you'd", "he'd", "she'd", "we'd", "they'd", "i'll",
+	"you'll", "he'll", "she'll", "we'll", "they'll", "isn't", "aren't", "wasn't",
+	"weren't", "hasn't", "haven't", "hadn't", "doesn't", "don't", "didn't", "won't",
+	"wouldn't", "shan't", "shouldn't", "can't", "cannot", "couldn't", "mustn't",
+	"let's", "that's", "who's", "what's", "here's", "there's", "when's", "where's",
+	"why's", "how's", "a", "an", "the", "and", "but", "if", "or", "because", "as",
+	"until", "while", "of", "at", "by", "for", "with", "about", "against", "between",
+	"into", "through", "during", "before", "after", "above", "below", "to", "from",
+	"up", "down", "in", "out", "on", "off", "over", "under", "again", "further",
+	"then", "once", "here", "there", "when", "where", "why", "how", "all", "any",
+	"both", "each", "few", "more", "most", "other", "some", "such", "no", "nor",
+	"not", "only", "own", "same", "so", "than", "too", "very",
+)
@@ -0,0 +1,321 @@
+package words
+
+import "strings"
+
+// Stem returns the stem of an English word (lower case) using the Porter2
+// (Snowball English) stemmer, "detective" and "detectives" are both
+// "detect". Words with characters other than a-z and ' are returned as is.
+//
+// See https://snowballstem.org/algorithms/english/stemmer.html
+func Stem(word string) string {
+	if len(word) <= 2 || !isASCIIWord(word) {
+		return word
+	}
+
+	w := []byte(strings.TrimPrefix(word, "'"))
+	if s, ok := stemExceptions[string(w)]; ok {
+		return s
+	}
+
+	// y at the start or after a vowel is a consonant, mark it Y
+	for i, c := range w {
+		if c == 'y' && (i == 0 || isVowel(w[i-1])) {
+			w[i] = 'Y'
+		}
+	}
+
+	r1, r2 := regions(w)
+	st := &stemmer{w, r1, r2}
+	st.step0()
+	st.step1a()
+	if _, ok := step1aInvariants[string(st.w)]; ok {
+		return strings.ToLower(string(st.w))
+	}
+	st.step1b()
+	st.step1c()
+	st.step2()
+	st.step3()
+	st.step4()
+	st.step5()
+	return strings.ToLower(string(st.w))
+}
+
+// stemExceptions are words with special stems
+var stemExceptions = map[string]string{
+	"skis": "ski", "skies": "sky", "dying": "die", "lying": "lie", "tying": "tie",
+	"idly": "idl", "gently": "gentl", "ugly": "ugli", "early": "earli", "only": "onli",
+	"singly": "singl",
+	// invariant
+	"sky": "sky", "news": "news", "howe": "howe", "atlas": "atlas", "cosmos": "cosmos",
+	"bias": "bias", "andes": "andes",
+}
+
+// step1aInvariants aren't stemmed further after step 1a
+var step1aInvariants = map[string]bool{
+	"inning": true, "outing": true, "canning": true, "herring": true, "earring": true,
+	"proceed": true, "exceed": true, "succeed": true,
+}
+
+func isASCIIWord(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if (s[i] < 'a' || s[i] > 'z') && s[i] != '\'' {
+			return false
+		}
+	}
+	return true
+}
+
+func isVowel(c byte) bool {
+	switch c {
+	case 'a', 'e', 'i', 'o', 'u', 'y':
+		return true
+	}
+	return false
+}
+
+// regions returns the start of R1 and R2. R1 is after the first non-vowel
+// following a vowel, R2 is the same in R1.
+func regions(w []byte) (int, int) {
+	r1 := -1
+	for _, prefix := range []string{"gener", "commun", "arsen"} {
+		if strings.HasPrefix(string(w), prefix) {
+			r1 = len(prefix)
+			break
+		}
+	}
+	if r1 < 0 {
+		r1 = nextRegion(w, 0)
+	}
+	return r1, nextRegion(w, r1)
+}
+
+func nextRegion(w []byte, start int) int {
+	for i := start + 1; i < len(w); i++ {
+		if !isVowel(w[i]) && isVowel(w[i-1]) {
+			return i + 1
+		}
+	}
+	return len(w)
+}
+
+// stemmer is a word being stemmed
+type stemmer struct {
+	w      []byte
+	r1, r2 int
+}
+
+func (s *stemmer) hasSuffix(suffix string) bool {
+	return strings.HasSuffix(string(s.w), suffix)
+}
+
+// longest returns the longest of suffixes w ends with, "" if none
+func (s *stemmer) longest(suffixes ...string) string {
+	best := ""
+	for _, suf := range suffixes {
+		if len(suf) > len(best) && s.hasSuffix(suf) {
+			best = suf
+		}
+	}
+	return best
+}
+
+// inR1 returns true if suffix is in R1
+func (s *stemmer) inR1(suffix string) bool {
+	return len(s.w)-len(suffix) >= s.r1
+}
+
+func (s *stemmer) inR2(suffix string) bool {
+	return len(s.w)-len(suffix) >= s.r2
+}
+
+// replace replaces suffix with repl
+func (s *stemmer) replace(suffix, repl string) {
+	s.w = append(s.w[:len(s.w)-len(suffix)], repl...)
+}
+
+// hasVowel returns true if there's a vowel in w[:end]
+func (s *stemmer) hasVowel(end int) bool {
+	for _, c := range s.w[:end] {
+		if isVowel(c) {
+			return true
+		}
+	}
+	return false
+}
+
+// endsShortSyllable returns true if w[:end] ends with a short syllable: a
+// non-vowel, vowel and a non-vowel other than w, x or Y. Or a vowel and a
+// non-vowel at the start of the word.
+func (s *stemmer) endsShortSyllable(end int) bool {
+	w := s.w[:end]
+	n := len(w)
+	if n == 2 {
+		return isVowel(w[0]) && !isVowel(w[1])
+	}
+	if n < 3 {
+		return false
+	}
+	c := w[n-1]
+	return !isVowel(w[n-3]) && isVowel(w[n-2]) && !isVowel(c) && c != 'w' && c != 'x' && c != 'Y'
+}
+
+// isShort returns true for short words: R1 is empty and they end in a short
+// syllable
+func (s *stemmer) isShort() bool {
+	return s.r1 >= len(s.w) && s.endsShortSyllable(len(s.w))
+}
+
+func (s *stemmer) step0() {
+	if suf := s.longest("'", "'s", "'s'"); suf != "" {
+		s.replace(suf, "")
+	}
+}
+
+func (s *stemmer) step1a() {
+	switch suf := s.longest("sses", "ied", "ies", "s", "us", "ss"); suf {
+	case "sses":
+		s.replace(suf, "ss")
+	case "ied", "ies":
+		if len(s.w) > 4 {
+			s.replace(suf, "i")
+		} else {
+			s.replace(suf, "ie")
+		}
+	case "s":
+		// gaps -> gap, but gas stays
+		if s.hasVowel(len(s.w) - 2) {
+			s.replace(suf, "")
+		}
+	}
+}
+
+func (s *stemmer) step1b() {
+	switch suf := s.longest("eed", "eedly", "ed", "edly", "ing", "ingly"); suf {
+	case "eed", "eedly":
+		if s.inR1(suf) {
+			s.replace(suf, "ee")
+		}
+	case "ed", "edly", "ing", "ingly":
+		if !s.hasVowel(len(s.w) - len(suf)) {
+			return
+		}
+		s.replace(suf, "")
+		switch {
+		case s.hasSuffix("at"), s.hasSuffix("bl"), s.hasSuffix("iz"):
+			s.w = append(s.w, 'e')
+		case s.endsDouble():
+			s.w = s.w[:len(s.w)-1]
+		case s.isShort():
+			s.w = append(s.w, 'e')
+		}
+	}
+}
+
+// endsDouble returns true if w ends with bb, dd, ff, gg, mm, nn, pp, rr or tt
+func (s *stemmer) endsDouble() bool {
+	n := len(s.w)
+	if n < 2 || s.w[n-1] != s.w[n-2] {
+		return false
+	}
+	switch s.w[n-1] {
+	case 'b', 'd', 'f', 'g', 'm', 'n', 'p', 'r', 't':
+		return true
+	}
+	return false
+}
+
+func (s *stemmer) step1c() {
+	n := len(s.w)
+	if n > 2 && (s.w[n-1] == 'y' || s.w[n-1] == 'Y') && !isVowel(s.w[n-2]) {
+		s.w[n-1] = 'i'
+	}
+}
+
+// step2Suffixes are replaced in R1, "ogi" and "li" have extra conditions
+var step2Suffixes = map[string]string{
+	"tional": "tion", "enci": "ence", "anci": "ance", "abli": "able", "entli": "ent",
+	"izer": "ize", "ization": "ize", "ational": "ate", "ation": "ate", "ator": "ate",
+	"alism": "al", "aliti": "al", "alli": "al", "fulness": "ful", "ousli": "ous",
+	"ousness": "ous", "iveness": "ive", "iviti": "ive", "biliti": "ble", "bli": "ble",
+	"ogi": "og", "fulli": "ful", "lessli": "less", "li": "",
+}
+
+// step3Suffixes are replaced in R1, "ative" only in R2
+var step3Suffixes = map[string]string{
+	"tional": "tion", "ational": "ate", "alize": "al", "icate": "ic", "iciti": "ic",
+	"ical": "ic", "ful": "", "ness": "", "ative": "",
+}
+
+var step4Suffixes = []string{
+	"al", "ance", "ence", "er", "ic", "able", "ible", "ant", "ement", "ment", "ent",
+	"ism", "ate", "iti", "ous", "ive", "ize", "ion",
+}
+
+// longestOf returns the longest key of suffixes w ends with
+func (s *stemmer) longestOf(suffixes map[string]string) string {
+	best := ""
+	for suf := range suffixes {
+		if len(suf) > len(best) && s.hasSuffix(suf) {
+			best = suf
+		}
+	}
+	return best
+}
+
+func (s *stemmer) step2() {
+	suf := s.longestOf(step2Suffixes)
+	if suf == "" || !s.inR1(suf) {
+		return
+	}
+	before := len(s.w) - len(suf)
+	switch suf {
+	case "ogi":
+		if before == 0 || s.w[before-1] != 'l' {
+			return
+		}
+	case "li":
+		if before == 0 || !strings.ContainsRune("cdeghkmnrt", rune(s.w[before-1])) {
+			return
+		}
+	}
+	s.replace(suf, step2Suffixes[suf])
+}
+
+func (s *stemmer) step3() {
+	suf := s.longestOf(step3Suffixes)
+	if suf == "" || !s.inR1(suf) {
+		return
+	}
+	if suf == "ative" && !s.inR2(suf) {
+		return
+	}
+	s.replace(suf, step3Suffixes[suf])
+}
+
+func (s *stemmer) step4() {
+	suf := s.longest(step4Suffixes...)
+	if suf == "" || !s.inR2(suf) {
+		return
+	}
+	if suf == "ion" {
+		before := len(s.w) - len(suf)
+		if before == 0 || (s.w[before-1] != 's' && s.w[before-1] != 't') {
+			return
+		}
+	}
+	s.replace(suf, "")
+}
+
+func (s *stemmer) step5() {
+	n := len(s.w)
+	switch {
+	case s.hasSuffix("e"):
+		if s.inR2("e") || (s.inR1("e") && !s.endsShortSyllable(n-1)) {
+			s.replace("e", "")
+		}
+	case s.hasSuffix("l"):
+		if s.inR2("l") && n >= 2 && s.w[n-2] == 'l' {
+			s.replace("l", "")
+		}
+	}
+}
@@ -0,0 +1,179 @@
+package words
+
+import (
+	"strings"
+	"testing"
+)
+
+// vocabulary is word and stem pairs, the samples of the Snowball English
+// stemmer page and the special cases of the algorithm
+const vocabulary = `
+consign consign
+consigned consign
+consigning consign
+consignment consign
+consist consist
+consisted consist
+consistency consist
+consistent consist
+consistently consist
+consisting consist
+consists consist
+consolation consol
+consolations consol
+consolatory consolatori
+console consol
+consoled consol
+consoles consol
+consolidate consolid
+consolidated consolid
+consolidating consolid
+consoling consol
+consolingly consol
+consols consol
+consonant conson
+consort consort
+consorted consort
+consorting consort
+conspicuous conspicu
+conspicuously conspicu
+conspiracy conspiraci
+conspirator conspir
+conspirators conspir
+conspire conspir
+conspired conspir
+conspiring conspir
+constable constabl
+constables constabl
+constance constanc
+constancy constanc
+constant constant
+knack knack
+knackeries knackeri
+knacks knack
+knag knag
+knave knave
+knaves knave
+knavish knavish
+kneaded knead
+kneading knead
+knee knee
+kneel kneel
+kneeled kneel
+kneeling kneel
+kneels kneel
+knees knee
+knell knell
+knelt knelt
+knew knew
+knick knick
+knif knif
+knife knife
+knight knight
+knightly knight
+knights knight
+knit knit
+knits knit
+knitted knit
+knitting knit
+knives knive
+knob knob
+knobs knob
+knock knock
+knocked knock
+knocker knocker
+knockers knocker
+knocking knock
+knocks knock
+knopp knopp
+knot knot
+knots knot
+caresses caress
+ponies poni
+ties tie
+cries cri
+gaps gap
+gas gas
+kiwis kiwi
+agreed agre
+feed feed
+hopping hop
+hoping hope
+happy happi
+sayings say
+abeyance abey
+relational relat
+rational ration
+detective detect
+detectives detect
+generously generous
+generate generat
+communism communism
+arsenal arsenal
+sherlock's sherlock
+skis ski
+skies sky
+dying die
+lying lie
+tying tie
+idly idl
+gently gentl
+ugly ugli
+early earli
+only onli
+singly singl
+sky sky
+news news
+atlas atlas
+cosmos cosmos
+bias bias
+andes andes
+innings inning
+outings outing
+canning canning
+herring herring
+earring earring
+proceed proceed
+exceed exceed
+succeeding succeed
+`
+
+func TestStem(t *testing.T) {
+	for _, line := range strings.Split(strings.TrimSpace(vocabulary), "\n") {
+		word, want, _ := strings.Cut(line, " ")
+		if got := Stem(word); got != want {
+			t.Errorf("Stem(%q) = %q, want %q", word, got, want)
+		}
+	}
+}
+
+func TestStemAsIs(t *testing.T) {
+	// Short words and words that aren't a-z are returned as is
+	for _, word := range []string{"a", "is", "café", "1895", "x-ray"} {
+		if got := Stem(word); got != word {
+			t.Errorf("Stem(%q) = %q", word, got)
+		}
+	}
+}
+
+func TestNormalizer(t *testing.T) {
+	stop, err := ReadStopWords(strings.NewReader("the | an article\n\n# comment\nof\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	n := Normalizer{stop.Filter, Stem}
+	cases := map[string]string{
+		"the":        "",
+		"of":         "",
+		"detectives": "detect",
+		"holmes":     "holm",
+	}
+	for word, want := range cases {
+		if got := n.Normalize(word); got != want {
+			t.Errorf("Normalize(%q) = %q, want %q", word, got, want)
+		}
+	}
+	if len(stop) != 2 {
+		t.Errorf("%d stop words, want 2", len(stop))
+	}
+}
@@ -0,0 +1,137 @@
+// Package words splits text to words for word frequency and other text
+// statistics (see freq).
+//
+// A Tokenizer returns the words in a text, folded to lower case. Unicode
+// follows the word boundaries of Unicode Standard Annex #29 (UAX #29) for the
+// common cases: words are letters and combining marks, an apostrophe between
+// letters is part of the word ("who's", "o’clock"), ideographs are words by
+// themselves. ASCII is the old [a-zA-Z]+ tokenizer.
+package words
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Tokenizer splits text to words
+type Tokenizer interface {
+	Tokenize(text string) []string
+}
+
+// TokenizerFunc is a function that is a Tokenizer
+type TokenizerFunc func(text string) []string
+
+func (f TokenizerFunc) Tokenize(text string) []string {
+	return f(text)
+}
+
+// Regexp is a tokenizer where words are the matches of a regular expression,
+// in lower case
+type Regexp struct {
+	Re *regexp.Regexp
+}
+
+func (r Regexp) Tokenize(text string) []string {
+	words := r.Re.FindAllString(text, -1)
+	for i, w := range words {
+		words[i] = strings.ToLower(w)
+	}
+	return words
+}
+
+// ASCII splits on everything that isn't an ASCII letter, "Who's" is "who" and
+// "s"
+var ASCII Tokenizer = Regexp{regexp.MustCompile(`[a-zA-Z]+`)}
+
+// Unicode is a UAX #29 style tokenizer. It differs from the standard where it
+// helps word counting: hyphens and underscores (_italics_ in Project
+// Gutenberg texts) split words, and all apostrophes are written as ' so
+// "who’s" and "who's" are the same word. Scripts written without spaces
+// (e.g. Thai) need a dictionary and aren't split.
+type Unicode struct {
+	Numbers bool // numbers (e.g. 1895) are words, default is to skip them
+}
+
+func (u Unicode) Tokenize(text string) []string {
+	var words []string
+	var b strings.Builder
+	inWord := false
+	flush := func() {
+		if b.Len() > 0 {
+			words = append(words, b.String())
+			b.Reset()
+		}
+		inWord = false
+	}
+
+	for i := 0; i < len(text); {
+		r, size := utf8.DecodeRuneInString(text[i:])
+		i += size
+
+		switch {
+		case isIdeograph(r):
+			flush()
+			b.WriteRune(r)
+			flush()
+		case isApostrophe(r): // before letters, ʼ is one
+			// only between letters
+			next, _ := utf8.DecodeRuneInString(text[i:])
+			if inWord && unicode.IsLetter(next) && !isIdeograph(next) && !isApostrophe(next) {
+				b.WriteByte('\'')
+				continue
+			}
+			flush()
+		case unicode.IsLetter(r):
+			b.WriteRune(Fold(r))
+			inWord = true
+		case inWord && unicode.In(r, unicode.Mn, unicode.Mc, unicode.Me):
+			b.WriteRune(r)
+		case unicode.IsDigit(r) && (inWord || u.Numbers):
+			// digits after letters are part of the word (e.g. "b2")
+			b.WriteRune(r)
+			inWord = true
+		default:
+			flush()
+		}
+	}
+	flush()
+	return words
+}
+
+// Fold returns the case folded r, it maps all cases of a letter to the same
+// rune (unlike unicode.ToLower, e.g. "ς" and "σ" are both "σ")
+func Fold(r rune) rune {
+	return unicode.ToLower(unicode.ToUpper(r))
+}
+
+// FoldString returns the case folded s
+func FoldString(s string) string {
+	return strings.Map(Fold, s)
+}
+
+func isApostrophe(r rune) bool {
+	switch r {
+	case '\'', '’', 'ʼ':
+		return true
+	}
+	return false
+}
+
+// isIdeograph returns true for characters that are words by themselves
+func isIdeograph(r rune) bool {
+	return unicode.In(r, unicode.Han, unicode.Hiragana)
+}
+
+// ByName returns a tokenizer by name: "unicode" or "ascii"
+func ByName(name string) (Tokenizer, error) {
+	switch strings.ToLower(name) {
+	case "unicode":
+		return Unicode{}, nil
+	case "ascii":
+		return ASCII, nil
+	}
+	return nil, fmt.Errorf("unknown tokenizer: %q", name)
+}
@@ -0,0 +1,81 @@
+package words
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestUnicode(t *testing.T) {
+	cases := []struct {
+		text string
+		want []string
+	}{
+		{"Who's there?", []string{"who's", "there"}},
+		{"Who’s there?", []string{"who's", "there"}}, // curly apostrophe
+		{"WHOʼS", []string{"who's"}},                 // modifier letter apostrophe
+		{"at ten o’clock", []string{"at", "ten", "o'clock"}},
+		{"the dogs' bones", []string{"the", "dogs", "bones"}},
+		{"'Tis ‘quoted’", []string{"tis", "quoted"}},
+		{"rock ’n’ roll", []string{"rock", "n", "roll"}},
+		{"_well-known_ fact", []string{"well", "known", "fact"}},
+		{"café", []string{"café"}},
+		{"cafe\u0301 au lait", []string{"cafe\u0301", "au", "lait"}}, // e + combining acute
+		{"\u0301a", []string{"a"}},                                   // no letter to combine with
+		{"हिन्दी", []string{"हिन्दी"}},                               // spacing and non-spacing marks
+		{"東京タワー", []string{"東", "京", "タワー"}},                         // katakana isn't split
+		{"ひらがな", []string{"ひ", "ら", "が", "な"}},
+		{"ΣΟΦΌΣ σοφός", []string{"σοφόσ", "σοφόσ"}}, // final sigma
+		{"STRASSE Straße", []string{"strasse", "straße"}},
+		{"in 1895, at 221B", []string{"in", "at", "b"}},
+		{"b2 and R2D2", []string{"b2", "and", "r2d2"}},
+		{"", nil},
+		{"... 42 ...", nil},
+	}
+	for _, tc := range cases {
+		if got := (Unicode{}).Tokenize(tc.text); !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("%q: got %q, want %q", tc.text, got, tc.want)
+		}
+	}
+}
+
+func TestUnicodeNumbers(t *testing.T) {
+	got := Unicode{Numbers: true}.Tokenize("in 1895, at 221B and ٣")
+	want := []string{"in", "1895", "at", "221b", "and", "٣"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestASCII(t *testing.T) {
+	got := ASCII.Tokenize("Who's at the café in 1895?")
+	want := []string{"who", "s", "at", "the", "caf", "in"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestFold(t *testing.T) {
+	cases := map[string]string{
+		"Sherlock": "sherlock",
+		"ς":        "σ",
+		"Σ":        "σ",
+		"ǅ":        "ǆ", // title case
+		"ΚΑΛΗΜΈΡΑ": "καλημέρα",
+	}
+	for s, want := range cases {
+		if got := FoldString(s); got != want {
+			t.Errorf("FoldString(%q) = %q, want %q", s, got, want)
+		}
+	}
+}
+
+func TestByName(t *testing.T) {
+	for _, name := range []string{"unicode", "ASCII"} {
+		if _, err := ByName(name); err != nil {
+			t.Errorf("%s: %s", name, err)
+		}
+	}
+	if _, err := ByName("whitespace"); err == nil {
+		t.Error("whitespace: no error")
+	}
+}